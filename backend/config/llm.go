@@ -0,0 +1,17 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/MadMax168/Readsum/llm"
+)
+
+// ConnectLLM sets up the language model configured in the environment. The
+// provider is handed to the services that need it rather than kept here.
+func ConnectLLM() (llm.Provider, error) {
+	provider, err := llm.FromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("can not configure LLM: %w", err)
+	}
+	return provider, nil
+}
@@ -0,0 +1,23 @@
+package config
+
+import (
+	"time"
+
+	"github.com/MadMax168/Readsum/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RunOnce applies the data migration called name unless it has been applied
+// before. The migration and its record are committed together; a server starting
+// at the same time waits for the first one and then skips it.
+func RunOnce(db *gorm.DB, name string, migrate func(tx *gorm.DB) error) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&models.Migration{Name: name, AppliedAt: time.Now()})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		return migrate(tx)
+	})
+}
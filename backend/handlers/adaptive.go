@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"github.com/MadMax168/Readsum/config"
+	"github.com/MadMax168/Readsum/customerrors"
+	"github.com/MadMax168/Readsum/services"
+	"github.com/gofiber/fiber/v2"
+)
+
+// conceptAccuracy sums the user's quiz answers in the chat per question concept
+func conceptAccuracy(chatID, userID uint) ([]services.ConceptAccuracy, error) {
+	var stats []services.ConceptAccuracy
+	err := config.DB.Table("answers").
+		Select("questions.concept AS concept, COUNT(*) AS answered, "+
+			"SUM(answers.points) AS points, SUM(answers.max_points) AS max_points").
+		Joins("JOIN questions ON questions.id = answers.question_id AND questions.deleted_at IS NULL").
+		Joins("JOIN quiz_attempts ON quiz_attempts.id = answers.attempt_id AND quiz_attempts.deleted_at IS NULL").
+		Joins("JOIN quizzes ON quizzes.id = quiz_attempts.quiz_id AND quizzes.deleted_at IS NULL").
+		Where("answers.deleted_at IS NULL AND quizzes.chat_id = ? AND quiz_attempts.user_id = ? AND questions.concept <> ''", chatID, userID).
+		Group("questions.concept").
+		Order("questions.concept").
+		Scan(&stats).Error
+
+	return stats, err
+}
+
+// CreateAdaptiveQuiz generates the next quiz of a chat from the student's
+// per-concept accuracy: more questions on weak concepts, harder ones on mastered ones
+func (h *Handler) CreateAdaptiveQuiz(c *fiber.Ctx) error {
+	chat, err := ownedChat(c)
+	if err != nil {
+		return err
+	}
+
+	var input CreateQuizInput
+	if err := c.BodyParser(&input); err != nil {
+		return customerrors.NewBadRequestError("Invalid request body")
+	}
+	if input.Questions == 0 {
+		input.Questions = defaultQuizQuestions
+	}
+
+	stats, err := conceptAccuracy(chat.ID, chat.UserID)
+	if err != nil {
+		return customerrors.NewInternalServerError("Database error")
+	}
+
+	plan := services.PlanAdaptiveQuiz(stats, input.Questions)
+
+	quiz, err := h.generateQuiz(chat, input, &plan)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"success": true,
+		"data": fiber.Map{
+			"quiz": toQuizResp(quiz),
+			"plan": plan,
+		},
+		"message": "Adaptive quiz created successfully",
+	})
+}
@@ -0,0 +1,384 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/MadMax168/Readsum/config"
+	"github.com/MadMax168/Readsum/customerrors"
+	"github.com/MadMax168/Readsum/models"
+	"github.com/MadMax168/Readsum/services"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type ConceptMasteryResp struct {
+	Concept       string   `json:"concept"`
+	Mastery       float64  `json:"mastery"`
+	Accuracy      float64  `json:"accuracy"`
+	Level         string   `json:"level"`
+	Attempts      int      `json:"attempts"`
+	Sources       []string `json:"sources"`
+	LastPracticed string   `json:"last_practiced"`
+}
+
+type DailyActivityResp struct {
+	Date              string  `json:"date"`
+	QuestionsAnswered int     `json:"questions_answered"`
+	Accuracy          float64 `json:"accuracy"`
+	CardsReviewed     int     `json:"cards_reviewed"`
+	CardsRecalled     int     `json:"cards_recalled"`
+	StudyMinutes      float64 `json:"study_minutes"`
+}
+
+type AnalyticsSummaryResp struct {
+	QuestionsAnswered int     `json:"questions_answered"`
+	Accuracy          float64 `json:"accuracy"`
+	CardsReviewed     int     `json:"cards_reviewed"`
+	CardRetention     float64 `json:"card_retention"`
+	StudyMinutes      float64 `json:"study_minutes"`
+	Concepts          int     `json:"concepts"`
+	MasteredConcepts  int     `json:"mastered_concepts"`
+	AverageMastery    float64 `json:"average_mastery"`
+}
+
+type AnalyticsResp struct {
+	ChatID     *uint                `json:"chat_id,omitempty"`
+	Days       int                  `json:"days"`
+	Summary    AnalyticsSummaryResp `json:"summary"`
+	Concepts   []ConceptMasteryResp `json:"concepts"`
+	Weakest    []ConceptMasteryResp `json:"weakest"`
+	TimeSeries []DailyActivityResp  `json:"time_series"`
+}
+
+func toConceptMasteryResp(m services.ConceptMastery) ConceptMasteryResp {
+	return ConceptMasteryResp{
+		Concept:       m.Concept,
+		Mastery:       m.Mastery,
+		Accuracy:      m.Accuracy,
+		Level:         m.Level,
+		Attempts:      m.Attempts,
+		Sources:       m.Sources,
+		LastPracticed: m.LastPracticed.Format("2006-01-02 15:04:05"),
+	}
+}
+
+type masteryRow struct {
+	Concept   string
+	Points    float64
+	MaxPoints float64
+	At        time.Time
+}
+
+// masteryEvents collects the user's graded quiz and exam answers per question
+// concept, and flashcard reviews with the deck title as concept, optionally
+// limited to one chat
+func masteryEvents(userID uint, chatID *uint) ([]services.MasteryEvent, error) {
+	var events []services.MasteryEvent
+	add := func(rows []masteryRow, source string) {
+		for _, r := range rows {
+			events = append(events, services.MasteryEvent{
+				Concept:   r.Concept,
+				Source:    source,
+				Points:    r.Points,
+				MaxPoints: r.MaxPoints,
+				At:        r.At,
+			})
+		}
+	}
+
+	var quizRows []masteryRow
+	query := config.DB.Table("answers").
+		Select("questions.concept AS concept, answers.points AS points, answers.max_points AS max_points, quiz_attempts.submitted_at AS at").
+		Joins("JOIN questions ON questions.id = answers.question_id AND questions.deleted_at IS NULL").
+		Joins("JOIN quiz_attempts ON quiz_attempts.id = answers.attempt_id AND quiz_attempts.deleted_at IS NULL").
+		Joins("JOIN quizzes ON quizzes.id = quiz_attempts.quiz_id AND quizzes.deleted_at IS NULL").
+		Where("answers.deleted_at IS NULL AND quiz_attempts.user_id = ?", userID)
+	if chatID != nil {
+		query = query.Where("quizzes.chat_id = ?", *chatID)
+	}
+	if err := query.Scan(&quizRows).Error; err != nil {
+		return nil, err
+	}
+	add(quizRows, services.SourceQuiz)
+
+	var examRows []masteryRow
+	query = config.DB.Table("exam_questions").
+		Select("questions.concept AS concept, exam_questions.points AS points, exam_questions.max_points AS max_points, exams.submitted_at AS at").
+		Joins("JOIN questions ON questions.id = exam_questions.question_id AND questions.deleted_at IS NULL").
+		Joins("JOIN exams ON exams.id = exam_questions.exam_id AND exams.deleted_at IS NULL").
+		Where("exam_questions.deleted_at IS NULL AND exams.submitted_at IS NOT NULL AND exams.user_id = ?", userID)
+	if chatID != nil {
+		query = query.Where("exams.chat_id = ?", *chatID)
+	}
+	if err := query.Scan(&examRows).Error; err != nil {
+		return nil, err
+	}
+	add(examRows, services.SourceExam)
+
+	// A review graded 3 or more is a successful recall
+	var cardRows []masteryRow
+	query = config.DB.Table("card_reviews").
+		Select("decks.title AS concept, CASE WHEN card_reviews.grade >= 3 THEN 1 ELSE 0 END AS points, 1 AS max_points, card_reviews.reviewed_at AS at").
+		Joins("JOIN cards ON cards.id = card_reviews.card_id AND cards.deleted_at IS NULL").
+		Joins("JOIN decks ON decks.id = cards.deck_id AND decks.deleted_at IS NULL").
+		Where("card_reviews.deleted_at IS NULL AND card_reviews.user_id = ?", userID)
+	if chatID != nil {
+		query = query.Where("decks.chat_id = ?", *chatID)
+	}
+	if err := query.Scan(&cardRows).Error; err != nil {
+		return nil, err
+	}
+	add(cardRows, services.SourceFlashcards)
+
+	return events, nil
+}
+
+// studySessions combines study logs with the time spent in finished exams
+func studySessions(userID uint, chatID *uint, since time.Time) ([]services.StudySession, error) {
+	var sessions []services.StudySession
+
+	var logs []models.StudyLog
+	query := config.DB.Where("user_id = ? AND started_at >= ?", userID, since)
+	if chatID != nil {
+		query = query.Where("chat_id = ?", *chatID)
+	}
+	if err := query.Find(&logs).Error; err != nil {
+		return nil, err
+	}
+	for _, l := range logs {
+		sessions = append(sessions, services.StudySession{Start: l.StartedAt, Seconds: l.DurationSeconds})
+	}
+
+	var exams []models.Exam
+	query = config.DB.Where("user_id = ? AND started_at >= ? AND submitted_at IS NOT NULL", userID, since)
+	if chatID != nil {
+		query = query.Where("chat_id = ?", *chatID)
+	}
+	if err := query.Find(&exams).Error; err != nil {
+		return nil, err
+	}
+	for _, e := range exams {
+		end := *e.SubmittedAt
+		if end.After(e.ExpiresAt) {
+			end = e.ExpiresAt
+		}
+		sessions = append(sessions, services.StudySession{Start: e.StartedAt, Seconds: int(end.Sub(e.StartedAt).Seconds())})
+	}
+
+	return sessions, nil
+}
+
+const (
+	defaultAnalyticsDays = 30
+	maxAnalyticsDays     = 365
+	defaultWeakest       = 5
+	maxWeakest           = 50
+)
+
+// analytics builds the report for the user, optionally limited to one chat.
+// Query parameters: days (time series length), weakest (list size) and tz (IANA zone for day buckets).
+func analytics(c *fiber.Ctx, userID uint, chatID *uint) error {
+	days := c.QueryInt("days", defaultAnalyticsDays)
+	if days < 1 || days > maxAnalyticsDays {
+		return customerrors.NewBadRequestError("Days must be between 1 and 365")
+	}
+	weakest := c.QueryInt("weakest", defaultWeakest)
+	if weakest < 1 || weakest > maxWeakest {
+		return customerrors.NewBadRequestError("Weakest must be between 1 and 50")
+	}
+	loc := time.Local
+	if tz := c.Query("tz"); tz != "" {
+		l, err := time.LoadLocation(tz)
+		if err != nil {
+			return customerrors.NewBadRequestError("Invalid time zone")
+		}
+		loc = l
+	}
+
+	now := time.Now()
+	since := now.AddDate(0, 0, -days)
+
+	events, err := masteryEvents(userID, chatID)
+	if err != nil {
+		return customerrors.NewInternalServerError("Database error")
+	}
+	sessions, err := studySessions(userID, chatID, since)
+	if err != nil {
+		return customerrors.NewInternalServerError("Database error")
+	}
+
+	mastery := services.ComputeMastery(events, now)
+	resp := AnalyticsResp{
+		ChatID:     chatID,
+		Days:       days,
+		Concepts:   []ConceptMasteryResp{},
+		Weakest:    []ConceptMasteryResp{},
+		TimeSeries: []DailyActivityResp{},
+	}
+
+	var total float64
+	for _, m := range mastery {
+		resp.Concepts = append(resp.Concepts, toConceptMasteryResp(m))
+		total += m.Mastery
+		if m.Level == services.LevelMastered {
+			resp.Summary.MasteredConcepts++
+		}
+	}
+	resp.Summary.Concepts = len(mastery)
+	if len(mastery) > 0 {
+		resp.Summary.AverageMastery = math.Round(total/float64(len(mastery))*100) / 100
+	}
+	for _, m := range services.WeakestConcepts(mastery, weakest) {
+		if m.Level != services.LevelMastered {
+			resp.Weakest = append(resp.Weakest, toConceptMasteryResp(m))
+		}
+	}
+
+	var points, maxPoints float64
+	var recalled, studySeconds int
+	for _, d := range services.DailyTimeSeries(events, sessions, days, now, loc) {
+		resp.TimeSeries = append(resp.TimeSeries, DailyActivityResp{
+			Date:              d.Date.Format("2006-01-02"),
+			QuestionsAnswered: d.QuestionsAnswered,
+			Accuracy:          d.Accuracy(),
+			CardsReviewed:     d.CardsReviewed,
+			CardsRecalled:     d.CardsRecalled,
+			StudyMinutes:      math.Round(float64(d.StudySeconds)/60*10) / 10,
+		})
+		resp.Summary.QuestionsAnswered += d.QuestionsAnswered
+		resp.Summary.CardsReviewed += d.CardsReviewed
+		points += d.Points
+		maxPoints += d.MaxPoints
+		recalled += d.CardsRecalled
+		studySeconds += d.StudySeconds
+	}
+
+	// Summary totals cover the same window as the time series
+	if maxPoints > 0 {
+		resp.Summary.Accuracy = math.Round(points/maxPoints*100) / 100
+	}
+	if resp.Summary.CardsReviewed > 0 {
+		resp.Summary.CardRetention = math.Round(float64(recalled)/float64(resp.Summary.CardsReviewed)*100) / 100
+	}
+	resp.Summary.StudyMinutes = math.Round(float64(studySeconds)/60*10) / 10
+
+	return c.Status(200).JSON(fiber.Map{
+		"success": true,
+		"data":    resp,
+		"message": "Analytics retrieved successfully",
+	})
+}
+
+// GetUserAnalytics reports mastery and progress across all of the user's chats
+func GetUserAnalytics(c *fiber.Ctx) error {
+	UID, ok := c.Locals("userID").(uint)
+	if !ok || UID == 0 {
+		return customerrors.NewUnauthorizedError("Authentication required")
+	}
+
+	return analytics(c, UID, nil)
+}
+
+// GetChatAnalytics reports mastery and progress within one chat
+func GetChatAnalytics(c *fiber.Ctx) error {
+	chat, err := ownedChat(c)
+	if err != nil {
+		return err
+	}
+
+	return analytics(c, chat.UserID, &chat.ID)
+}
+
+// maxStudyLogSeconds caps a single reported session at 12 hours
+const maxStudyLogSeconds = 12 * 60 * 60
+
+type StudyLogResp struct {
+	Index           uint   `json:"index"`
+	ChatID          *uint  `json:"chat_id,omitempty"`
+	Activity        string `json:"activity"`
+	DurationSeconds int    `json:"duration_seconds"`
+	StartedAt       string `json:"started_at"`
+}
+
+type LogStudyInput struct {
+	ChatID          *uint  `json:"chat_id"`
+	Activity        string `json:"activity"`
+	DurationSeconds int    `json:"duration_seconds"`
+	StartedAt       string `json:"started_at"`
+}
+
+// LogStudy records study time reported by the client, such as time spent reading a document
+func LogStudy(c *fiber.Ctx) error {
+	UID, ok := c.Locals("userID").(uint)
+	if !ok || UID == 0 {
+		return customerrors.NewUnauthorizedError("Authentication required")
+	}
+
+	var input LogStudyInput
+	if err := c.BodyParser(&input); err != nil {
+		return customerrors.NewBadRequestError("Invalid request body")
+	}
+
+	if input.DurationSeconds < 1 || input.DurationSeconds > maxStudyLogSeconds {
+		return customerrors.NewBadRequestError("Duration must be between 1 second and 12 hours")
+	}
+
+	if input.Activity == "" {
+		input.Activity = models.ActivityOther
+	}
+	switch input.Activity {
+	case models.ActivityReading, models.ActivityChat, models.ActivityQuiz,
+		models.ActivityFlashcards, models.ActivityExam, models.ActivityOther:
+	default:
+		return customerrors.NewBadRequestError("Activity must be 'reading', 'chat', 'quiz', 'flashcards', 'exam' or 'other'")
+	}
+
+	now := time.Now()
+	startedAt := now.Add(-time.Duration(input.DurationSeconds) * time.Second)
+	if input.StartedAt != "" {
+		t, err := time.Parse(time.RFC3339, input.StartedAt)
+		if err != nil {
+			return customerrors.NewBadRequestError("Started at must be an RFC 3339 timestamp")
+		}
+		if t.After(now) {
+			return customerrors.NewBadRequestError("Started at cannot be in the future")
+		}
+		startedAt = t
+	}
+
+	if input.ChatID != nil {
+		var chat models.Chat
+		if err := config.DB.Where("id = ? AND user_id = ?", *input.ChatID, UID).First(&chat).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return customerrors.NewNotFoundError("Chat not found")
+			}
+			return customerrors.NewInternalServerError("Database error")
+		}
+	}
+
+	studyLog := models.StudyLog{
+		Activity:        input.Activity,
+		DurationSeconds: input.DurationSeconds,
+		StartedAt:       startedAt,
+		UserID:          UID,
+		ChatID:          input.ChatID,
+	}
+
+	if err := config.DB.Create(&studyLog).Error; err != nil {
+		return customerrors.NewInternalServerError("Failed to save study log")
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"success": true,
+		"data": StudyLogResp{
+			Index:           studyLog.ID,
+			ChatID:          studyLog.ChatID,
+			Activity:        studyLog.Activity,
+			DurationSeconds: studyLog.DurationSeconds,
+			StartedAt:       studyLog.StartedAt.Format("2006-01-02 15:04:05"),
+		},
+		"message": "Study time logged successfully",
+	})
+}
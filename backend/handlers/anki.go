@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"strconv"
+
+	"github.com/MadMax168/Readsum/config"
+	"github.com/MadMax168/Readsum/customerrors"
+	"github.com/MadMax168/Readsum/models"
+	"github.com/MadMax168/Readsum/services"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+func ExportDeck(c *fiber.Ctx) error {
+	deck, err := ownedDeck(c)
+	if err != nil {
+		return err
+	}
+
+	var cxs []models.Card
+	if err := config.DB.Where("deck_id = ?", deck.ID).
+		Preload("Reviews", func(db *gorm.DB) *gorm.DB {
+			return db.Order("reviewed_at ASC")
+		}).
+		Order("id ASC").
+		Find(&cxs).Error; err != nil {
+		return customerrors.NewInternalServerError("Database error")
+	}
+
+	export := services.AnkiDeck{Name: deck.Title}
+	for _, card := range cxs {
+		ankiCard := services.AnkiCard{
+			Front:       card.Front,
+			Back:        card.Back,
+			IsNew:       card.LastReviewedAt == nil,
+			EaseFactor:  card.EaseFactor,
+			Interval:    card.Interval,
+			Repetitions: card.Repetitions,
+			DueAt:       card.DueAt,
+		}
+		if card.Kind == models.CardCloze {
+			ankiCard.ClozeText = card.ClozeText
+			ankiCard.ClozeIndex = card.ClozeIndex
+			ankiCard.NoteKey = card.NoteKey
+		}
+		for _, r := range card.Reviews {
+			ankiCard.Reviews = append(ankiCard.Reviews, services.AnkiReview{
+				Grade:      r.Grade,
+				Interval:   r.Interval,
+				EaseFactor: r.EaseFactor,
+				ReviewedAt: r.ReviewedAt,
+			})
+		}
+		export.Cards = append(export.Cards, ankiCard)
+	}
+
+	var buf bytes.Buffer
+	if err := services.ExportApkg(export, &buf); err != nil {
+		return customerrors.NewInternalServerError("Failed to export deck")
+	}
+
+	c.Set(fiber.HeaderContentType, "application/apkg")
+	setAttachment(c, deck.Title, "deck", "apkg")
+	return c.Status(200).Send(buf.Bytes())
+}
+
+// ImportDeck creates one deck per Anki deck found in the uploaded .apkg,
+// optionally attached to the chat_id form value
+func ImportDeck(c *fiber.Ctx) error {
+	UID, ok := c.Locals("userID").(uint)
+	if !ok || UID == 0 {
+		return customerrors.NewUnauthorizedError("Authentication required")
+	}
+
+	var chatID *uint
+	if raw := c.FormValue("chat_id"); raw != "" {
+		cid, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return customerrors.NewBadRequestError("Invalid chat ID format")
+		}
+
+		var chat models.Chat
+		if err := config.DB.Where("id = ? AND user_id = ?", cid, UID).First(&chat).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return customerrors.NewNotFoundError("Chat not found")
+			}
+			return customerrors.NewInternalServerError("Database error")
+		}
+		chatID = &chat.ID
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return customerrors.NewBadRequestError("An .apkg file is required")
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return customerrors.NewBadRequestError("Failed to read uploaded file")
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return customerrors.NewBadRequestError("Failed to read uploaded file")
+	}
+
+	imported, err := services.ImportApkg(data)
+	if err != nil {
+		var importErr *services.AnkiImportError
+		if errors.As(err, &importErr) {
+			return customerrors.NewBadRequestError(importErr.Message)
+		}
+		log.Printf("failed to import .apkg: %v", err)
+		return customerrors.NewInternalServerError("Failed to import deck")
+	}
+
+	var decks []models.Deck
+	for _, d := range imported {
+		deck := models.Deck{
+			Title:  d.Name,
+			UserID: UID,
+			ChatID: chatID,
+		}
+		for _, ac := range d.Cards {
+			card := models.Card{
+				Kind:        models.CardBasic,
+				Front:       ac.Front,
+				Back:        ac.Back,
+				EaseFactor:  ac.EaseFactor,
+				Interval:    ac.Interval,
+				Repetitions: ac.Repetitions,
+				DueAt:       ac.DueAt,
+			}
+			if ac.ClozeText != "" {
+				card.Kind = models.CardCloze
+				card.ClozeText = ac.ClozeText
+				card.ClozeIndex = ac.ClozeIndex
+				card.NoteKey = ac.NoteKey
+			}
+			for _, r := range ac.Reviews {
+				card.Reviews = append(card.Reviews, models.CardReview{
+					UserID:     UID,
+					Grade:      r.Grade,
+					EaseFactor: r.EaseFactor,
+					Interval:   r.Interval,
+					ReviewedAt: r.ReviewedAt,
+				})
+			}
+			if n := len(card.Reviews); n > 0 {
+				card.LastReviewedAt = &card.Reviews[n-1].ReviewedAt
+			}
+			deck.Cards = append(deck.Cards, card)
+		}
+		decks = append(decks, deck)
+	}
+
+	if len(decks) == 0 {
+		return customerrors.NewBadRequestError("The .apkg does not contain any cards")
+	}
+
+	if err := config.DB.Create(&decks).Error; err != nil {
+		return customerrors.NewInternalServerError("Failed to save imported decks")
+	}
+
+	var response []DeckResp
+	for _, d := range decks {
+		response = append(response, toDeckResp(d, false))
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"success": true,
+		"data":    response,
+		"message": "Decks imported successfully",
+	})
+}
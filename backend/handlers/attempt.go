@@ -0,0 +1,531 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MadMax168/Readsum/config"
+	"github.com/MadMax168/Readsum/customerrors"
+	"github.com/MadMax168/Readsum/models"
+	"github.com/MadMax168/Readsum/services"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type AnswerResp struct {
+	Index            uint                   `json:"index"`
+	QuestionID       uint                   `json:"question_id"`
+	Type             string                 `json:"type"`
+	Prompt           string                 `json:"prompt"`
+	SelectedOptionID *uint                  `json:"selected_option_id,omitempty"`
+	CorrectOptionID  *uint                  `json:"correct_option_id,omitempty"`
+	ResponseText     string                 `json:"response_text,omitempty"`
+	ExpectedAnswer   string                 `json:"expected_answer,omitempty"`
+	Rubric           models.Rubric          `json:"rubric,omitempty"`
+	IsCorrect        bool                   `json:"is_correct"`
+	Points           float64                `json:"points"`
+	MaxPoints        float64                `json:"max_points"`
+	GradingStatus    string                 `json:"grading_status"`
+	CriterionScores  models.CriterionScores `json:"criterion_scores,omitempty"`
+	Feedback         string                 `json:"feedback,omitempty"`
+	GradingRationale string                 `json:"grading_rationale,omitempty"`
+	OverrideNote     string                 `json:"override_note,omitempty"`
+	ModelPoints      *float64               `json:"model_points,omitempty"`
+	ModelIsCorrect   *bool                  `json:"model_is_correct,omitempty"`
+	Explanation      string                 `json:"explanation,omitempty"`
+	SourcePassage    string                 `json:"source_passage,omitempty"`
+	Verification     string                 `json:"verification"`
+	VerificationNote string                 `json:"verification_note,omitempty"`
+}
+
+type AttemptResp struct {
+	Index       uint         `json:"index"`
+	QuizID      uint         `json:"quiz_id"`
+	QuizTitle   string       `json:"quiz_title,omitempty"`
+	ChatID      uint         `json:"chat_id,omitempty"`
+	Score       float64      `json:"score"`
+	MaxScore    float64      `json:"max_score"`
+	Percentage  float64      `json:"percentage"`
+	SubmittedAt string       `json:"submitted_at"`
+	Answers     []AnswerResp `json:"answers,omitempty"`
+}
+
+func toAnswerResp(a models.Answer, q models.Question) AnswerResp {
+	answer := AnswerResp{
+		Index:            a.ID,
+		QuestionID:       q.ID,
+		Type:             q.Type,
+		Prompt:           q.Prompt,
+		SelectedOptionID: a.OptionID,
+		ResponseText:     a.ResponseText,
+		ExpectedAnswer:   q.ExpectedAnswer,
+		Rubric:           q.Rubric,
+		IsCorrect:        a.IsCorrect,
+		Points:           a.Points,
+		MaxPoints:        a.MaxPoints,
+		GradingStatus:    a.GradingStatus,
+		CriterionScores:  a.CriterionScores,
+		Feedback:         a.Feedback,
+		GradingRationale: a.GradingRationale,
+		OverrideNote:     a.OverrideNote,
+		ModelPoints:      a.ModelPoints,
+		ModelIsCorrect:   a.ModelIsCorrect,
+		Explanation:      q.Explanation,
+		SourcePassage:    q.SourcePassage,
+		Verification:     q.Verification,
+		VerificationNote: q.VerificationNote,
+	}
+	for _, o := range q.Options {
+		if o.IsCorrect {
+			id := o.ID
+			answer.CorrectOptionID = &id
+		}
+	}
+	return answer
+}
+
+// toAttemptResp reveals the correct answers, so it must only be used for submitted attempts
+func toAttemptResp(attempt models.QuizAttempt, quiz models.Quiz) AttemptResp {
+	resp := AttemptResp{
+		Index:       attempt.ID,
+		QuizID:      attempt.QuizID,
+		QuizTitle:   quiz.Title,
+		ChatID:      quiz.ChatID,
+		Score:       attempt.Score,
+		MaxScore:    attempt.MaxScore,
+		Percentage:  attempt.Percentage,
+		SubmittedAt: attempt.SubmittedAt.Format("2006-01-02 15:04:05"),
+	}
+
+	answers := make(map[uint]models.Answer)
+	for _, a := range attempt.Answers {
+		answers[a.QuestionID] = a
+	}
+
+	for _, q := range quiz.Questions {
+		if a, ok := answers[q.ID]; ok {
+			resp.Answers = append(resp.Answers, toAnswerResp(a, q))
+		}
+	}
+
+	return resp
+}
+
+// freeResponsePassRatio is the share of rubric points that counts a free-response answer as correct
+const freeResponsePassRatio = 0.6
+
+// gradeAnswer scores one question. Multiple choice is checked against the stored
+// options; short answers and essays are graded by the model against the rubric.
+// A failed model call is recorded on the answer so a teacher can grade it by hand.
+func (h *Handler) gradeAnswer(q models.Question, optionID *uint, text string) (models.Answer, error) {
+	answer := models.Answer{
+		QuestionID:    q.ID,
+		GradingStatus: models.GradingGraded,
+	}
+
+	if q.Type == models.QuestionShortAnswer || q.Type == models.QuestionEssay {
+		answer.ResponseText = strings.TrimSpace(text)
+		answer.MaxPoints = q.Rubric.MaxPoints()
+		if answer.ResponseText == "" {
+			answer.Feedback = "No answer given"
+			return answer, nil
+		}
+
+		var rubric []services.GeneratedCriterion
+		for _, c := range q.Rubric {
+			rubric = append(rubric, services.GeneratedCriterion{
+				Name:        c.Name,
+				Description: c.Description,
+				MaxPoints:   c.MaxPoints,
+			})
+		}
+
+		grade, err := h.AI.GradeFreeResponse(q.Prompt, q.ExpectedAnswer, rubric, answer.ResponseText)
+		if err != nil {
+			answer.GradingStatus = models.GradingFailed
+			answer.Feedback = "Automatic grading failed; this answer is waiting for a teacher"
+			return answer, nil
+		}
+
+		for i, g := range grade.Criteria {
+			answer.CriterionScores = append(answer.CriterionScores, models.CriterionScore{
+				Name:      g.Name,
+				Points:    g.Points,
+				MaxPoints: q.Rubric[i].MaxPoints,
+				Feedback:  g.Feedback,
+			})
+			answer.Points += g.Points
+		}
+		answer.Feedback = grade.Feedback
+		answer.GradingRationale = grade.Rationale
+		answer.IsCorrect = answer.MaxPoints > 0 && answer.Points >= answer.MaxPoints*freeResponsePassRatio
+		return answer, nil
+	}
+
+	answer.OptionID = optionID
+	answer.MaxPoints = 1
+	if optionID != nil {
+		found := false
+		for _, o := range q.Options {
+			if o.ID == *optionID {
+				found = true
+				answer.IsCorrect = o.IsCorrect
+			}
+		}
+		if !found {
+			return answer, customerrors.NewBadRequestError("Option does not belong to the question")
+		}
+	}
+	if answer.IsCorrect {
+		answer.Points = 1
+	}
+
+	return answer, nil
+}
+
+// scoreAttempt totals the answers of an attempt
+func scoreAttempt(attempt *models.QuizAttempt) {
+	attempt.Score, attempt.MaxScore, attempt.Percentage = 0, 0, 0
+	for _, a := range attempt.Answers {
+		attempt.Score += a.Points
+		attempt.MaxScore += a.MaxPoints
+	}
+	if attempt.MaxScore > 0 {
+		attempt.Percentage = math.Round(attempt.Score/attempt.MaxScore*10000) / 100
+	}
+}
+
+type SubmittedAnswer struct {
+	QuestionID uint   `json:"question_id"`
+	OptionID   *uint  `json:"option_id"`
+	Text       string `json:"text"`
+}
+
+type SubmitAttemptInput struct {
+	Answers []SubmittedAnswer `json:"answers"`
+}
+
+func (h *Handler) SubmitAttempt(c *fiber.Ctx) error {
+	chat, err := ownedChat(c)
+	if err != nil {
+		return err
+	}
+
+	quiz, err := loadQuiz(chat.ID, c.Params("quizID"))
+	if err != nil {
+		return err
+	}
+
+	var input SubmitAttemptInput
+	if err := c.BodyParser(&input); err != nil {
+		return customerrors.NewBadRequestError("Invalid request body")
+	}
+
+	submitted := make(map[uint]SubmittedAnswer)
+	for _, a := range input.Answers {
+		if _, dup := submitted[a.QuestionID]; dup {
+			return customerrors.NewBadRequestError("Each question can only be answered once")
+		}
+		submitted[a.QuestionID] = a
+	}
+
+	attempt := models.QuizAttempt{
+		QuizID: quiz.ID,
+		UserID: chat.UserID,
+	}
+
+	// Grade every question of the quiz; unanswered questions score zero
+	for _, q := range quiz.Questions {
+		sub := submitted[q.ID]
+		delete(submitted, q.ID)
+
+		answer, err := h.gradeAnswer(q, sub.OptionID, sub.Text)
+		if err != nil {
+			return err
+		}
+		attempt.Answers = append(attempt.Answers, answer)
+	}
+
+	if len(submitted) > 0 {
+		return customerrors.NewBadRequestError("Answer refers to a question outside this quiz")
+	}
+
+	scoreAttempt(&attempt)
+
+	if err := config.DB.Create(&attempt).Error; err != nil {
+		return customerrors.NewInternalServerError("Failed to save attempt")
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"success": true,
+		"data":    toAttemptResp(attempt, quiz),
+		"message": "Attempt graded successfully",
+	})
+}
+
+type CriterionOverride struct {
+	Name   string  `json:"name"`
+	Points float64 `json:"points"`
+}
+
+type OverrideAnswerInput struct {
+	Points          *float64            `json:"points"`
+	CriterionScores []CriterionOverride `json:"criterion_scores"`
+	Feedback        *string             `json:"feedback"`
+	Note            string              `json:"note"`
+}
+
+// reviewedChat loads the chat from the chatID parameter for a user with the
+// reviewer role, who may review the answers of any user
+func reviewedChat(c *fiber.Ctx) (models.Chat, models.User, error) {
+	var chat models.Chat
+	var reviewer models.User
+
+	UID, ok := c.Locals("userID").(uint)
+	if !ok || UID == 0 {
+		return chat, reviewer, customerrors.NewUnauthorizedError("Authentication required")
+	}
+
+	CID, ok := c.Locals("chatID").(uint)
+	if !ok || CID == 0 {
+		return chat, reviewer, customerrors.NewBadRequestError("Invalid chat ID")
+	}
+
+	if err := config.DB.First(&reviewer, UID).Error; err != nil {
+		return chat, reviewer, customerrors.NewUnauthorizedError("Authentication required")
+	}
+	if reviewer.Role != models.RoleReviewer {
+		return chat, reviewer, customerrors.NewForbiddenError("Only reviewers can override grades")
+	}
+
+	if err := config.DB.First(&chat, CID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return chat, reviewer, customerrors.NewNotFoundError("Chat not found")
+		}
+		return chat, reviewer, customerrors.NewInternalServerError("Database error")
+	}
+
+	return chat, reviewer, nil
+}
+
+// OverrideAnswer lets a reviewer replace the grade of one answer after reviewing
+// the model's rationale; the attempt's totals are recalculated. The model's
+// grade is kept, and the reviewer is recorded.
+func OverrideAnswer(c *fiber.Ctx) error {
+	chat, reviewer, err := reviewedChat(c)
+	if err != nil {
+		return err
+	}
+
+	quiz, err := loadQuiz(chat.ID, c.Params("quizID"))
+	if err != nil {
+		return err
+	}
+
+	var input OverrideAnswerInput
+	if err := c.BodyParser(&input); err != nil {
+		return customerrors.NewBadRequestError("Invalid request body")
+	}
+	if input.Points == nil && len(input.CriterionScores) == 0 {
+		return customerrors.NewBadRequestError("Points or criterion scores are required")
+	}
+
+	var attempt models.QuizAttempt
+	if err := config.DB.Where("id = ? AND quiz_id = ?", c.Params("attemptID"), quiz.ID).
+		Preload("Answers").
+		First(&attempt).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return customerrors.NewNotFoundError("Attempt not found")
+		}
+		return customerrors.NewInternalServerError("Database error")
+	}
+
+	answerID, err := strconv.ParseUint(c.Params("answerID"), 10, 64)
+	if err != nil {
+		return customerrors.NewBadRequestError("Invalid answer ID format")
+	}
+
+	idx := -1
+	for i, a := range attempt.Answers {
+		if a.ID == uint(answerID) {
+			idx = i
+		}
+	}
+	if idx < 0 {
+		return customerrors.NewNotFoundError("Answer not found")
+	}
+	answer := &attempt.Answers[idx]
+
+	// The first override keeps the model's grade; later ones leave it alone
+	if answer.OverriddenAt == nil {
+		points, correct := answer.Points, answer.IsCorrect
+		answer.ModelPoints = &points
+		answer.ModelIsCorrect = &correct
+		answer.ModelCriterionScores = append(models.CriterionScores(nil), answer.CriterionScores...)
+	}
+
+	var question models.Question
+	for _, q := range quiz.Questions {
+		if q.ID == answer.QuestionID {
+			question = q
+		}
+	}
+
+	if len(input.CriterionScores) > 0 {
+		if len(question.Rubric) == 0 {
+			return customerrors.NewBadRequestError("This question has no rubric")
+		}
+
+		overrides := make(map[string]float64)
+		for _, o := range input.CriterionScores {
+			overrides[strings.ToLower(strings.TrimSpace(o.Name))] = o.Points
+		}
+
+		scores := make(models.CriterionScores, 0, len(question.Rubric))
+		answer.Points = 0
+		for i, criterion := range question.Rubric {
+			score := models.CriterionScore{Name: criterion.Name, MaxPoints: criterion.MaxPoints}
+			if i < len(answer.CriterionScores) {
+				score = answer.CriterionScores[i]
+			}
+			if p, ok := overrides[strings.ToLower(criterion.Name)]; ok {
+				score.Points = p
+			}
+			score.Points = math.Max(0, math.Min(score.Points, criterion.MaxPoints))
+			answer.Points += score.Points
+			scores = append(scores, score)
+		}
+		answer.CriterionScores = scores
+	} else {
+		answer.Points = math.Max(0, math.Min(*input.Points, answer.MaxPoints))
+	}
+
+	if question.Type == models.QuestionShortAnswer || question.Type == models.QuestionEssay {
+		answer.IsCorrect = answer.MaxPoints > 0 && answer.Points >= answer.MaxPoints*freeResponsePassRatio
+	} else {
+		answer.IsCorrect = answer.Points >= answer.MaxPoints
+	}
+	if input.Feedback != nil {
+		answer.Feedback = strings.TrimSpace(*input.Feedback)
+	}
+
+	now := time.Now()
+	answer.GradingStatus = models.GradingOverridden
+	answer.OverrideNote = strings.TrimSpace(input.Note)
+	answer.OverriddenAt = &now
+	answer.OverriddenByID = &reviewer.ID
+
+	scoreAttempt(&attempt)
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(answer).Select(
+			"points", "is_correct", "criterion_scores", "feedback",
+			"grading_status", "override_note", "overridden_at", "overridden_by_id",
+			"model_points", "model_is_correct", "model_criterion_scores",
+		).Updates(answer).Error; err != nil {
+			return err
+		}
+		return tx.Model(&attempt).Select("score", "max_score", "percentage").Updates(&attempt).Error
+	})
+	if err != nil {
+		return customerrors.NewInternalServerError("Failed to save override")
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"success": true,
+		"data":    toAttemptResp(attempt, quiz),
+		"message": "Answer grade overridden successfully",
+	})
+}
+
+// GetQuizAttempts lists the score history of a quiz, oldest first
+func GetQuizAttempts(c *fiber.Ctx) error {
+	chat, err := ownedChat(c)
+	if err != nil {
+		return err
+	}
+
+	var quiz models.Quiz
+	if err := config.DB.Where("id = ? AND chat_id = ?", c.Params("quizID"), chat.ID).First(&quiz).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return customerrors.NewNotFoundError("Quiz not found")
+		}
+		return customerrors.NewInternalServerError("Database error")
+	}
+
+	var axs []models.QuizAttempt
+	if err := config.DB.Where("quiz_id = ? AND user_id = ?", quiz.ID, chat.UserID).
+		Order("submitted_at ASC").
+		Find(&axs).Error; err != nil {
+		return customerrors.NewInternalServerError("Database error")
+	}
+
+	var response []AttemptResp
+	for _, a := range axs {
+		response = append(response, toAttemptResp(a, quiz))
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"success": true,
+		"data":    response,
+		"message": "Attempts retrieved successfully",
+	})
+}
+
+func GetQuizAttempt(c *fiber.Ctx) error {
+	chat, err := ownedChat(c)
+	if err != nil {
+		return err
+	}
+
+	quiz, err := loadQuiz(chat.ID, c.Params("quizID"))
+	if err != nil {
+		return err
+	}
+
+	var attempt models.QuizAttempt
+	if err := config.DB.Where("id = ? AND quiz_id = ? AND user_id = ?", c.Params("attemptID"), quiz.ID, chat.UserID).
+		Preload("Answers").
+		First(&attempt).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return customerrors.NewNotFoundError("Attempt not found")
+		}
+		return customerrors.NewInternalServerError("Database error")
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"success": true,
+		"data":    toAttemptResp(attempt, quiz),
+		"message": "Attempt retrieved successfully",
+	})
+}
+
+// GetUserAttempts lists every attempt of the current user across quizzes, oldest first
+func GetUserAttempts(c *fiber.Ctx) error {
+	UID, ok := c.Locals("userID").(uint)
+	if !ok || UID == 0 {
+		return customerrors.NewUnauthorizedError("Authentication required")
+	}
+
+	var axs []models.QuizAttempt
+	if err := config.DB.Where("user_id = ?", UID).
+		Preload("Quiz").
+		Order("submitted_at ASC").
+		Find(&axs).Error; err != nil {
+		return customerrors.NewInternalServerError("Database error")
+	}
+
+	var response []AttemptResp
+	for _, a := range axs {
+		response = append(response, toAttemptResp(a, a.Quiz))
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"success": true,
+		"data":    response,
+		"message": "Attempts retrieved successfully",
+	})
+}
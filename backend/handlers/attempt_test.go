@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/MadMax168/Readsum/config"
+	"github.com/MadMax168/Readsum/llm"
+	"github.com/MadMax168/Readsum/models"
+	"github.com/MadMax168/Readsum/services"
+)
+
+func TestGradeAnswerMultipleChoice(t *testing.T) {
+	fake := llm.NewFake()
+	h := New(services.NewAI(fake))
+
+	q := models.Question{
+		Type:   models.QuestionMultipleChoice,
+		Prompt: "Where do plants make their food?",
+		Options: []models.Option{
+			{Text: "In the leaves", IsCorrect: true},
+			{Text: "In the roots"},
+		},
+	}
+	q.Options[0].ID = 1
+	q.Options[1].ID = 2
+
+	right, wrong, foreign := uint(1), uint(2), uint(3)
+	if answer, err := h.gradeAnswer(q, &right, ""); err != nil || !answer.IsCorrect || answer.Points != 1 {
+		t.Errorf("correct option: points %v, correct %v, err %v", answer.Points, answer.IsCorrect, err)
+	}
+	if answer, err := h.gradeAnswer(q, &wrong, ""); err != nil || answer.IsCorrect || answer.Points != 0 {
+		t.Errorf("wrong option: points %v, correct %v, err %v", answer.Points, answer.IsCorrect, err)
+	}
+	if answer, err := h.gradeAnswer(q, nil, ""); err != nil || answer.Points != 0 || answer.MaxPoints != 1 {
+		t.Errorf("unanswered: scored %v of %v, err %v", answer.Points, answer.MaxPoints, err)
+	}
+	if _, err := h.gradeAnswer(q, &foreign, ""); err == nil {
+		t.Error("an option of another question was accepted")
+	}
+	if len(fake.Requests) != 0 {
+		t.Errorf("made %d model calls for multiple choice", len(fake.Requests))
+	}
+}
+
+func TestScoreAttempt(t *testing.T) {
+	tests := []struct {
+		points, max []float64
+		score       float64
+		maxScore    float64
+		percentage  float64
+	}{
+		{nil, nil, 0, 0, 0},
+		{[]float64{1, 0, 1}, []float64{1, 1, 1}, 2, 3, 66.67},
+		{[]float64{2.5, 1}, []float64{3, 1}, 3.5, 4, 87.5},
+		{[]float64{0}, []float64{0}, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		attempt := models.QuizAttempt{Score: 9, Percentage: 9}
+		for i := range tt.points {
+			attempt.Answers = append(attempt.Answers, models.Answer{Points: tt.points[i], MaxPoints: tt.max[i]})
+		}
+		scoreAttempt(&attempt)
+		if attempt.Score != tt.score || attempt.MaxScore != tt.maxScore || attempt.Percentage != tt.percentage {
+			t.Errorf("points %v of %v: scored %v of %v (%v%%), want %v of %v (%v%%)", tt.points, tt.max,
+				attempt.Score, attempt.MaxScore, attempt.Percentage, tt.score, tt.maxScore, tt.percentage)
+		}
+	}
+}
+
+func TestSubmitAttempt(t *testing.T) {
+	chat := testChat(t, models.ChatModeStandard)
+	quiz := models.Quiz{Title: "Plants", UserID: chat.UserID, ChatID: chat.ID, Questions: []models.Question{
+		{Type: models.QuestionMultipleChoice, Prompt: "Where do plants make their food?", Position: 1, Options: []models.Option{
+			{Text: "In the roots", Position: 1}, {Text: "In the leaves", IsCorrect: true, Position: 2},
+		}},
+		{Type: models.QuestionMultipleChoice, Prompt: "Which gas do plants release?", Position: 2, Options: []models.Option{
+			{Text: "Oxygen", IsCorrect: true, Position: 1}, {Text: "Carbon dioxide", Position: 2},
+		}},
+	}}
+	if err := config.DB.Create(&quiz).Error; err != nil {
+		t.Fatal(err)
+	}
+	fake := llm.NewFake()
+	app := testApp(New(services.NewAI(fake)))
+
+	// The first question right, the second wrong
+	first, second := quiz.Questions[0], quiz.Questions[1]
+	answers := []SubmittedAnswer{
+		{QuestionID: first.ID, OptionID: &first.Options[1].ID},
+		{QuestionID: second.ID, OptionID: &second.Options[1].ID},
+	}
+	resp := send(t, app, chat, "POST", fmt.Sprintf("/quizzes/%d/attempts", quiz.ID), SubmitAttemptInput{Answers: answers})
+	if resp.StatusCode != 201 {
+		t.Fatalf("status %d, want 201", resp.StatusCode)
+	}
+	var attempt AttemptResp
+	decode(t, resp, &attempt)
+	if attempt.Score != 1 || attempt.MaxScore != 2 || attempt.Percentage != 50 {
+		t.Errorf("scored %v of %v (%v%%), want 1 of 2", attempt.Score, attempt.MaxScore, attempt.Percentage)
+	}
+	if len(attempt.Answers) != 2 || attempt.Answers[1].IsCorrect || attempt.Answers[1].CorrectOptionID == nil ||
+		*attempt.Answers[1].CorrectOptionID != second.Options[0].ID {
+		t.Errorf("answers = %+v, want the second marked wrong with the correct option shown", attempt.Answers)
+	}
+
+	var saved models.QuizAttempt
+	if err := config.DB.Preload("Answers").First(&saved, attempt.Index).Error; err != nil {
+		t.Fatal(err)
+	}
+	if saved.Score != 1 || len(saved.Answers) != 2 {
+		t.Errorf("saved attempt scored %v with %d answers", saved.Score, len(saved.Answers))
+	}
+	if len(fake.Requests) != 0 {
+		t.Errorf("made %d model calls, want none: multiple choice is graded without the model", len(fake.Requests))
+	}
+}
+
+func TestSubmitAttemptRejectsForeignQuestion(t *testing.T) {
+	chat := testChat(t, models.ChatModeStandard)
+	quiz := models.Quiz{Title: "Plants", UserID: chat.UserID, ChatID: chat.ID, Questions: []models.Question{
+		{Type: models.QuestionMultipleChoice, Prompt: "Where do plants make their food?", Position: 1, Options: []models.Option{
+			{Text: "In the roots", Position: 1}, {Text: "In the leaves", IsCorrect: true, Position: 2},
+		}},
+	}}
+	if err := config.DB.Create(&quiz).Error; err != nil {
+		t.Fatal(err)
+	}
+	app := testApp(New(services.NewAI(llm.NewFake())))
+
+	resp := send(t, app, chat, "POST", fmt.Sprintf("/quizzes/%d/attempts", quiz.ID), SubmitAttemptInput{
+		Answers: []SubmittedAnswer{{QuestionID: quiz.Questions[0].ID + 1000}},
+	})
+	resp.Body.Close()
+	if resp.StatusCode == 201 {
+		t.Error("an answer to a question outside the quiz was accepted")
+	}
+
+	var count int64
+	config.DB.Model(&models.QuizAttempt{}).Where("quiz_id = ?", quiz.ID).Count(&count)
+	if count != 0 {
+		t.Errorf("saved %d attempts, want none", count)
+	}
+}
+
+func shortAnswerQuestion() models.Question {
+	return models.Question{
+		Type:           models.QuestionShortAnswer,
+		Prompt:         "How do plants make food?",
+		ExpectedAnswer: "By photosynthesis, using sunlight",
+		Rubric: models.Rubric{
+			{Name: "Process", Description: "Names photosynthesis", MaxPoints: 2},
+			{Name: "Light", Description: "Mentions sunlight", MaxPoints: 1},
+		},
+	}
+}
+
+func TestGradeAnswerFreeResponse(t *testing.T) {
+	fake := llm.NewFake(`{
+		"criteria": [
+			{"name": "Process", "points": 2, "feedback": "Correct"},
+			{"name": "Light", "points": 0.5, "feedback": "Only hinted at"}
+		],
+		"feedback": "Nearly there",
+		"rationale": "Names the process, light is vague"
+	}`)
+	h := New(services.NewAI(fake))
+
+	answer, err := h.gradeAnswer(shortAnswerQuestion(), nil, " Photosynthesis in the sun ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer.GradingStatus != models.GradingGraded {
+		t.Errorf("grading status = %q, want %q", answer.GradingStatus, models.GradingGraded)
+	}
+	if answer.ResponseText != "Photosynthesis in the sun" {
+		t.Errorf("response = %q, want it trimmed", answer.ResponseText)
+	}
+	if answer.Points != 2.5 || answer.MaxPoints != 3 {
+		t.Errorf("scored %v of %v, want 2.5 of 3", answer.Points, answer.MaxPoints)
+	}
+	if !answer.IsCorrect {
+		t.Error("answer scoring above the pass ratio is not marked correct")
+	}
+	if len(answer.CriterionScores) != 2 || answer.CriterionScores[1].MaxPoints != 1 {
+		t.Errorf("criterion scores = %+v, want one per rubric criterion", answer.CriterionScores)
+	}
+	if answer.Feedback != "Nearly there" || answer.GradingRationale != "Names the process, light is vague" {
+		t.Errorf("feedback %q, rationale %q", answer.Feedback, answer.GradingRationale)
+	}
+}
+
+func TestGradeAnswerModelFailure(t *testing.T) {
+	fake := llm.NewFake("not json")
+	h := New(services.NewAI(fake))
+
+	answer, err := h.gradeAnswer(shortAnswerQuestion(), nil, "Photosynthesis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer.GradingStatus != models.GradingFailed {
+		t.Errorf("grading status = %q, want %q", answer.GradingStatus, models.GradingFailed)
+	}
+	if answer.Points != 0 || answer.IsCorrect {
+		t.Errorf("failed grading scored %v points", answer.Points)
+	}
+}
+
+func TestGradeAnswerBlankSkipsModel(t *testing.T) {
+	fake := llm.NewFake()
+	h := New(services.NewAI(fake))
+
+	answer, err := h.gradeAnswer(shortAnswerQuestion(), nil, "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.Requests) != 0 {
+		t.Errorf("made %d model calls for a blank answer", len(fake.Requests))
+	}
+	if answer.Points != 0 || answer.MaxPoints != 3 {
+		t.Errorf("scored %v of %v, want 0 of 3", answer.Points, answer.MaxPoints)
+	}
+}
+
+func TestOverrideAnswerRequiresReviewer(t *testing.T) {
+	chat := testChat(t, models.ChatModeStandard)
+	q := shortAnswerQuestion()
+	q.Position = 1
+	quiz := models.Quiz{Title: "Plants", UserID: chat.UserID, ChatID: chat.ID, Questions: []models.Question{q}}
+	if err := config.DB.Create(&quiz).Error; err != nil {
+		t.Fatal(err)
+	}
+	fake := llm.NewFake(`{"criteria": [{"name": "Process", "points": 1, "feedback": "Vague"}, {"name": "Light", "points": 0, "feedback": "Missing"}],
+		"feedback": "Keep going", "rationale": "Only hints at the process"}`)
+	app := testApp(New(services.NewAI(fake)))
+
+	resp := send(t, app, chat, "POST", fmt.Sprintf("/quizzes/%d/attempts", quiz.ID), SubmitAttemptInput{
+		Answers: []SubmittedAnswer{{QuestionID: quiz.Questions[0].ID, Text: "Plants use the sun"}},
+	})
+	var attempt AttemptResp
+	decode(t, resp, &attempt)
+	path := fmt.Sprintf("/quizzes/%d/attempts/%d/answers/%d", quiz.ID, attempt.Index, attempt.Answers[0].Index)
+	points := 3.0
+
+	// The student who took the quiz may not regrade it
+	resp = send(t, app, chat, "PATCH", path, OverrideAnswerInput{Points: &points})
+	resp.Body.Close()
+	if resp.StatusCode == 200 {
+		t.Fatal("a student overrode their own grade")
+	}
+
+	reviewer := models.User{Name: "Teacher", Email: fmt.Sprintf("teacher-%d@example.com", chat.ID), PasswordHash: "-", Role: models.RoleReviewer}
+	if err := config.DB.Create(&reviewer).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		config.DB.Unscoped().Delete(&reviewer)
+	})
+
+	resp = sendAs(t, app, reviewer.ID, chat, "PATCH", path, OverrideAnswerInput{Points: &points, Note: "Accepted"})
+	if resp.StatusCode != 200 {
+		t.Fatalf("reviewer override: status %d, want 200", resp.StatusCode)
+	}
+	resp.Body.Close()
+
+	var answer models.Answer
+	config.DB.First(&answer, attempt.Answers[0].Index)
+	if answer.GradingStatus != models.GradingOverridden || answer.Points != 3 || !answer.IsCorrect {
+		t.Errorf("answer is %s with %v points, want overridden to 3", answer.GradingStatus, answer.Points)
+	}
+	if answer.ModelPoints == nil || *answer.ModelPoints != 1 {
+		t.Errorf("model points = %v, want the model's 1 kept", answer.ModelPoints)
+	}
+	if answer.OverriddenByID == nil || *answer.OverriddenByID != reviewer.ID {
+		t.Errorf("overridden by %v, want the reviewer %d", answer.OverriddenByID, reviewer.ID)
+	}
+}
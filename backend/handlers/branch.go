@@ -0,0 +1,420 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/MadMax168/Readsum/config"
+	"github.com/MadMax168/Readsum/customerrors"
+	"github.com/MadMax168/Readsum/llm"
+	"github.com/MadMax168/Readsum/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// A chat's messages form a tree: each message follows its parent, and messages
+// sharing a parent are alternative branches, created by regenerating a reply or
+// editing a user message. The chat shows the path from the root to its leaf.
+
+// setLeaf points the chat at leafID. With onlyFrom set, the leaf only moves if
+// the chat still shows that message, so a reply finishing after the user has
+// switched branches does not switch them back. A move is published as a
+// branch.switched event.
+func setLeaf(tx *gorm.DB, chatID uint, leafID uint, onlyFrom *uint) error {
+	query := tx.Model(&models.Chat{}).Where("id = ?", chatID)
+	if onlyFrom != nil {
+		query = query.Where("leaf_message_id = ?", *onlyFrom)
+	}
+	result := query.Update("leaf_message_id", leafID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		publish(tx, chatID, "branch.switched", fiber.Map{"leaf_message_id": leafID})
+	}
+	return nil
+}
+
+// appendMessage saves message at the end of the chat's current branch
+func appendMessage(message *models.Message) error {
+	return transaction(func(tx *gorm.DB) error {
+		var chat models.Chat
+		// Locking the chat keeps concurrent messages from becoming siblings
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&chat, message.ChatID).Error; err != nil {
+			return err
+		}
+
+		message.ParentID = chat.LeafMessageID
+		if err := tx.Create(message).Error; err != nil {
+			return err
+		}
+		return setLeaf(tx, chat.ID, message.ID, nil)
+	})
+}
+
+// replyTo saves reply as the answer to parent. The chat moves on to the reply
+// if it still shows parent, or always when switchBranch is set.
+func replyTo(parent models.Message, reply *models.Message, switchBranch bool) error {
+	return transaction(func(tx *gorm.DB) error {
+		reply.ParentID = &parent.ID
+		if err := tx.Create(reply).Error; err != nil {
+			return err
+		}
+		if switchBranch {
+			return setLeaf(tx, reply.ChatID, reply.ID, nil)
+		}
+		return setLeaf(tx, reply.ChatID, reply.ID, &parent.ID)
+	})
+}
+
+// messagePath returns the messages from the start of the conversation to leafID
+func messagePath(leafID uint) ([]models.Message, error) {
+	var mxs []models.Message
+	if err := config.DB.Raw(`WITH RECURSIVE branch AS (
+		SELECT messages.*, 0 AS depth FROM messages WHERE id = ? AND deleted_at IS NULL
+		UNION ALL
+		SELECT m.*, b.depth + 1 FROM messages m JOIN branch b ON m.id = b.parent_id WHERE m.deleted_at IS NULL
+	) SELECT * FROM branch ORDER BY depth DESC`, leafID).Scan(&mxs).Error; err != nil {
+		return nil, err
+	}
+	return mxs, nil
+}
+
+// markStale flags every message below message, in all of its branches, and
+// publishes their IDs as a message.stale event
+func markStale(tx *gorm.DB, message models.Message) error {
+	var ids []uint
+	if err := tx.Raw(`WITH RECURSIVE below AS (
+		SELECT id FROM messages WHERE parent_id = ? AND deleted_at IS NULL
+		UNION ALL
+		SELECT m.id FROM messages m JOIN below b ON m.parent_id = b.id WHERE m.deleted_at IS NULL
+	) SELECT id FROM below`, message.ID).Scan(&ids).Error; err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := tx.Model(&models.Message{}).Where("id IN ?", ids).Update("stale", true).Error; err != nil {
+		return err
+	}
+	publish(tx, message.ChatID, "message.stale", fiber.Map{"indexes": ids})
+	return nil
+}
+
+// activeBranch returns the messages the chat currently shows, oldest first
+func activeBranch(chatID uint) ([]models.Message, error) {
+	var chat models.Chat
+	if err := config.DB.Select("id", "leaf_message_id").First(&chat, chatID).Error; err != nil {
+		return nil, err
+	}
+	if chat.LeafMessageID == nil {
+		return nil, nil
+	}
+	return messagePath(*chat.LeafMessageID)
+}
+
+// toHistory turns messages into conversation turns for the model. Stale
+// messages answered an earlier version of the conversation and are left out.
+func toHistory(mxs []models.Message) []llm.Message {
+	var history []llm.Message
+	for _, m := range mxs {
+		if m.Stale {
+			continue
+		}
+		role := llm.RoleUser
+		if m.Role == "assistant" {
+			role = llm.RoleAssistant
+		}
+		history = append(history, llm.Message{Role: role, Text: m.Text})
+	}
+	return history
+}
+
+// answerMessage generates the assistant's reply to message from the branch
+// leading up to it and saves it as a child of message
+func (h *Handler) answerMessage(chat models.Chat, message models.Message, switchBranch bool) (*models.Message, error) {
+	system, history, err := replyContext(chat, message)
+	if err != nil {
+		return nil, customerrors.NewInternalServerError("Database error")
+	}
+
+	text, err := h.AI.GenerateReply(chatModelSettings(chat), system, history)
+	if err != nil {
+		return nil, customerrors.NewInternalServerError("Failed to generate reply")
+	}
+
+	reply := models.Message{
+		Text:   text,
+		Role:   "assistant",
+		ChatID: message.ChatID,
+	}
+	if err := replyTo(message, &reply, switchBranch); err != nil {
+		return nil, customerrors.NewInternalServerError("Failed to save reply")
+	}
+	go h.afterReply(message.ChatID)
+
+	return &reply, nil
+}
+
+// branchResps adds to each message of a branch the branches it could switch to:
+// its siblings, in the order they were written. Only the children of the
+// messages' parents are loaded, not the whole tree.
+func branchResps(chatID uint, mxs []models.Message) ([]TextResp, error) {
+	if len(mxs) == 0 {
+		return nil, nil
+	}
+
+	parents := []uint{}
+	roots := false
+	for _, m := range mxs {
+		if m.ParentID != nil {
+			parents = append(parents, *m.ParentID)
+		} else {
+			roots = true
+		}
+	}
+	siblingsOf := config.DB.Where("parent_id IN ?", parents)
+	if roots {
+		siblingsOf = siblingsOf.Or("parent_id IS NULL")
+	}
+
+	var nodes []models.Message
+	if err := config.DB.Select("id", "parent_id").
+		Where("chat_id = ?", chatID).
+		Where(siblingsOf).
+		Order("created_at ASC, id ASC").
+		Find(&nodes).Error; err != nil {
+		return nil, err
+	}
+
+	children := make(map[uint][]uint)
+	for _, n := range nodes {
+		var parent uint
+		if n.ParentID != nil {
+			parent = *n.ParentID
+		}
+		children[parent] = append(children[parent], n.ID)
+	}
+
+	var response []TextResp
+	for _, m := range mxs {
+		resp := toTextResp(m)
+
+		var parent uint
+		if m.ParentID != nil {
+			parent = *m.ParentID
+		}
+		siblings := children[parent]
+		resp.SiblingCount = len(siblings)
+		for i, id := range siblings {
+			if id == m.ID {
+				resp.SiblingIndex = i + 1
+			}
+		}
+		if len(siblings) > 1 {
+			resp.Siblings = siblings
+		}
+
+		response = append(response, resp)
+	}
+	return response, nil
+}
+
+// chatMessage loads the messageID parameter of the current chat
+func chatMessage(c *fiber.Ctx, chatID uint) (models.Message, error) {
+	var message models.Message
+	if err := config.DB.Where("id = ? AND chat_id = ?", c.Params("messageID"), chatID).First(&message).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return message, customerrors.NewNotFoundError("Message not found")
+		}
+		return message, customerrors.NewInternalServerError("Database error")
+	}
+	return message, nil
+}
+
+// Tutor replies also advance the session's steps, so they cannot be replayed
+func branchableChat(c *fiber.Ctx) (models.Chat, error) {
+	chat, err := ownedChat(c)
+	if err != nil {
+		return chat, err
+	}
+	if chat.Mode == models.ChatModeTutor {
+		return chat, customerrors.NewBadRequestError("Branching is not available in tutor mode")
+	}
+	return chat, nil
+}
+
+// RegenerateMessage answers the user's message again. The new reply becomes a
+// sibling of the given assistant message and the chat switches to it.
+func (h *Handler) RegenerateMessage(c *fiber.Ctx) error {
+	chat, err := branchableChat(c)
+	if err != nil {
+		return err
+	}
+
+	message, err := chatMessage(c, chat.ID)
+	if err != nil {
+		return err
+	}
+	if message.Role != "assistant" {
+		return customerrors.NewBadRequestError("Only assistant messages can be regenerated")
+	}
+	if message.ParentID == nil {
+		return customerrors.NewBadRequestError("Message does not answer another message")
+	}
+
+	var parent models.Message
+	if err := config.DB.Where("id = ? AND chat_id = ?", *message.ParentID, chat.ID).First(&parent).Error; err != nil {
+		return customerrors.NewNotFoundError("Message not found")
+	}
+
+	reply, err := h.answerMessage(chat, parent, true)
+	if err != nil {
+		return err
+	}
+
+	resps, err := branchResps(chat.ID, []models.Message{*reply})
+	if err != nil {
+		return customerrors.NewInternalServerError("Database error")
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"success": true,
+		"data":    resps[0],
+		"message": "Reply regenerated successfully",
+	})
+}
+
+type BranchMessageInput struct {
+	Text string `json:"text"`
+}
+
+// BranchMessage asks a user message again with new text. The edited message
+// becomes a sibling of the original, the chat switches to it and it is answered;
+// the original and everything after it stay reachable as the other branch.
+func (h *Handler) BranchMessage(c *fiber.Ctx) error {
+	chat, err := branchableChat(c)
+	if err != nil {
+		return err
+	}
+
+	var input BranchMessageInput
+	if err := c.BodyParser(&input); err != nil {
+		return customerrors.NewBadRequestError("Invalid request body")
+	}
+
+	input.Text = strings.TrimSpace(input.Text)
+	if input.Text == "" {
+		return customerrors.NewBadRequestError("Message text cannot be empty")
+	}
+
+	original, err := chatMessage(c, chat.ID)
+	if err != nil {
+		return err
+	}
+	if original.Role != "user" {
+		return customerrors.NewBadRequestError("Only user messages can be edited")
+	}
+
+	message := models.Message{
+		Text:     input.Text,
+		Role:     "user",
+		ParentID: original.ParentID,
+		ChatID:   chat.ID,
+	}
+	err = transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&message).Error; err != nil {
+			return err
+		}
+		return setLeaf(tx, chat.ID, message.ID, nil)
+	})
+	if err != nil {
+		return customerrors.NewInternalServerError("Failed to create message")
+	}
+
+	resps, err := branchResps(chat.ID, []models.Message{message})
+	if err != nil {
+		return customerrors.NewInternalServerError("Database error")
+	}
+
+	responseMap := fiber.Map{
+		"success": true,
+		"data":    resps[0],
+		"message": "Message branched successfully",
+	}
+
+	// As in PostMessage, a failed reply leaves the user's message on its own
+	if reply, err := h.answerMessage(chat, message, false); err == nil {
+		resps, err := branchResps(chat.ID, []models.Message{*reply})
+		if err == nil {
+			responseMap["ai_response"] = resps[0]
+		}
+	}
+
+	return c.Status(201).JSON(responseMap)
+}
+
+// SwitchBranch shows the branch containing the given message, continuing to
+// the most recent message written below it, and returns that branch
+func SwitchBranch(c *fiber.Ctx) error {
+	chat, err := ownedChat(c)
+	if err != nil {
+		return err
+	}
+
+	message, err := chatMessage(c, chat.ID)
+	if err != nil {
+		return err
+	}
+
+	var leafID uint
+	if err := config.DB.Raw(`WITH RECURSIVE subtree AS (
+		SELECT id, created_at FROM messages WHERE id = ? AND deleted_at IS NULL
+		UNION ALL
+		SELECT m.id, m.created_at FROM messages m JOIN subtree s ON m.parent_id = s.id WHERE m.deleted_at IS NULL
+	) SELECT id FROM subtree ORDER BY created_at DESC, id DESC LIMIT 1`, message.ID).Scan(&leafID).Error; err != nil {
+		return customerrors.NewInternalServerError("Database error")
+	}
+
+	if err := setLeaf(config.DB, chat.ID, leafID, nil); err != nil {
+		return customerrors.NewInternalServerError("Failed to switch branch")
+	}
+
+	mxs, err := messagePath(leafID)
+	if err != nil {
+		return customerrors.NewInternalServerError("Database error")
+	}
+	response, err := branchResps(chat.ID, mxs)
+	if err != nil {
+		return customerrors.NewInternalServerError("Database error")
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"success": true,
+		"data":    response,
+		"message": "Branch switched successfully",
+	})
+}
+
+// LinkMessageTrees chains the messages of chats written before branching
+// existed in the order they were created, and points each chat at its last
+// message. Chats that already have a leaf are left alone. It is meant to run once,
+// inside the transaction config.RunOnce gives it.
+func LinkMessageTrees(tx *gorm.DB) error {
+	if err := tx.Exec(`UPDATE messages SET parent_id = linked.prev_id FROM (
+		SELECT id, LAG(id) OVER (PARTITION BY chat_id ORDER BY created_at, id) AS prev_id
+		FROM messages
+		WHERE deleted_at IS NULL
+			AND chat_id IN (SELECT id FROM chats WHERE leaf_message_id IS NULL)
+	) AS linked
+	WHERE messages.id = linked.id AND linked.prev_id IS NOT NULL AND messages.parent_id IS NULL`).Error; err != nil {
+		return err
+	}
+
+	return tx.Exec(`UPDATE chats SET leaf_message_id = (
+		SELECT id FROM messages
+		WHERE messages.chat_id = chats.id AND messages.deleted_at IS NULL
+		ORDER BY created_at DESC, id DESC LIMIT 1
+	) WHERE leaf_message_id IS NULL`).Error
+}
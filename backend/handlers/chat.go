@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"errors"
+	"log"
 	"strings"
 
 	"github.com/MadMax168/Readsum/config"
@@ -12,8 +13,25 @@ import (
 )
 
 type ChatResp struct {
-	Index uint   `json:"index"`
-	Title string `json:"title"`
+	Index         uint              `json:"index"`
+	Title         string            `json:"title"`
+	TitleSource   string            `json:"title_source"`
+	Mode          string            `json:"mode"`
+	SystemPrompt  string            `json:"system_prompt,omitempty"`
+	PersonaID     *uint             `json:"persona_id,omitempty"`
+	ModelSettings ModelSettingsResp `json:"model_settings"`
+}
+
+func toChatResp(chat models.Chat) ChatResp {
+	return ChatResp{
+		Index:         chat.ID,
+		Title:         chat.Title,
+		TitleSource:   chat.TitleSource,
+		Mode:          chat.Mode,
+		SystemPrompt:  chat.SystemPrompt,
+		PersonaID:     chat.PersonaID,
+		ModelSettings: toModelSettingsResp(chat),
+	}
 }
 
 func GetChat(c *fiber.Ctx) error {
@@ -29,10 +47,7 @@ func GetChat(c *fiber.Ctx) error {
 
 	var response []ChatResp
 	for _, i := range cxs {
-		response = append(response, ChatResp{
-			Index: i.ID,
-			Title: i.Title,
-		})
+		response = append(response, toChatResp(i))
 	}
 
 	return c.Status(200).JSON(fiber.Map{
@@ -43,7 +58,66 @@ func GetChat(c *fiber.Ctx) error {
 }
 
 type CreateChatInput struct {
-	Title string `json:"title"`
+	Title        string `json:"title"`
+	Mode         string `json:"mode"`
+	SystemPrompt string `json:"system_prompt"`
+	PersonaID    *uint  `json:"persona_id"`
+}
+
+// chatMode validates a requested chat mode, defaulting to the standard chat
+func chatMode(mode string) (string, error) {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	if mode == "" {
+		return models.ChatModeStandard, nil
+	}
+	if mode != models.ChatModeStandard && mode != models.ChatModeTutor {
+		return "", customerrors.NewBadRequestError("Mode must be 'chat' or 'tutor'")
+	}
+	return mode, nil
+}
+
+// maxInstructionChars bounds a chat's system prompt and a persona's instructions,
+// which are sent with every model call
+const maxInstructionChars = 4000
+
+func checkInstructions(text string) (string, error) {
+	text = strings.TrimSpace(text)
+	if len([]rune(text)) > maxInstructionChars {
+		return "", customerrors.NewBadRequestError("Instructions must be at most 4000 characters")
+	}
+	return text, nil
+}
+
+// chatPersona checks that the persona can be applied to a chat of the user
+func chatPersona(userID, personaID uint) error {
+	var persona models.Persona
+	if err := config.DB.Where("id = ? AND user_id = ?", personaID, userID).First(&persona).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return customerrors.NewNotFoundError("Persona not found")
+		}
+		return customerrors.NewInternalServerError("Database error")
+	}
+	return nil
+}
+
+// chatInstructions is the system instruction sent with the chat's model calls:
+// its persona's instructions followed by its own system prompt
+func chatInstructions(chat models.Chat) (string, error) {
+	var parts []string
+	if chat.PersonaID != nil {
+		var persona models.Persona
+		err := config.DB.Where("id = ? AND user_id = ?", *chat.PersonaID, chat.UserID).First(&persona).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", err
+		}
+		if s := strings.TrimSpace(persona.Instructions); s != "" {
+			parts = append(parts, s)
+		}
+	}
+	if s := strings.TrimSpace(chat.SystemPrompt); s != "" {
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, "\n\n"), nil
 }
 
 func Create(c *fiber.Ctx) error {
@@ -57,14 +131,34 @@ func Create(c *fiber.Ctx) error {
 		return customerrors.NewBadRequestError("Invalid request body")
 	}
 
-	input.Title = strings.TrimSpace(input.Title)
-	if input.Title == "" {
-		return customerrors.NewBadRequestError("Chat title is required")
+	mode, err := chatMode(input.Mode)
+	if err != nil {
+		return err
+	}
+
+	systemPrompt, err := checkInstructions(input.SystemPrompt)
+	if err != nil {
+		return err
+	}
+
+	if input.PersonaID != nil {
+		if err := chatPersona(UID, *input.PersonaID); err != nil {
+			return err
+		}
 	}
 
 	chat := models.Chat{
-		Title:  input.Title,
-		UserID: UID,
+		Title:        strings.TrimSpace(input.Title),
+		TitleSource:  models.TitleUser,
+		Mode:         mode,
+		SystemPrompt: systemPrompt,
+		PersonaID:    input.PersonaID,
+		UserID:       UID,
+	}
+	// Untitled chats are named from the conversation after the first exchange
+	if chat.Title == "" {
+		chat.Title = defaultChatTitle
+		chat.TitleSource = models.TitleAuto
 	}
 
 	if err := config.DB.Create(&chat).Error; err != nil {
@@ -78,11 +172,17 @@ func Create(c *fiber.Ctx) error {
 	})
 }
 
+// TitleSource "auto" hands the title back to automatic renaming. An empty
+// system prompt clears it, as does a persona ID of 0 for the persona.
 type UpdateChatInput struct {
-	Title string `json:"title"`
+	Title        string  `json:"title"`
+	TitleSource  string  `json:"title_source"`
+	Mode         string  `json:"mode"`
+	SystemPrompt *string `json:"system_prompt"`
+	PersonaID    *uint   `json:"persona_id"`
 }
 
-func UpdChat(c *fiber.Ctx) error {
+func (h *Handler) UpdChat(c *fiber.Ctx) error {
 	UID, ok := c.Locals("userID").(uint)
 	if !ok || UID == 0 {
 		return customerrors.NewUnauthorizedError("Authentication required")
@@ -105,11 +205,54 @@ func UpdChat(c *fiber.Ctx) error {
 		return customerrors.NewInternalServerError("Database error")
 	}
 
-	if err := config.DB.Model(&chat).Update("title", input.Title).Error; err != nil {
+	updates := map[string]interface{}{}
+	switch source := strings.ToLower(strings.TrimSpace(input.TitleSource)); {
+	case source == models.TitleAuto:
+		updates["title_source"] = models.TitleAuto
+		updates["titled_at_messages"] = 0
+	case source != "" && source != models.TitleUser:
+		return customerrors.NewBadRequestError("Title source must be 'auto' or 'user'")
+	case strings.TrimSpace(input.Title) != "":
+		// A title set by hand is never renamed automatically
+		updates["title"] = strings.TrimSpace(input.Title)
+		updates["title_source"] = models.TitleUser
+	}
+	if input.Mode != "" {
+		mode, err := chatMode(input.Mode)
+		if err != nil {
+			return err
+		}
+		updates["mode"] = mode
+	}
+	if input.SystemPrompt != nil {
+		systemPrompt, err := checkInstructions(*input.SystemPrompt)
+		if err != nil {
+			return err
+		}
+		updates["system_prompt"] = systemPrompt
+	}
+	if input.PersonaID != nil {
+		if *input.PersonaID == 0 {
+			updates["persona_id"] = nil
+		} else {
+			if err := chatPersona(UID, *input.PersonaID); err != nil {
+				return err
+			}
+			updates["persona_id"] = *input.PersonaID
+		}
+	}
+	if len(updates) == 0 {
+		return customerrors.NewBadRequestError("Nothing to update")
+	}
+
+	if err := config.DB.Model(&chat).Updates(updates).Error; err != nil {
 		return customerrors.NewInternalServerError("Failed to update chat")
 	}
 
 	config.DB.First(&chat, CID)
+	if updates["title_source"] == models.TitleAuto {
+		go h.renameChat(chat.ID)
+	}
 	return c.Status(200).JSON(fiber.Map{
 		"success": true,
 		"data":    chat,
@@ -141,3 +284,154 @@ func DelChat(c *fiber.Ctx) error {
 		"message": "Chat deleted successfully",
 	})
 }
+
+const (
+	defaultChatTitle = "New Chat"
+	// renameEvery is how many messages pass before an auto title is checked
+	// against the conversation again, in case the topic has moved on
+	renameEvery = 10
+	// titleMessages is how many recent messages a title is generated from
+	titleMessages = 20
+)
+
+// renameChat titles a chat from its conversation if the title is automatic:
+// after the first exchange, then every renameEvery messages when the topic has
+// changed. It runs after a reply is saved, so failures are only logged.
+func (h *Handler) renameChat(chatID uint) {
+	var chat models.Chat
+	if err := config.DB.First(&chat, chatID).Error; err != nil || chat.TitleSource != models.TitleAuto {
+		return
+	}
+
+	history, err := chatHistory(chatID)
+	if err != nil {
+		return
+	}
+	count := len(history)
+
+	current := ""
+	switch {
+	case chat.TitledAtMessages == 0 && count >= 2:
+	case chat.TitledAtMessages > 0 && count-chat.TitledAtMessages >= renameEvery:
+		current = chat.Title
+	default:
+		return
+	}
+
+	if len(history) > titleMessages {
+		history = history[len(history)-titleMessages:]
+	}
+	var b strings.Builder
+	for _, m := range history {
+		b.WriteString(m.Role + ": " + m.Text + "\n")
+	}
+
+	title, changed, err := h.AI.SuggestChatTitle(truncateSource(b.String()), current)
+	if err != nil {
+		log.Printf("chat %d: failed to generate title: %v", chatID, err)
+		return
+	}
+
+	updates := map[string]interface{}{"titled_at_messages": count}
+	if changed {
+		updates["title"] = title
+	}
+	// Skipped if the user renamed the chat or another reply retitled it meanwhile
+	config.DB.Model(&chat).
+		Where("title_source = ? AND titled_at_messages = ?", models.TitleAuto, chat.TitledAtMessages).
+		Updates(updates)
+}
+
+// ownedChat loads the chat from the chatID local and checks it belongs to the current user
+func ownedChat(c *fiber.Ctx) (models.Chat, error) {
+	var chat models.Chat
+
+	UID, ok := c.Locals("userID").(uint)
+	if !ok || UID == 0 {
+		return chat, customerrors.NewUnauthorizedError("Authentication required")
+	}
+
+	CID, ok := c.Locals("chatID").(uint)
+	if !ok || CID == 0 {
+		return chat, customerrors.NewBadRequestError("Invalid chat ID")
+	}
+
+	if err := config.DB.Where("id = ? AND user_id = ?", CID, UID).First(&chat).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return chat, customerrors.NewNotFoundError("Chat not found")
+		}
+		return chat, customerrors.NewInternalServerError("Database error")
+	}
+
+	return chat, nil
+}
+
+// maxSourceChars keeps generation prompts within a reasonable size
+const maxSourceChars = 30000
+
+// chatSource collects the study material of a chat: the raw text of its documents,
+// or the conversation when no document has been processed yet
+func chatSource(chatID uint) (string, error) {
+	source, err := chatDocumentsText(chatID)
+	if err != nil || source != "" {
+		return source, err
+	}
+
+	return chatConversationText(chatID)
+}
+
+// chatDocumentsText joins the raw text of every processed document of the chat
+func chatDocumentsText(chatID uint) (string, error) {
+	var docs []models.Document
+	if err := config.DB.Where("chat_id = ? AND raw_text <> ''", chatID).
+		Order("created_at ASC").
+		Find(&docs).Error; err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, d := range docs {
+		b.WriteString("# " + d.Title + "\n" + d.RawText + "\n\n")
+	}
+
+	return truncateSource(b.String()), nil
+}
+
+// chatConversationText renders the current branch of the chat as a transcript,
+// without stale messages
+func chatConversationText(chatID uint) (string, error) {
+	mxs, err := activeBranch(chatID)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, m := range mxs {
+		if m.Stale {
+			continue
+		}
+		b.WriteString(m.Role + ": " + m.Text + "\n")
+	}
+
+	return truncateSource(b.String()), nil
+}
+
+func truncateSource(source string) string {
+	if len(source) > maxSourceChars {
+		source = strings.ToValidUTF8(source[:maxSourceChars], "")
+	}
+	return strings.TrimSpace(source)
+}
+
+// documentSource returns the raw text of a single document of the chat
+func documentSource(chatID, documentID uint) (string, error) {
+	var doc models.Document
+	if err := config.DB.Where("id = ? AND chat_id = ?", documentID, chatID).First(&doc).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", customerrors.NewNotFoundError("Document not found")
+		}
+		return "", customerrors.NewInternalServerError("Database error")
+	}
+
+	return truncateSource(doc.RawText), nil
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/MadMax168/Readsum/config"
+	"github.com/MadMax168/Readsum/customerrors"
+	"github.com/MadMax168/Readsum/models"
+	"github.com/MadMax168/Readsum/services"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultClozeSentences = 10
+	maxClozeSentences     = 30
+)
+
+type CreateClozeInput struct {
+	DeckID    *uint  `json:"deck_id"`
+	Title     string `json:"title"`
+	Sentences int    `json:"sentences"`
+}
+
+type RejectedCloze struct {
+	Sentence string `json:"sentence"`
+	Reason   string `json:"reason"`
+}
+
+// CreateClozeCards picks key sentences of a document and turns them into cloze
+// cards, one per deletion group. Sentences whose hidden terms cannot be found in
+// the document are rejected. Cards go into deck_id, or a new deck for the document.
+func (h *Handler) CreateClozeCards(c *fiber.Ctx) error {
+	chat, err := ownedChat(c)
+	if err != nil {
+		return err
+	}
+
+	documentID, err := c.ParamsInt("documentID")
+	if err != nil || documentID <= 0 {
+		return customerrors.NewBadRequestError("Invalid document ID format")
+	}
+
+	var input CreateClozeInput
+	if err := c.BodyParser(&input); err != nil {
+		return customerrors.NewBadRequestError("Invalid request body")
+	}
+
+	if input.Sentences == 0 {
+		input.Sentences = defaultClozeSentences
+	}
+	if input.Sentences < 1 || input.Sentences > maxClozeSentences {
+		return customerrors.NewBadRequestError("Sentences must be between 1 and 30")
+	}
+
+	docID := uint(documentID)
+	source, err := documentSource(chat.ID, docID)
+	if err != nil {
+		return err
+	}
+	if source == "" {
+		return customerrors.NewBadRequestError("Document has no text")
+	}
+
+	var deck models.Deck
+	if input.DeckID != nil {
+		if err := config.DB.Where("id = ? AND user_id = ?", *input.DeckID, chat.UserID).First(&deck).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return customerrors.NewNotFoundError("Deck not found")
+			}
+			return customerrors.NewInternalServerError("Database error")
+		}
+	}
+
+	system, err := chatInstructions(chat)
+	if err != nil {
+		return customerrors.NewInternalServerError("Database error")
+	}
+
+	generated, err := h.AI.GenerateClozes(system, source, input.Sentences)
+	if err != nil {
+		return customerrors.NewInternalServerError("Failed to generate cloze cards")
+	}
+
+	// New cards are due immediately
+	now := time.Now()
+	var cards []models.Card
+	rejected := []RejectedCloze{}
+	for i, g := range generated {
+		if i == input.Sentences {
+			break
+		}
+
+		text, err := services.BuildClozeText(source, g)
+		if err != nil {
+			rejected = append(rejected, RejectedCloze{Sentence: g.Sentence, Reason: err.Error()})
+			continue
+		}
+
+		// The note key ties together the sibling cards of one sentence
+		noteKey, err := randomToken()
+		if err != nil {
+			return customerrors.NewInternalServerError("Failed to create cloze cards")
+		}
+
+		for _, index := range services.ClozeIndexes(text) {
+			front, back := services.RenderCloze(text, index)
+			cards = append(cards, models.Card{
+				Kind:       models.CardCloze,
+				Front:      front,
+				Back:       back,
+				ClozeText:  text,
+				ClozeIndex: index,
+				NoteKey:    noteKey,
+				EaseFactor: services.DefaultEaseFactor,
+				DueAt:      now,
+			})
+		}
+	}
+
+	if len(cards) == 0 {
+		return customerrors.NewInternalServerError("Model did not return any valid cloze sentences")
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if deck.ID == 0 {
+			title := strings.TrimSpace(input.Title)
+			if title == "" {
+				title = chat.Title + " Cloze Cards"
+			}
+			deck = models.Deck{
+				Title:      title,
+				UserID:     chat.UserID,
+				ChatID:     &chat.ID,
+				DocumentID: &docID,
+			}
+			if err := tx.Create(&deck).Error; err != nil {
+				return err
+			}
+		}
+
+		for i := range cards {
+			cards[i].DeckID = deck.ID
+		}
+		return tx.Create(&cards).Error
+	})
+	if err != nil {
+		return customerrors.NewInternalServerError("Failed to save cloze cards")
+	}
+
+	deck.Cards = cards
+
+	return c.Status(201).JSON(fiber.Map{
+		"success": true,
+		"data": fiber.Map{
+			"deck":     toDeckResp(deck, true),
+			"rejected": rejected,
+		},
+		"message": "Cloze cards created successfully",
+	})
+}
@@ -0,0 +1,394 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/MadMax168/Readsum/config"
+	"github.com/MadMax168/Readsum/customerrors"
+	"github.com/MadMax168/Readsum/models"
+	"github.com/MadMax168/Readsum/services"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type CardResp struct {
+	Index          uint    `json:"index"`
+	DeckID         uint    `json:"deck_id"`
+	Kind           string  `json:"kind"`
+	Front          string  `json:"front"`
+	Back           string  `json:"back"`
+	ClozeText      string  `json:"cloze_text,omitempty"`
+	ClozeIndex     int     `json:"cloze_index,omitempty"`
+	EaseFactor     float64 `json:"ease_factor"`
+	Interval       int     `json:"interval"`
+	Repetitions    int     `json:"repetitions"`
+	DueAt          string  `json:"due_at"`
+	LastReviewedAt string  `json:"last_reviewed_at,omitempty"`
+}
+
+type DeckResp struct {
+	Index      uint       `json:"index"`
+	Title      string     `json:"title"`
+	ChatID     *uint      `json:"chat_id,omitempty"`
+	DocumentID *uint      `json:"document_id,omitempty"`
+	CardCount  int        `json:"card_count"`
+	Cards      []CardResp `json:"cards,omitempty"`
+	CreatedAt  string     `json:"created_at"`
+}
+
+func toCardResp(card models.Card) CardResp {
+	resp := CardResp{
+		Index:       card.ID,
+		DeckID:      card.DeckID,
+		Kind:        card.Kind,
+		Front:       card.Front,
+		Back:        card.Back,
+		ClozeText:   card.ClozeText,
+		ClozeIndex:  card.ClozeIndex,
+		EaseFactor:  card.EaseFactor,
+		Interval:    card.Interval,
+		Repetitions: card.Repetitions,
+		DueAt:       card.DueAt.Format("2006-01-02 15:04:05"),
+	}
+	if card.LastReviewedAt != nil {
+		resp.LastReviewedAt = card.LastReviewedAt.Format("2006-01-02 15:04:05")
+	}
+	return resp
+}
+
+func toDeckResp(deck models.Deck, withCards bool) DeckResp {
+	resp := DeckResp{
+		Index:      deck.ID,
+		Title:      deck.Title,
+		ChatID:     deck.ChatID,
+		DocumentID: deck.DocumentID,
+		CardCount:  len(deck.Cards),
+		CreatedAt:  deck.CreatedAt.Format("2006-01-02 15:04:05"),
+	}
+	if withCards {
+		for _, card := range deck.Cards {
+			resp.Cards = append(resp.Cards, toCardResp(card))
+		}
+	}
+	return resp
+}
+
+// endOfToday is the cut-off for the "due today" review queue
+func endOfToday() time.Time {
+	now := time.Now()
+	return time.Date(now.Year(), now.Month(), now.Day(), 23, 59, 59, 0, now.Location())
+}
+
+const (
+	defaultDeckCards = 10
+	maxDeckCards     = 50
+)
+
+type CreateDeckInput struct {
+	Title      string `json:"title"`
+	Cards      int    `json:"cards"`
+	DocumentID *uint  `json:"document_id"`
+}
+
+func (h *Handler) CreateDeck(c *fiber.Ctx) error {
+	chat, err := ownedChat(c)
+	if err != nil {
+		return err
+	}
+
+	var input CreateDeckInput
+	if err := c.BodyParser(&input); err != nil {
+		return customerrors.NewBadRequestError("Invalid request body")
+	}
+
+	if input.Cards == 0 {
+		input.Cards = defaultDeckCards
+	}
+	if input.Cards < 1 || input.Cards > maxDeckCards {
+		return customerrors.NewBadRequestError("Cards must be between 1 and 50")
+	}
+
+	var source string
+	if input.DocumentID != nil {
+		source, err = documentSource(chat.ID, *input.DocumentID)
+		if err != nil {
+			return err
+		}
+	} else {
+		source, err = chatSource(chat.ID)
+		if err != nil {
+			return customerrors.NewInternalServerError("Database error")
+		}
+	}
+	if source == "" {
+		return customerrors.NewBadRequestError("Nothing to build flashcards from")
+	}
+
+	system, err := chatInstructions(chat)
+	if err != nil {
+		return customerrors.NewInternalServerError("Database error")
+	}
+
+	generated, err := h.AI.GenerateFlashcards(system, source, input.Cards)
+	if err != nil {
+		return customerrors.NewInternalServerError("Failed to generate flashcards")
+	}
+
+	title := strings.TrimSpace(input.Title)
+	if title == "" {
+		title = strings.TrimSpace(generated.Title)
+	}
+	if title == "" {
+		title = chat.Title + " Flashcards"
+	}
+
+	deck := models.Deck{
+		Title:      title,
+		UserID:     chat.UserID,
+		ChatID:     &chat.ID,
+		DocumentID: input.DocumentID,
+	}
+
+	// New cards are due immediately
+	now := time.Now()
+	for _, g := range generated.Cards {
+		if len(deck.Cards) == input.Cards {
+			break
+		}
+		front, back := strings.TrimSpace(g.Front), strings.TrimSpace(g.Back)
+		if front == "" || back == "" {
+			continue
+		}
+		deck.Cards = append(deck.Cards, models.Card{
+			Kind:       models.CardBasic,
+			Front:      front,
+			Back:       back,
+			EaseFactor: services.DefaultEaseFactor,
+			DueAt:      now,
+		})
+	}
+
+	if len(deck.Cards) == 0 {
+		return customerrors.NewInternalServerError("Model did not return any valid flashcards")
+	}
+
+	if err := config.DB.Create(&deck).Error; err != nil {
+		return customerrors.NewInternalServerError("Failed to save deck")
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"success": true,
+		"data":    toDeckResp(deck, true),
+		"message": "Deck created successfully",
+	})
+}
+
+func GetChatDecks(c *fiber.Ctx) error {
+	chat, err := ownedChat(c)
+	if err != nil {
+		return err
+	}
+
+	var dxs []models.Deck
+	if err := config.DB.Where("chat_id = ?", chat.ID).
+		Preload("Cards").
+		Order("created_at DESC").
+		Find(&dxs).Error; err != nil {
+		return customerrors.NewInternalServerError("Database error")
+	}
+
+	var response []DeckResp
+	for _, d := range dxs {
+		response = append(response, toDeckResp(d, false))
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"success": true,
+		"data":    response,
+		"message": "Decks retrieved successfully",
+	})
+}
+
+func GetDecks(c *fiber.Ctx) error {
+	UID, ok := c.Locals("userID").(uint)
+	if !ok || UID == 0 {
+		return customerrors.NewUnauthorizedError("Authentication required")
+	}
+
+	var dxs []models.Deck
+	if err := config.DB.Where("user_id = ?", UID).
+		Preload("Cards").
+		Order("created_at DESC").
+		Find(&dxs).Error; err != nil {
+		return customerrors.NewInternalServerError("Database error")
+	}
+
+	var response []DeckResp
+	for _, d := range dxs {
+		response = append(response, toDeckResp(d, false))
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"success": true,
+		"data":    response,
+		"message": "Decks retrieved successfully",
+	})
+}
+
+// ownedDeck loads the deck from the deckID parameter for the current user
+func ownedDeck(c *fiber.Ctx) (models.Deck, error) {
+	var deck models.Deck
+
+	UID, ok := c.Locals("userID").(uint)
+	if !ok || UID == 0 {
+		return deck, customerrors.NewUnauthorizedError("Authentication required")
+	}
+
+	err := config.DB.Where("id = ? AND user_id = ?", c.Params("deckID"), UID).
+		Preload("Cards", func(db *gorm.DB) *gorm.DB {
+			return db.Order("id ASC")
+		}).
+		First(&deck).Error
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return deck, customerrors.NewNotFoundError("Deck not found")
+		}
+		return deck, customerrors.NewInternalServerError("Database error")
+	}
+
+	return deck, nil
+}
+
+func GetDeck(c *fiber.Ctx) error {
+	deck, err := ownedDeck(c)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"success": true,
+		"data":    toDeckResp(deck, true),
+		"message": "Deck retrieved successfully",
+	})
+}
+
+func DelDeck(c *fiber.Ctx) error {
+	UID, ok := c.Locals("userID").(uint)
+	if !ok || UID == 0 {
+		return customerrors.NewUnauthorizedError("Authentication required")
+	}
+
+	var deck models.Deck
+	result := config.DB.Where("id = ? AND user_id = ?", c.Params("deckID"), UID).Delete(&deck)
+
+	if result.Error != nil {
+		return customerrors.NewInternalServerError("Failed to delete deck")
+	}
+
+	if result.RowsAffected == 0 {
+		return customerrors.NewNotFoundError("Deck not found")
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"success": true,
+		"message": "Deck deleted successfully",
+	})
+}
+
+// GetDueCards returns the review queue for today, across all decks or for the deckID parameter
+func GetDueCards(c *fiber.Ctx) error {
+	UID, ok := c.Locals("userID").(uint)
+	if !ok || UID == 0 {
+		return customerrors.NewUnauthorizedError("Authentication required")
+	}
+
+	query := config.DB.Joins("JOIN decks ON decks.id = cards.deck_id AND decks.deleted_at IS NULL").
+		Where("decks.user_id = ? AND cards.due_at <= ?", UID, endOfToday())
+
+	if deckID := c.Params("deckID"); deckID != "" {
+		query = query.Where("decks.id = ?", deckID)
+	}
+
+	var cxs []models.Card
+	if err := query.Order("cards.due_at ASC").Find(&cxs).Error; err != nil {
+		return customerrors.NewInternalServerError("Database error")
+	}
+
+	var response []CardResp
+	for _, card := range cxs {
+		response = append(response, toCardResp(card))
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"success": true,
+		"data":    response,
+		"message": "Due cards retrieved successfully",
+	})
+}
+
+type ReviewCardInput struct {
+	Grade *int `json:"grade"`
+}
+
+func ReviewCard(c *fiber.Ctx) error {
+	deck, err := ownedDeck(c)
+	if err != nil {
+		return err
+	}
+
+	var input ReviewCardInput
+	if err := c.BodyParser(&input); err != nil {
+		return customerrors.NewBadRequestError("Invalid request body")
+	}
+
+	if input.Grade == nil || *input.Grade < 0 || *input.Grade > 5 {
+		return customerrors.NewBadRequestError("Grade must be between 0 and 5")
+	}
+
+	var card models.Card
+	if err := config.DB.Where("id = ? AND deck_id = ?", c.Params("cardID"), deck.ID).First(&card).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return customerrors.NewNotFoundError("Card not found")
+		}
+		return customerrors.NewInternalServerError("Database error")
+	}
+
+	now := time.Now()
+	card.EaseFactor, card.Interval, card.Repetitions = services.ScheduleSM2(card.EaseFactor, card.Interval, card.Repetitions, *input.Grade)
+	card.DueAt = now.AddDate(0, 0, card.Interval)
+	card.LastReviewedAt = &now
+
+	review := models.CardReview{
+		CardID:     card.ID,
+		UserID:     deck.UserID,
+		Grade:      *input.Grade,
+		EaseFactor: card.EaseFactor,
+		Interval:   card.Interval,
+		ReviewedAt: now,
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&card).Updates(map[string]interface{}{
+			"ease_factor":      card.EaseFactor,
+			"interval":         card.Interval,
+			"repetitions":      card.Repetitions,
+			"due_at":           card.DueAt,
+			"last_reviewed_at": card.LastReviewedAt,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&review).Error
+	})
+	if err != nil {
+		return customerrors.NewInternalServerError("Failed to save review")
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"success": true,
+		"data":    toCardResp(card),
+		"message": "Card reviewed successfully",
+	})
+}
@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var unsafeFileChars = regexp.MustCompile(`[^\p{L}\p{N}_-]+`)
+
+// setAttachment marks the response as a file download named after title,
+// with an ASCII fallback for clients that do not understand RFC 5987 names
+func setAttachment(c *fiber.Ctx, title, fallback, ext string) {
+	name := unsafeFileChars.ReplaceAllString(title, "_")
+	if name == "" || name == "_" {
+		name = fallback
+	}
+
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s.%s"; filename*=UTF-8''%s.%s`,
+		fallback, ext, url.PathEscape(name), ext))
+}
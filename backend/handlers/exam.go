@@ -0,0 +1,681 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MadMax168/Readsum/config"
+	"github.com/MadMax168/Readsum/customerrors"
+	"github.com/MadMax168/Readsum/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// ExamQuestionResp shows a drawn question with options in the exam's order.
+// Result is only filled once the exam is finished.
+type ExamQuestionResp struct {
+	Index            uint             `json:"index"`
+	Position         int              `json:"position"`
+	Type             string           `json:"type"`
+	Concept          string           `json:"concept,omitempty"`
+	Difficulty       string           `json:"difficulty"`
+	Prompt           string           `json:"prompt"`
+	Options          []OptionResp     `json:"options,omitempty"`
+	Rubric           []RubricItemResp `json:"rubric,omitempty"`
+	SelectedOptionID *uint            `json:"selected_option_id,omitempty"`
+	ResponseText     string           `json:"response_text,omitempty"`
+	Answered         bool             `json:"answered"`
+	Result           *AnswerResp      `json:"result,omitempty"`
+}
+
+// TopicResult is the score on one concept of a finished exam
+type TopicResult struct {
+	Topic      string  `json:"topic"`
+	Questions  int     `json:"questions"`
+	Answered   int     `json:"answered"`
+	Correct    int     `json:"correct"`
+	Points     float64 `json:"points"`
+	MaxPoints  float64 `json:"max_points"`
+	Percentage float64 `json:"percentage"`
+}
+
+type ExamResp struct {
+	Index            uint               `json:"index"`
+	Title            string             `json:"title"`
+	Status           string             `json:"status"`
+	TimeLimit        int                `json:"time_limit"`
+	StartedAt        string             `json:"started_at"`
+	ExpiresAt        string             `json:"expires_at"`
+	SubmittedAt      string             `json:"submitted_at,omitempty"`
+	RemainingSeconds int                `json:"remaining_seconds"`
+	QuestionCount    int                `json:"question_count"`
+	Score            float64            `json:"score"`
+	MaxScore         float64            `json:"max_score"`
+	Percentage       float64            `json:"percentage"`
+	Questions        []ExamQuestionResp `json:"questions,omitempty"`
+	Report           []TopicResult      `json:"report,omitempty"`
+}
+
+// examStatus reports an unsubmitted exam past its deadline as expired
+func examStatus(exam models.Exam, now time.Time) string {
+	if exam.Status == models.ExamInProgress && !now.Before(exam.ExpiresAt) {
+		return models.ExamExpired
+	}
+	return exam.Status
+}
+
+// examAnswer views the answer stored on an exam question as a graded quiz answer
+func examAnswer(eq models.ExamQuestion) models.Answer {
+	answer := models.Answer{
+		OptionID:        eq.OptionID,
+		IsCorrect:       eq.IsCorrect,
+		Points:          eq.Points,
+		MaxPoints:       eq.MaxPoints,
+		ResponseText:    eq.ResponseText,
+		GradingStatus:   eq.GradingStatus,
+		CriterionScores: eq.CriterionScores,
+		Feedback:        eq.Feedback,
+		QuestionID:      eq.QuestionID,
+	}
+	answer.ID = eq.ID
+	return answer
+}
+
+func toExamResp(exam models.Exam, withQuestions bool) ExamResp {
+	now := time.Now()
+	resp := ExamResp{
+		Index:         exam.ID,
+		Title:         exam.Title,
+		Status:        examStatus(exam, now),
+		TimeLimit:     exam.TimeLimit,
+		StartedAt:     exam.StartedAt.Format("2006-01-02 15:04:05"),
+		ExpiresAt:     exam.ExpiresAt.Format("2006-01-02 15:04:05"),
+		QuestionCount: len(exam.Questions),
+	}
+	if resp.Status == models.ExamInProgress {
+		resp.RemainingSeconds = int(exam.ExpiresAt.Sub(now).Seconds())
+	}
+
+	finished := exam.SubmittedAt != nil
+	if finished {
+		resp.SubmittedAt = exam.SubmittedAt.Format("2006-01-02 15:04:05")
+		resp.Score = exam.Score
+		resp.MaxScore = exam.MaxScore
+		resp.Percentage = exam.Percentage
+		resp.Report = examReport(exam)
+	}
+
+	if !withQuestions {
+		return resp
+	}
+
+	for _, eq := range exam.Questions {
+		q := eq.Question
+		question := ExamQuestionResp{
+			Index:            q.ID,
+			Position:         eq.Position,
+			Type:             q.Type,
+			Concept:          q.Concept,
+			Difficulty:       q.Difficulty,
+			Prompt:           q.Prompt,
+			Rubric:           toRubricItems(q.Rubric),
+			SelectedOptionID: eq.OptionID,
+			ResponseText:     eq.ResponseText,
+			Answered:         eq.AnsweredAt != nil,
+		}
+
+		options := make(map[uint]models.Option)
+		for _, o := range q.Options {
+			options[o.ID] = o
+		}
+		for _, id := range eq.OptionOrder {
+			if o, ok := options[id]; ok {
+				question.Options = append(question.Options, OptionResp{Index: o.ID, Text: o.Text})
+			}
+		}
+
+		if finished {
+			result := toAnswerResp(examAnswer(eq), q)
+			question.Result = &result
+		}
+		resp.Questions = append(resp.Questions, question)
+	}
+
+	return resp
+}
+
+// examReport breaks the score of a finished exam down by question concept
+func examReport(exam models.Exam) []TopicResult {
+	topics := make(map[string]*TopicResult)
+	var order []string
+	for _, eq := range exam.Questions {
+		topic := eq.Question.Concept
+		if topic == "" {
+			topic = "General"
+		}
+
+		t, ok := topics[topic]
+		if !ok {
+			t = &TopicResult{Topic: topic}
+			topics[topic] = t
+			order = append(order, topic)
+		}
+		t.Questions++
+		if eq.AnsweredAt != nil {
+			t.Answered++
+		}
+		if eq.IsCorrect {
+			t.Correct++
+		}
+		t.Points += eq.Points
+		t.MaxPoints += eq.MaxPoints
+	}
+
+	var report []TopicResult
+	for _, topic := range order {
+		t := *topics[topic]
+		if t.MaxPoints > 0 {
+			t.Percentage = math.Round(t.Points/t.MaxPoints*10000) / 100
+		}
+		report = append(report, t)
+	}
+
+	// Weakest topics first
+	sort.SliceStable(report, func(i, j int) bool {
+		return report[i].Percentage < report[j].Percentage
+	})
+
+	return report
+}
+
+const (
+	defaultExamQuestions = 20
+	maxExamQuestions     = 100
+	defaultExamMinutes   = 60
+	maxExamMinutes       = 300
+)
+
+type CreateExamInput struct {
+	Title     string   `json:"title"`
+	Questions int      `json:"questions"`
+	TimeLimit int      `json:"time_limit"`
+	Types     []string `json:"types"`
+}
+
+// CreateExam starts a timed exam drawing random questions from every quiz of the
+// chat, leaving out flagged ones. Question and option order are shuffled for each exam.
+func CreateExam(c *fiber.Ctx) error {
+	chat, err := ownedChat(c)
+	if err != nil {
+		return err
+	}
+
+	var input CreateExamInput
+	if err := c.BodyParser(&input); err != nil {
+		return customerrors.NewBadRequestError("Invalid request body")
+	}
+
+	if input.Questions == 0 {
+		input.Questions = defaultExamQuestions
+	}
+	if input.Questions < 1 || input.Questions > maxExamQuestions {
+		return customerrors.NewBadRequestError("Questions must be between 1 and 100")
+	}
+	if input.TimeLimit == 0 {
+		input.TimeLimit = defaultExamMinutes
+	}
+	if input.TimeLimit < 1 || input.TimeLimit > maxExamMinutes {
+		return customerrors.NewBadRequestError("Time limit must be between 1 and 300 minutes")
+	}
+	for _, t := range input.Types {
+		if t != models.QuestionMultipleChoice && t != models.QuestionShortAnswer && t != models.QuestionEssay {
+			return customerrors.NewBadRequestError("Types must be 'multiple_choice', 'short_answer' or 'essay'")
+		}
+	}
+
+	// Flagged questions failed the source check, so they never count towards a grade
+	query := config.DB.Joins("JOIN quizzes ON quizzes.id = questions.quiz_id AND quizzes.deleted_at IS NULL").
+		Where("quizzes.chat_id = ? AND questions.verification <> ?", chat.ID, models.VerificationFlagged)
+	if len(input.Types) > 0 {
+		query = query.Where("questions.type IN ?", input.Types)
+	}
+
+	var bank []models.Question
+	if err := query.Preload("Options").Find(&bank).Error; err != nil {
+		return customerrors.NewInternalServerError("Database error")
+	}
+	if len(bank) == 0 {
+		return customerrors.NewBadRequestError("The chat's question bank has no usable questions; generate a quiz first")
+	}
+
+	// Verified questions are drawn first; unverified ones, such as imported
+	// questions, only fill the remaining places
+	rand.Shuffle(len(bank), func(i, j int) { bank[i], bank[j] = bank[j], bank[i] })
+	sort.SliceStable(bank, func(i, j int) bool {
+		return bank[i].Verification == models.VerificationVerified && bank[j].Verification != models.VerificationVerified
+	})
+	if len(bank) > input.Questions {
+		bank = bank[:input.Questions]
+	}
+	rand.Shuffle(len(bank), func(i, j int) { bank[i], bank[j] = bank[j], bank[i] })
+
+	title := strings.TrimSpace(input.Title)
+	if title == "" {
+		title = chat.Title + " Practice Exam"
+	}
+
+	now := time.Now()
+	exam := models.Exam{
+		Title:     title,
+		Status:    models.ExamInProgress,
+		TimeLimit: input.TimeLimit,
+		StartedAt: now,
+		ExpiresAt: now.Add(time.Duration(input.TimeLimit) * time.Minute),
+		UserID:    chat.UserID,
+		ChatID:    chat.ID,
+	}
+	for i, q := range bank {
+		var order models.UintArray
+		for _, o := range q.Options {
+			order = append(order, o.ID)
+		}
+		rand.Shuffle(len(order), func(i, j int) { order[i], order[j] = order[j], order[i] })
+
+		exam.Questions = append(exam.Questions, models.ExamQuestion{
+			Position:    i + 1,
+			OptionOrder: order,
+			QuestionID:  q.ID,
+		})
+	}
+
+	if err := config.DB.Create(&exam).Error; err != nil {
+		return customerrors.NewInternalServerError("Failed to start exam")
+	}
+
+	for i := range exam.Questions {
+		exam.Questions[i].Question = bank[i]
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"success": true,
+		"data":    toExamResp(exam, true),
+		"message": "Exam started successfully",
+	})
+}
+
+func GetExams(c *fiber.Ctx) error {
+	chat, err := ownedChat(c)
+	if err != nil {
+		return err
+	}
+
+	var exs []models.Exam
+	if err := config.DB.Where("chat_id = ?", chat.ID).
+		Preload("Questions").
+		Order("created_at DESC").
+		Find(&exs).Error; err != nil {
+		return customerrors.NewInternalServerError("Database error")
+	}
+
+	var response []ExamResp
+	for _, e := range exs {
+		response = append(response, toExamResp(e, false))
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"success": true,
+		"data":    response,
+		"message": "Exams retrieved successfully",
+	})
+}
+
+// loadExam loads an exam of the chat with its questions in exam order
+func loadExam(chatID uint, examID string) (models.Exam, error) {
+	var exam models.Exam
+	err := config.DB.Where("id = ? AND chat_id = ?", examID, chatID).
+		Preload("Questions", func(db *gorm.DB) *gorm.DB {
+			return db.Order("position ASC")
+		}).
+		Preload("Questions.Question").
+		Preload("Questions.Question.Options").
+		First(&exam).Error
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return exam, customerrors.NewNotFoundError("Exam not found")
+		}
+		return exam, customerrors.NewInternalServerError("Database error")
+	}
+
+	return exam, nil
+}
+
+// finishExam grades the saved answers and closes the exam as submitted, or as
+// expired when time ran out. An exam closed concurrently is reloaded instead.
+func (h *Handler) finishExam(exam *models.Exam, status string) error {
+	now := time.Now()
+
+	for i := range exam.Questions {
+		eq := &exam.Questions[i]
+		answer, err := h.gradeAnswer(eq.Question, eq.OptionID, eq.ResponseText)
+		if err != nil {
+			// Options are validated when saved, so only a deleted option can get here
+			answer, _ = h.gradeAnswer(eq.Question, nil, "")
+		}
+
+		eq.IsCorrect = answer.IsCorrect
+		eq.Points = answer.Points
+		eq.MaxPoints = answer.MaxPoints
+		eq.GradingStatus = answer.GradingStatus
+		eq.CriterionScores = answer.CriterionScores
+		eq.Feedback = answer.Feedback
+	}
+
+	attempt := models.QuizAttempt{}
+	for _, eq := range exam.Questions {
+		attempt.Answers = append(attempt.Answers, examAnswer(eq))
+	}
+	scoreAttempt(&attempt)
+
+	closed := false
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Exam{}).
+			Where("id = ? AND status = ?", exam.ID, models.ExamInProgress).
+			Updates(map[string]interface{}{
+				"status":       status,
+				"submitted_at": now,
+				"score":        attempt.Score,
+				"max_score":    attempt.MaxScore,
+				"percentage":   attempt.Percentage,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			closed = true
+			return nil
+		}
+
+		for _, eq := range exam.Questions {
+			if err := tx.Model(&eq).Updates(map[string]interface{}{
+				"is_correct":       eq.IsCorrect,
+				"points":           eq.Points,
+				"max_points":       eq.MaxPoints,
+				"grading_status":   eq.GradingStatus,
+				"criterion_scores": eq.CriterionScores,
+				"feedback":         eq.Feedback,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return customerrors.NewInternalServerError("Failed to grade exam")
+	}
+
+	if closed {
+		reloaded, err := loadExam(exam.ChatID, strconv.FormatUint(uint64(exam.ID), 10))
+		if err != nil {
+			return err
+		}
+		*exam = reloaded
+		return nil
+	}
+
+	exam.Status = status
+	exam.SubmittedAt = &now
+	exam.Score, exam.MaxScore, exam.Percentage = attempt.Score, attempt.MaxScore, attempt.Percentage
+	return nil
+}
+
+// ownedExam loads the exam from the examID parameter. An exam whose time ran out
+// is reported as expired but is only graded by SubmitExam or GradeExpiredExams.
+func ownedExam(c *fiber.Ctx) (models.Exam, error) {
+	chat, err := ownedChat(c)
+	if err != nil {
+		return models.Exam{}, err
+	}
+
+	return loadExam(chat.ID, c.Params("examID"))
+}
+
+// examSweepInterval is how often GradeExpiredExams looks for exams whose time ran out
+const examSweepInterval = time.Minute
+
+// GradeExpiredExams closes and grades exams whose time ran out without being
+// submitted, so their results are ready without the student asking for them.
+// It runs until the process exits.
+func (h *Handler) GradeExpiredExams() {
+	const batch = 20
+	for {
+		var due []models.Exam
+		if err := config.DB.Select("id", "chat_id").
+			Where("status = ? AND expires_at <= ?", models.ExamInProgress, time.Now()).
+			Order("expires_at ASC").
+			Limit(batch).
+			Find(&due).Error; err != nil {
+			log.Printf("failed to look up expired exams: %v", err)
+		}
+
+		failed := false
+		for _, d := range due {
+			exam, err := loadExam(d.ChatID, strconv.FormatUint(uint64(d.ID), 10))
+			if err == nil {
+				err = h.finishExam(&exam, models.ExamExpired)
+			}
+			if err != nil {
+				log.Printf("exam %d: failed to grade expired exam: %s", d.ID, errorMessage(err))
+				failed = true
+			}
+		}
+
+		// A full batch means more are waiting, unless some keep failing
+		if len(due) < batch || failed {
+			time.Sleep(examSweepInterval)
+		}
+	}
+}
+
+func GetExam(c *fiber.Ctx) error {
+	exam, err := ownedExam(c)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"success": true,
+		"data":    toExamResp(exam, true),
+		"message": "Exam retrieved successfully",
+	})
+}
+
+type SaveExamAnswersInput struct {
+	Answers []SubmittedAnswer `json:"answers"`
+}
+
+// saveExamAnswers stores answers on an open exam. The update only applies while
+// the exam is in progress and before its deadline, so late answers are rejected
+// even if they race with expiry.
+func saveExamAnswers(exam *models.Exam, answers []SubmittedAnswer) error {
+	if len(answers) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	switch examStatus(*exam, now) {
+	case models.ExamSubmitted:
+		return customerrors.NewConflictError("Exam has already been submitted")
+	case models.ExamExpired:
+		return customerrors.NewForbiddenError("Exam time is over; answers are locked")
+	}
+
+	index := make(map[uint]int)
+	for i, eq := range exam.Questions {
+		index[eq.QuestionID] = i
+	}
+
+	type update struct {
+		i      int
+		values map[string]interface{}
+	}
+	var updates []update
+	seen := make(map[uint]bool)
+	for _, a := range answers {
+		i, ok := index[a.QuestionID]
+		if !ok {
+			return customerrors.NewBadRequestError("Answer refers to a question outside this exam")
+		}
+		if seen[a.QuestionID] {
+			return customerrors.NewBadRequestError("Each question can only be answered once")
+		}
+		seen[a.QuestionID] = true
+
+		q := exam.Questions[i].Question
+		values := map[string]interface{}{"answered_at": now, "option_id": nil, "response_text": ""}
+		if q.Type == models.QuestionShortAnswer || q.Type == models.QuestionEssay {
+			values["response_text"] = strings.TrimSpace(a.Text)
+		} else if a.OptionID != nil {
+			found := false
+			for _, o := range q.Options {
+				if o.ID == *a.OptionID {
+					found = true
+				}
+			}
+			if !found {
+				return customerrors.NewBadRequestError("Option does not belong to the question")
+			}
+			values["option_id"] = *a.OptionID
+		}
+		updates = append(updates, update{i, values})
+	}
+
+	open := config.DB.Model(&models.Exam{}).Select("id").
+		Where("id = ? AND status = ? AND expires_at > ?", exam.ID, models.ExamInProgress, now)
+
+	locked := false
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		for _, u := range updates {
+			result := tx.Model(&models.ExamQuestion{}).
+				Where("id = ? AND exam_id IN (?)", exam.Questions[u.i].ID, open).
+				Updates(u.values)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				locked = true
+				return errors.New("exam closed")
+			}
+		}
+		return nil
+	})
+	if locked {
+		return customerrors.NewForbiddenError("Exam time is over; answers are locked")
+	}
+	if err != nil {
+		return customerrors.NewInternalServerError("Failed to save answers")
+	}
+
+	for _, u := range updates {
+		eq := &exam.Questions[u.i]
+		eq.AnsweredAt = &now
+		eq.ResponseText = u.values["response_text"].(string)
+		eq.OptionID = nil
+		if id, ok := u.values["option_id"].(uint); ok {
+			eq.OptionID = &id
+		}
+	}
+
+	return nil
+}
+
+// SaveExamAnswers records answers while the exam is running; they can be changed until it ends
+func SaveExamAnswers(c *fiber.Ctx) error {
+	exam, err := ownedExam(c)
+	if err != nil {
+		return err
+	}
+
+	var input SaveExamAnswersInput
+	if err := c.BodyParser(&input); err != nil {
+		return customerrors.NewBadRequestError("Invalid request body")
+	}
+
+	if err := saveExamAnswers(&exam, input.Answers); err != nil {
+		return err
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"success": true,
+		"data":    toExamResp(exam, true),
+		"message": "Answers saved successfully",
+	})
+}
+
+// SubmitExam saves any final answers and grades the exam. An exam whose time ran
+// out is graded as expired with the answers saved before the deadline, and
+// submitting a finished exam returns its existing result.
+func (h *Handler) SubmitExam(c *fiber.Ctx) error {
+	exam, err := ownedExam(c)
+	if err != nil {
+		return err
+	}
+
+	switch examStatus(exam, time.Now()) {
+	case models.ExamExpired:
+		if exam.SubmittedAt == nil {
+			if err := h.finishExam(&exam, models.ExamExpired); err != nil {
+				return err
+			}
+		}
+	case models.ExamInProgress:
+		var input SaveExamAnswersInput
+		if len(c.Body()) > 0 {
+			if err := c.BodyParser(&input); err != nil {
+				return customerrors.NewBadRequestError("Invalid request body")
+			}
+		}
+
+		if err := saveExamAnswers(&exam, input.Answers); err != nil {
+			return err
+		}
+		if err := h.finishExam(&exam, models.ExamSubmitted); err != nil {
+			return err
+		}
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"success": true,
+		"data":    toExamResp(exam, true),
+		"message": "Exam submitted successfully",
+	})
+}
+
+func DelExam(c *fiber.Ctx) error {
+	chat, err := ownedChat(c)
+	if err != nil {
+		return err
+	}
+
+	var exam models.Exam
+	result := config.DB.Where("id = ? AND chat_id = ?", c.Params("examID"), chat.ID).Delete(&exam)
+
+	if result.Error != nil {
+		return customerrors.NewInternalServerError("Failed to delete exam")
+	}
+
+	if result.RowsAffected == 0 {
+		return customerrors.NewNotFoundError("Exam not found")
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"success": true,
+		"message": "Exam deleted successfully",
+	})
+}
@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/MadMax168/Readsum/services"
+)
+
+// Handler serves the endpoints that call the model. Endpoints that only touch
+// the database stay plain functions.
+type Handler struct {
+	AI *services.AI
+}
+
+func New(ai *services.AI) *Handler {
+	return &Handler{AI: ai}
+}
+
+// randomToken returns 128 random bits as hex, unguessable enough for secret
+// URLs such as calendar feeds and unique enough for identifiers
+func randomToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,326 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MadMax168/Readsum/config"
+	"github.com/MadMax168/Readsum/customerrors"
+	"github.com/MadMax168/Readsum/models"
+	"github.com/MadMax168/Readsum/services"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// previewRows is how many raw and mapped rows the preview shows
+const previewRows = 20
+
+// tabularImport is a parsed upload with the column mapping to apply
+type tabularImport struct {
+	Target  string
+	Format  string
+	Header  []string
+	Columns int
+	Rows    []services.DelimitedRow
+	Mapping services.ColumnMapping
+}
+
+// readTabularImport parses the multipart form shared by the preview and import
+// endpoints: a "file" upload or "text" field, plus optional format,
+// field_separator, row_separator, has_header (true, false or auto), target
+// (deck or quiz) and mapping (JSON column mapping; suggested when absent)
+func readTabularImport(c *fiber.Ctx) (tabularImport, error) {
+	var imp tabularImport
+
+	imp.Target = c.FormValue("target", services.TargetDeck)
+	if imp.Target != services.TargetDeck && imp.Target != services.TargetQuiz {
+		return imp, customerrors.NewBadRequestError("Target must be 'deck' or 'quiz'")
+	}
+
+	text := c.FormValue("text")
+	if fileHeader, err := c.FormFile("file"); err == nil {
+		file, err := fileHeader.Open()
+		if err != nil {
+			return imp, customerrors.NewBadRequestError("Failed to read uploaded file")
+		}
+		defer file.Close()
+
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return imp, customerrors.NewBadRequestError("Failed to read uploaded file")
+		}
+		text = string(data)
+	}
+	if strings.TrimSpace(text) == "" {
+		return imp, customerrors.NewBadRequestError("A file or text to import is required")
+	}
+
+	rows, format, err := services.ParseDelimited(text, services.DelimitedOptions{
+		Format:         strings.ToLower(c.FormValue("format", services.FormatAuto)),
+		FieldSeparator: c.FormValue("field_separator"),
+		RowSeparator:   c.FormValue("row_separator"),
+	})
+	if err != nil {
+		return imp, customerrors.NewBadRequestError(err.Error())
+	}
+	if len(rows) == 0 {
+		return imp, customerrors.NewBadRequestError("Nothing to import")
+	}
+	imp.Format = format
+
+	switch c.FormValue("has_header", "auto") {
+	case "true":
+		imp.Header = rows[0].Fields
+	case "false":
+	case "auto":
+		// Quizlet exports never have a header row
+		if format != services.FormatQuizlet && services.LooksLikeHeader(rows[0].Fields) {
+			imp.Header = rows[0].Fields
+		}
+	default:
+		return imp, customerrors.NewBadRequestError("Has header must be 'true', 'false' or 'auto'")
+	}
+	if imp.Header != nil {
+		rows = rows[1:]
+	}
+	imp.Rows = rows
+
+	for _, r := range append([]services.DelimitedRow{{Fields: imp.Header}}, rows...) {
+		if len(r.Fields) > imp.Columns {
+			imp.Columns = len(r.Fields)
+		}
+	}
+
+	if raw := c.FormValue("mapping"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &imp.Mapping); err != nil {
+			return imp, customerrors.NewBadRequestError("Mapping must be a JSON object of column indexes")
+		}
+	} else {
+		imp.Mapping = services.SuggestMapping(imp.Header, imp.Columns, imp.Target)
+	}
+	if err := services.ValidateMapping(imp.Mapping, imp.Columns, imp.Target); err != nil {
+		return imp, customerrors.NewBadRequestError(err.Error())
+	}
+
+	return imp, nil
+}
+
+// PreviewImport shows how an upload will be parsed and mapped, with the
+// row-level errors, without saving anything
+func PreviewImport(c *fiber.Ctx) error {
+	UID, ok := c.Locals("userID").(uint)
+	if !ok || UID == 0 {
+		return customerrors.NewUnauthorizedError("Authentication required")
+	}
+
+	imp, err := readTabularImport(c)
+	if err != nil {
+		return err
+	}
+
+	var sample [][]string
+	for i := 0; i < len(imp.Rows) && i < previewRows; i++ {
+		sample = append(sample, imp.Rows[i].Fields)
+	}
+
+	data := fiber.Map{
+		"target":   imp.Target,
+		"format":   imp.Format,
+		"header":   imp.Header,
+		"columns":  imp.Columns,
+		"mapping":  imp.Mapping,
+		"rows":     sample,
+		"total":    len(imp.Rows),
+		"errors":   []services.RowError{},
+		"valid":    0,
+		"examples": nil,
+	}
+
+	if imp.Target == services.TargetQuiz {
+		questions, rowErrors := services.MapQuestions(imp.Rows, imp.Mapping)
+		data["valid"] = len(questions)
+		data["examples"] = questions[:min(len(questions), previewRows)]
+		if rowErrors != nil {
+			data["errors"] = rowErrors
+		}
+	} else {
+		cards, rowErrors := services.MapCards(imp.Rows, imp.Mapping)
+		data["valid"] = len(cards)
+		data["examples"] = cards[:min(len(cards), previewRows)]
+		if rowErrors != nil {
+			data["errors"] = rowErrors
+		}
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"success": true,
+		"data":    data,
+		"message": "Import preview generated successfully",
+	})
+}
+
+// rowErrorsResponse rejects an import, listing the rows that failed validation
+func rowErrorsResponse(c *fiber.Ctx, rowErrors []services.RowError) error {
+	return c.Status(400).JSON(fiber.Map{
+		"success": false,
+		"error":   "Some rows are invalid; fix them or set skip_invalid to import the rest",
+		"code":    400,
+		"data":    fiber.Map{"errors": rowErrors},
+	})
+}
+
+// ImportTabular creates a deck (or, with target=quiz, a quiz in chat_id) from a
+// CSV, TSV or Quizlet upload in one transaction. Any invalid row aborts the
+// import unless skip_invalid is true, in which case skipped rows are reported.
+func ImportTabular(c *fiber.Ctx) error {
+	UID, ok := c.Locals("userID").(uint)
+	if !ok || UID == 0 {
+		return customerrors.NewUnauthorizedError("Authentication required")
+	}
+
+	imp, err := readTabularImport(c)
+	if err != nil {
+		return err
+	}
+	skipInvalid := c.FormValue("skip_invalid") == "true"
+
+	var chat *models.Chat
+	if raw := c.FormValue("chat_id"); raw != "" {
+		cid, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return customerrors.NewBadRequestError("Invalid chat ID format")
+		}
+
+		chat = &models.Chat{}
+		if err := config.DB.Where("id = ? AND user_id = ?", cid, UID).First(chat).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return customerrors.NewNotFoundError("Chat not found")
+			}
+			return customerrors.NewInternalServerError("Database error")
+		}
+	}
+
+	title := strings.TrimSpace(c.FormValue("title"))
+	if title == "" {
+		title = "Imported " + time.Now().Format("2006-01-02")
+	}
+
+	if imp.Target == services.TargetQuiz {
+		if chat == nil {
+			return customerrors.NewBadRequestError("Chat ID is required to import questions")
+		}
+
+		questions, rowErrors := services.MapQuestions(imp.Rows, imp.Mapping)
+		if len(rowErrors) > 0 && !skipInvalid {
+			return rowErrorsResponse(c, rowErrors)
+		}
+		if len(questions) == 0 {
+			return customerrors.NewBadRequestError("No valid questions to import")
+		}
+
+		quiz := models.Quiz{Title: title, UserID: UID, ChatID: chat.ID}
+		for i, q := range questions {
+			quiz.Questions = append(quiz.Questions, importedQuestion(q, i))
+		}
+
+		if err := config.DB.Create(&quiz).Error; err != nil {
+			return customerrors.NewInternalServerError("Failed to save imported questions")
+		}
+
+		return c.Status(201).JSON(fiber.Map{
+			"success": true,
+			"data": fiber.Map{
+				"quiz":    toQuizResp(quiz),
+				"skipped": skippedRows(rowErrors),
+			},
+			"message": "Questions imported successfully",
+		})
+	}
+
+	cards, rowErrors := services.MapCards(imp.Rows, imp.Mapping)
+	if len(rowErrors) > 0 && !skipInvalid {
+		return rowErrorsResponse(c, rowErrors)
+	}
+	if len(cards) == 0 {
+		return customerrors.NewBadRequestError("No valid cards to import")
+	}
+
+	deck := models.Deck{Title: title, UserID: UID}
+	if chat != nil {
+		deck.ChatID = &chat.ID
+	}
+
+	// New cards are due immediately
+	now := time.Now()
+	for _, card := range cards {
+		deck.Cards = append(deck.Cards, models.Card{
+			Kind:       models.CardBasic,
+			Front:      card.Front,
+			Back:       card.Back,
+			EaseFactor: services.DefaultEaseFactor,
+			DueAt:      now,
+		})
+	}
+
+	if err := config.DB.Create(&deck).Error; err != nil {
+		return customerrors.NewInternalServerError("Failed to save imported cards")
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"success": true,
+		"data": fiber.Map{
+			"deck":    toDeckResp(deck, true),
+			"skipped": skippedRows(rowErrors),
+		},
+		"message": "Cards imported successfully",
+	})
+}
+
+func skippedRows(rowErrors []services.RowError) []services.RowError {
+	if rowErrors == nil {
+		return []services.RowError{}
+	}
+	return rowErrors
+}
+
+// importedQuestion builds a multiple-choice question with the options shuffled,
+// or a short-answer question graded against the answer when there are no distractors.
+// position is 0-based; questions and options are stored numbered from 1.
+func importedQuestion(q services.MappedQuestion, position int) models.Question {
+	question := models.Question{
+		Prompt:       q.Prompt,
+		Explanation:  q.Explanation,
+		Position:     position + 1,
+		Concept:      q.Concept,
+		Difficulty:   services.DifficultyMedium,
+		Verification: models.VerificationUnverified,
+	}
+
+	if len(q.Distractors) == 0 {
+		question.Type = models.QuestionShortAnswer
+		question.ExpectedAnswer = q.Answer
+		question.Rubric = models.Rubric{{
+			Name:        "Correctness",
+			Description: "The answer matches the expected answer in meaning",
+			MaxPoints:   1,
+		}}
+		return question
+	}
+
+	question.Type = models.QuestionMultipleChoice
+	options := append([]string{q.Answer}, q.Distractors...)
+	order := rand.Perm(len(options))
+	for pos, i := range order {
+		question.Options = append(question.Options, models.Option{
+			Text:      options[i],
+			IsCorrect: i == 0,
+			Position:  pos + 1,
+		})
+	}
+	return question
+}
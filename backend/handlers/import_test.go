@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/MadMax168/Readsum/models"
+	"github.com/MadMax168/Readsum/services"
+)
+
+func TestImportedQuestionNumbersFromOne(t *testing.T) {
+	q := importedQuestion(services.MappedQuestion{
+		Prompt: "Which gas do plants release?", Answer: "Oxygen", Distractors: []string{"Nitrogen", "Helium"},
+	}, 0)
+	if q.Position != 1 || q.Type != models.QuestionMultipleChoice {
+		t.Fatalf("first question is a %s at position %d, want multiple choice at 1", q.Type, q.Position)
+	}
+
+	seen := make(map[int]bool)
+	correct := ""
+	for _, o := range q.Options {
+		seen[o.Position] = true
+		if o.IsCorrect {
+			correct = o.Text
+		}
+	}
+	if len(q.Options) != 3 || !seen[1] || !seen[2] || !seen[3] {
+		t.Errorf("options %+v, want positions 1 to 3", q.Options)
+	}
+	if correct != "Oxygen" {
+		t.Errorf("correct option = %q, want the answer column", correct)
+	}
+
+	q = importedQuestion(services.MappedQuestion{Prompt: "Where do plants make food?", Answer: "In the leaves"}, 4)
+	if q.Position != 5 || q.Type != models.QuestionShortAnswer || q.ExpectedAnswer != "In the leaves" {
+		t.Errorf("fifth question is a %s at position %d expecting %q", q.Type, q.Position, q.ExpectedAnswer)
+	}
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/MadMax168/Readsum/config"
+	"github.com/MadMax168/Readsum/middleware"
+	"github.com/MadMax168/Readsum/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Tests that need a database run against the PostgreSQL database named by
+// TEST_DATABASE_DSN, adding their own users and chats to it. They are skipped
+// when it is not set.
+func TestMain(m *testing.M) {
+	if dsn := os.Getenv("TEST_DATABASE_DSN"); dsn != "" {
+		db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := db.AutoMigrate(
+			&models.User{},
+			&models.Persona{},
+			&models.Chat{},
+			&models.Message{},
+			&models.Document{},
+			&models.Relationship{},
+			&models.Quiz{},
+			&models.Question{},
+			&models.Option{},
+			&models.QuizAttempt{},
+			&models.Answer{},
+			&models.TutorSession{},
+			&models.TutorStep{},
+		); err != nil {
+			log.Fatal(err)
+		}
+		RegisterRealtimeCallbacks(db)
+		config.DB = db
+
+		if os.Getenv("JWT_SECRET") == "" {
+			os.Setenv("JWT_SECRET", "test-secret")
+		}
+	}
+	os.Exit(m.Run())
+}
+
+// testChat creates a user with a chat in mode, skipping the test when there is
+// no database. The user and everything they own are deleted afterwards.
+func testChat(t *testing.T, mode string) models.Chat {
+	t.Helper()
+	if config.DB == nil {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+
+	user := models.User{
+		Name:         "Student",
+		Email:        fmt.Sprintf("student-%d@example.com", time.Now().UnixNano()),
+		PasswordHash: "-",
+	}
+	if err := config.DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		config.DB.Unscoped().Delete(&user)
+	})
+
+	chat := models.Chat{Title: "Biology", Mode: mode, UserID: user.ID}
+	if err := config.DB.Create(&chat).Error; err != nil {
+		t.Fatal(err)
+	}
+	return chat
+}
+
+// testApp serves the routes under test the way routes.SetAllRoutes does
+func testApp(h *Handler) *fiber.App {
+	app := fiber.New()
+	chats := app.Group("/api/v1/chats", middleware.AuthMiddleware)
+
+	messages := chats.Group("/:chatID/messages", middleware.ChatIDMiddleware)
+	messages.Get("/", GetMessage)
+	messages.Post("/", h.PostMessage)
+	messages.Post("/stream", h.StreamMessage)
+	messages.Patch("/:messageID", h.UpdMessage)
+	messages.Delete("/:messageID", DelMessage)
+
+	quizzes := chats.Group("/:chatID/quizzes", middleware.ChatIDMiddleware)
+	quizzes.Post("/", h.CreateQuiz)
+	quizzes.Post("/:quizID/attempts", h.SubmitAttempt)
+	quizzes.Patch("/:quizID/attempts/:attemptID/answers/:answerID", OverrideAnswer)
+
+	return app
+}
+
+// send makes an authenticated JSON request as the owner of chat
+func send(t *testing.T, app *fiber.App, chat models.Chat, method, path string, body interface{}) *http.Response {
+	t.Helper()
+	return sendAs(t, app, chat.UserID, chat, method, path, body)
+}
+
+// sendAs makes an authenticated JSON request about chat as userID
+func sendAs(t *testing.T, app *fiber.App, userID uint, chat models.Chat, method, path string, body interface{}) *http.Response {
+	t.Helper()
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := middleware.GenerateToken(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(method, fmt.Sprintf("/api/v1/chats/%d%s", chat.ID, path), bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+// decode reads the "data" of a JSON response into out
+func decode(t *testing.T, resp *http.Response, out interface{}) {
+	t.Helper()
+	defer resp.Body.Close()
+
+	var body struct {
+		Success bool            `json:"success"`
+		Data    json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if !body.Success {
+		t.Fatalf("request failed with status %d", resp.StatusCode)
+	}
+	if err := json.Unmarshal(body.Data, out); err != nil {
+		t.Fatal(err)
+	}
+}
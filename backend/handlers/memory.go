@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"log"
+	"strings"
+
+	"github.com/MadMax168/Readsum/config"
+	"github.com/MadMax168/Readsum/llm"
+	"github.com/MadMax168/Readsum/models"
+	"github.com/MadMax168/Readsum/services"
+	"gorm.io/gorm"
+)
+
+// maxSummaryPasses bounds the model calls of one summarizeChat run; a long
+// backlog, such as a chat from before summaries, is caught up over several replies
+const maxSummaryPasses = 5
+
+// summaryIndex is the position in path of the last message the chat's summary
+// covers, or -1 when the summary is empty or belongs to another branch
+func summaryIndex(chat models.Chat, path []models.Message) int {
+	if chat.Summary == "" || chat.SummaryMessageID == nil {
+		return -1
+	}
+	for i, m := range path {
+		if m.ID == *chat.SummaryMessageID {
+			return i
+		}
+	}
+	return -1
+}
+
+// forgetSummary clears the chat's summary when it covers messageID, whose text
+// has changed; the next reply rebuilds it
+func forgetSummary(tx *gorm.DB, chat models.Chat, messageID uint) error {
+	if chat.SummaryMessageID == nil {
+		return nil
+	}
+	path, err := messagePath(*chat.SummaryMessageID)
+	if err != nil {
+		return err
+	}
+	for _, m := range path {
+		if m.ID == messageID {
+			return tx.Model(&chat).Updates(map[string]interface{}{
+				"summary":            "",
+				"summary_message_id": nil,
+			}).Error
+		}
+	}
+	return nil
+}
+
+// replyContext is what the model is given to answer message: the chat's
+// instructions and running summary as the system instruction, and the messages
+// of the branch the summary does not cover yet, leaving out stale ones
+func replyContext(chat models.Chat, message models.Message) (string, []llm.Message, error) {
+	path, err := messagePath(message.ID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	system, err := chatInstructions(chat)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if i := summaryIndex(chat, path); i >= 0 && i < len(path)-1 {
+		memory := "Summary of the earlier part of this conversation. Stay consistent with it:\n" + chat.Summary
+		system = strings.TrimSpace(system + "\n\n" + memory)
+		path = path[i+1:]
+	}
+
+	return system, toHistory(path), nil
+}
+
+// summarizeChat folds older messages of the chat's current branch into its
+// running summary, SummaryInterval messages at a time, once at least twice
+// that many are not covered. The latest SummaryInterval messages always stay
+// out of it.
+func (h *Handler) summarizeChat(chatID uint) {
+	var chat models.Chat
+	if err := config.DB.First(&chat, chatID).Error; err != nil {
+		return
+	}
+
+	path, err := activeBranch(chatID)
+	if err != nil {
+		return
+	}
+
+	// A summary of another branch is rebuilt from the start of this one
+	covered := summaryIndex(chat, path)
+	summary := chat.Summary
+	if covered < 0 {
+		summary = ""
+	}
+
+	every := services.SummaryInterval()
+	for pass := 0; pass < maxSummaryPasses; pass++ {
+		pending := path[covered+1:]
+		if len(pending) < 2*every {
+			return
+		}
+
+		var b strings.Builder
+		for _, m := range pending[:every] {
+			if m.Stale {
+				continue
+			}
+			b.WriteString(m.Role + ": " + m.Text + "\n")
+		}
+
+		updated, err := h.AI.SummarizeConversation(summary, truncateSource(b.String()))
+		if err != nil {
+			log.Printf("chat %d: failed to update summary: %v", chatID, err)
+			return
+		}
+
+		last := pending[every-1].ID
+		// Skipped if another reply updated the summary meanwhile
+		result := config.DB.Model(&chat).
+			Where("summary_message_id IS NOT DISTINCT FROM ?", chat.SummaryMessageID).
+			Updates(map[string]interface{}{
+				"summary":            updated,
+				"summary_message_id": last,
+			})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return
+		}
+
+		summary = updated
+		chat.SummaryMessageID = &last
+		covered += every
+	}
+}
+
+// afterReply keeps the chat's title and summary up to date once a reply is
+// saved. It runs in the background, so the reply is not held up.
+func (h *Handler) afterReply(chatID uint) {
+	h.renameChat(chatID)
+	h.summarizeChat(chatID)
+}
@@ -5,9 +5,10 @@ import (
 
 	"github.com/MadMax168/Readsum/config"
 	"github.com/MadMax168/Readsum/customerrors"
+	"github.com/MadMax168/Readsum/llm"
 	"github.com/MadMax168/Readsum/models"
-	"github.com/MadMax168/Readsum/services"
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 )
 
 type TextResp struct {
@@ -15,31 +16,48 @@ type TextResp struct {
 	Role               string `json:"role"`
 	Text               string `json:"text"`
 	RelatedDocumentIDs []uint `json:"related_document_ids,omitempty"`
-	CreatedAt          string `json:"created_at"`
+	TutorSessionID     *uint  `json:"tutor_session_id,omitempty"`
+	Incomplete         bool   `json:"incomplete,omitempty"`
+	Stale              bool   `json:"stale,omitempty"`
+	ParentID           *uint  `json:"parent_id"`
+	// Position among the messages sharing the parent, starting at 1; Siblings
+	// lists their IDs when there is more than one branch to switch to
+	SiblingIndex int    `json:"sibling_index,omitempty"`
+	SiblingCount int    `json:"sibling_count,omitempty"`
+	Siblings     []uint `json:"siblings,omitempty"`
+	CreatedAt    string `json:"created_at"`
 }
 
+func toTextResp(msg models.Message) TextResp {
+	return TextResp{
+		Index:              msg.ID,
+		Role:               msg.Role,
+		Text:               msg.Text,
+		RelatedDocumentIDs: msg.RelatedDocumentIDs,
+		TutorSessionID:     msg.TutorSessionID,
+		Incomplete:         msg.Incomplete,
+		Stale:              msg.Stale,
+		ParentID:           msg.ParentID,
+		CreatedAt:          msg.CreatedAt.Format("2006-01-02 15:04:05"),
+	}
+}
+
+// GetMessage returns the branch of the conversation the chat currently shows
 func GetMessage(c *fiber.Ctx) error {
-	CID, ok := c.Locals("chatID").(uint)
-	if !ok || CID == 0 {
-		return customerrors.NewBadRequestError("Invalid chat ID")
+	chat, err := ownedChat(c)
+	if err != nil {
+		return err
 	}
+	CID := chat.ID
 
-	var mxs []models.Message
-	if err := config.DB.Where("chat_id = ?", CID).
-		Order("created_at ASC").
-		Find(&mxs).Error; err != nil {
+	mxs, err := activeBranch(CID)
+	if err != nil {
 		return customerrors.NewInternalServerError("Database error")
 	}
 
-	var response []TextResp
-	for _, msg := range mxs {
-		response = append(response, TextResp{
-			Index:              msg.ID,
-			Role:               msg.Role,
-			Text:               msg.Text,
-			RelatedDocumentIDs: msg.RelatedDocumentIDs,
-			CreatedAt:          msg.CreatedAt.Format("2006-01-02 15:04:05"),
-		})
+	response, err := branchResps(CID, mxs)
+	if err != nil {
+		return customerrors.NewInternalServerError("Database error")
 	}
 
 	return c.Status(200).JSON(fiber.Map{
@@ -54,7 +72,7 @@ type PostMessageInput struct {
 	Role string `json:"role"`
 }
 
-func PostMessage(c *fiber.Ctx) error {
+func (h *Handler) PostMessage(c *fiber.Ctx) error {
 	CID, ok := c.Locals("chatID").(uint)
 	if !ok || CID == 0 {
 		return customerrors.NewBadRequestError("Invalid chat ID")
@@ -87,29 +105,32 @@ func PostMessage(c *fiber.Ctx) error {
 		ChatID: CID,
 	}
 
-	if err := config.DB.Create(&message).Error; err != nil {
+	if err := appendMessage(&message); err != nil {
 		return customerrors.NewInternalServerError("Failed to create message")
 	}
 
 	// AI Process: ถ้าคนส่งคือ User ให้ AI ตอบกลับด้วย
 	var aiResponse *TextResp
-	if message.Role == "user" {
-		aiText, err := services.GenerateContent(message.Text)
+	var tutorSession *TutorSessionResp
+	if message.Role == "user" && chat.Mode == models.ChatModeTutor {
+		// Tutor mode: ถาม-นำทีละขั้น แทนการตอบตรงๆ
+		aiMsg, session, err := h.tutorMessage(chat, &message)
 		if err == nil {
-			// บันทึกคำตอบของ AI ลง DB
-			aiMsg := models.Message{
-				Text:   aiText,
-				Role:   "assistant",
-				ChatID: CID,
-			}
-			if err := config.DB.Create(&aiMsg).Error; err == nil {
-				aiResponse = &TextResp{
-					Index:     aiMsg.ID,
-					Role:      aiMsg.Role,
-					Text:      aiMsg.Text,
-					CreatedAt: aiMsg.CreatedAt.Format("2006-01-02 15:04:05"),
-				}
+			aiResponse = &TextResp{
+				Index:          aiMsg.ID,
+				Role:           aiMsg.Role,
+				Text:           aiMsg.Text,
+				TutorSessionID: aiMsg.TutorSessionID,
+				CreatedAt:      aiMsg.CreatedAt.Format("2006-01-02 15:04:05"),
 			}
+			resp := toTutorSessionResp(*session)
+			tutorSession = &resp
+		}
+	} else if message.Role == "user" {
+		// บันทึกคำตอบของ AI ลง DB ต่อจากข้อความของ User
+		if aiMsg, err := h.answerMessage(chat, message, false); err == nil {
+			resp := toTextResp(*aiMsg)
+			aiResponse = &resp
 		}
 		// Note: ถ้า AI error อาจจะไม่ต้อง return error ให้ user หรือ log ไว้เฉยๆ ก็ได้
 		// แต่ในที่นี้จะปล่อยผ่านไปก่อน ให้ user เห็นแค่ข้อความตัวเอง
@@ -117,12 +138,7 @@ func PostMessage(c *fiber.Ctx) error {
 
 	responseMap := fiber.Map{
 		"success": true,
-		"data": TextResp{
-			Index:     message.ID,
-			Role:      message.Role,
-			Text:      message.Text,
-			CreatedAt: message.CreatedAt.Format("2006-01-02 15:04:05"),
-		},
+		"data":    toTextResp(message),
 		"message": "Message created successfully",
 	}
 
@@ -130,19 +146,39 @@ func PostMessage(c *fiber.Ctx) error {
 	if aiResponse != nil {
 		responseMap["ai_response"] = aiResponse
 	}
+	if tutorSession != nil {
+		responseMap["tutor_session"] = tutorSession
+	}
 
 	return c.Status(201).JSON(responseMap)
 }
 
+// chatHistory returns the branch of the chat GetMessage lists, as conversation
+// turns for the model without its stale messages
+func chatHistory(chatID uint) ([]llm.Message, error) {
+	mxs, err := activeBranch(chatID)
+	if err != nil {
+		return nil, err
+	}
+	return toHistory(mxs), nil
+}
+
+// Regenerate also answers the edited message again
 type UpdMessageInput struct {
-	Text string `json:"text"`
+	Text       string `json:"text"`
+	Regenerate bool   `json:"regenerate"`
 }
 
-func UpdMessage(c *fiber.Ctx) error {
-	CID, ok := c.Locals("chatID").(uint)
-	if !ok || CID == 0 {
-		return customerrors.NewBadRequestError("Invalid chat ID")
+// UpdMessage edits a user message in place. The messages after it answered the
+// old text, so they are marked stale; with regenerate the message is answered
+// again and the chat switches to the new reply, keeping the stale ones as the
+// other branch.
+func (h *Handler) UpdMessage(c *fiber.Ctx) error {
+	chat, err := ownedChat(c)
+	if err != nil {
+		return err
 	}
+	CID := chat.ID
 
 	MID := c.Params("messageID")
 	if MID == "" {
@@ -168,29 +204,49 @@ func UpdMessage(c *fiber.Ctx) error {
 		return customerrors.NewForbiddenError("Cannot edit assistant messages")
 	}
 
-	if err := config.DB.Model(&message).Update("text", input.Text).Error; err != nil {
+	if input.Regenerate && chat.Mode == models.ChatModeTutor {
+		return customerrors.NewBadRequestError("Branching is not available in tutor mode")
+	}
+
+	err = transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&message).Update("text", input.Text).Error; err != nil {
+			return err
+		}
+		if err := markStale(tx, message); err != nil {
+			return err
+		}
+		return forgetSummary(tx, chat, message.ID)
+	})
+	if err != nil {
 		return customerrors.NewInternalServerError("Failed to update message")
 	}
 
 	config.DB.First(&message, MID)
 
-	return c.Status(200).JSON(fiber.Map{
+	responseMap := fiber.Map{
 		"success": true,
-		"data": TextResp{
-			Index:     message.ID,
-			Role:      message.Role,
-			Text:      message.Text,
-			CreatedAt: message.CreatedAt.Format("2006-01-02 15:04:05"),
-		},
+		"data":    toTextResp(message),
 		"message": "Message updated successfully",
-	})
+	}
+
+	// As in PostMessage, a failed reply still returns the edited message
+	if input.Regenerate {
+		if reply, err := h.answerMessage(chat, message, true); err == nil {
+			if resps, err := branchResps(CID, []models.Message{*reply}); err == nil {
+				responseMap["ai_response"] = resps[0]
+			}
+		}
+	}
+
+	return c.Status(200).JSON(responseMap)
 }
 
 func DelMessage(c *fiber.Ctx) error {
-	CID, ok := c.Locals("chatID").(uint)
-	if !ok || CID == 0 {
-		return customerrors.NewBadRequestError("Invalid chat ID")
+	chat, err := ownedChat(c)
+	if err != nil {
+		return err
 	}
+	CID := chat.ID
 
 	MID := c.Params("messageID")
 	if MID == "" {
@@ -198,14 +254,47 @@ func DelMessage(c *fiber.Ctx) error {
 	}
 
 	var message models.Message
-	result := config.DB.Where("id = ? AND chat_id = ?", MID, CID).Delete(&message)
-
-	if result.Error != nil {
-		return customerrors.NewInternalServerError("Failed to delete message")
+	if err := config.DB.Where("id = ? AND chat_id = ?", MID, CID).First(&message).Error; err != nil {
+		return customerrors.NewNotFoundError("Message not found")
 	}
 
-	if result.RowsAffected == 0 {
-		return customerrors.NewNotFoundError("Message not found")
+	// The messages below the deleted one move up to its parent, so no branch is cut off
+	err = transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Message{}).
+			Where("parent_id = ?", message.ID).
+			Update("parent_id", message.ParentID).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&message).Error; err != nil {
+			return err
+		}
+
+		// Reload the leaf inside the transaction, it may have moved since
+		var current models.Chat
+		if err := tx.Select("id", "leaf_message_id").First(&current, CID).Error; err != nil {
+			return err
+		}
+		if current.LeafMessageID == nil || *current.LeafMessageID != message.ID {
+			return nil
+		}
+
+		// The chat showed the deleted message: fall back to its parent, or to
+		// the latest message left when it started the conversation
+		leafID := message.ParentID
+		if leafID == nil {
+			var latest models.Message
+			if err := tx.Where("chat_id = ?", CID).Order("created_at DESC, id DESC").First(&latest).Error; err == nil {
+				leafID = &latest.ID
+			}
+		}
+		if err := tx.Model(&models.Chat{}).Where("id = ?", CID).Update("leaf_message_id", leafID).Error; err != nil {
+			return err
+		}
+		publish(tx, CID, "branch.switched", fiber.Map{"leaf_message_id": leafID})
+		return nil
+	})
+	if err != nil {
+		return customerrors.NewInternalServerError("Failed to delete message")
 	}
 
 	return c.Status(200).JSON(fiber.Map{
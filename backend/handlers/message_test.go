@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/MadMax168/Readsum/config"
+	"github.com/MadMax168/Readsum/llm"
+	"github.com/MadMax168/Readsum/models"
+	"github.com/MadMax168/Readsum/services"
+)
+
+func TestMessagesOnlyForOwner(t *testing.T) {
+	chat := studyChat(t)
+	stranger := testChat(t, models.ChatModeStandard)
+	app := testApp(New(services.NewAI(llm.NewFake())))
+
+	var message models.Message
+	if err := config.DB.Where("chat_id = ?", chat.ID).First(&message).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	resp := sendAs(t, app, stranger.UserID, chat, "GET", "/messages", nil)
+	resp.Body.Close()
+	if resp.StatusCode != 404 {
+		t.Errorf("another user read the messages: status %d, want 404", resp.StatusCode)
+	}
+
+	resp = sendAs(t, app, stranger.UserID, chat, "DELETE", fmt.Sprintf("/messages/%d", message.ID), nil)
+	resp.Body.Close()
+	if resp.StatusCode != 404 {
+		t.Errorf("another user deleted a message: status %d, want 404", resp.StatusCode)
+	}
+	if err := config.DB.First(&models.Message{}, message.ID).Error; err != nil {
+		t.Errorf("message is gone after another user's request: %v", err)
+	}
+
+	resp = send(t, app, chat, "GET", "/messages", nil)
+	var mxs []TextResp
+	decode(t, resp, &mxs)
+	if len(mxs) != 1 || mxs[0].Text != plantSource {
+		t.Errorf("owner sees %+v, want the one message", mxs)
+	}
+
+	resp = send(t, app, chat, "DELETE", fmt.Sprintf("/messages/%d", message.ID), nil)
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Errorf("owner could not delete the message: status %d", resp.StatusCode)
+	}
+}
+
+func TestEditLeavesStaleRepliesOutOfHistory(t *testing.T) {
+	chat := testChat(t, models.ChatModeStandard)
+	// A user title keeps renaming from calling the model in the background
+	config.DB.Model(&chat).Update("title_source", models.TitleUser)
+
+	question := models.Message{Text: "Where do plants make food?", Role: "user", ChatID: chat.ID}
+	if err := appendMessage(&question); err != nil {
+		t.Fatal(err)
+	}
+	answer := models.Message{Text: "In the roots", Role: "assistant", ChatID: chat.ID}
+	if err := replyTo(question, &answer, true); err != nil {
+		t.Fatal(err)
+	}
+
+	fake := llm.NewFake("Oxygen")
+	app := testApp(New(services.NewAI(fake)))
+
+	resp := send(t, app, chat, "PATCH", fmt.Sprintf("/messages/%d", question.ID), UpdMessageInput{Text: "Where do plants make their food?"})
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("edit failed with status %d", resp.StatusCode)
+	}
+	config.DB.First(&answer, answer.ID)
+	if !answer.Stale {
+		t.Fatal("the reply to the edited message is not marked stale")
+	}
+
+	resp = send(t, app, chat, "POST", "/messages", PostMessageInput{Text: "Which gas do they release?", Role: "user"})
+	resp.Body.Close()
+	if len(fake.Requests) != 1 {
+		t.Fatalf("made %d model calls, want 1", len(fake.Requests))
+	}
+	want := []llm.Message{{Role: llm.RoleUser, Text: "Where do plants make their food?\n\nWhich gas do they release?"}}
+	if got := fake.Requests[0].Messages; !reflect.DeepEqual(got, want) {
+		t.Errorf("history sent to the model = %q, want %q", got, want)
+	}
+
+	transcript, err := chatConversationText(chat.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(transcript, "In the roots") {
+		t.Errorf("transcript keeps the stale reply:\n%s", transcript)
+	}
+}
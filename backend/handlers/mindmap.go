@@ -0,0 +1,494 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/MadMax168/Readsum/config"
+	"github.com/MadMax168/Readsum/customerrors"
+	"github.com/MadMax168/Readsum/models"
+	"github.com/MadMax168/Readsum/services"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type MindMapResp struct {
+	Index      uint                  `json:"index"`
+	Title      string                `json:"title"`
+	DocumentID *uint                 `json:"document_id,omitempty"`
+	NodeCount  int                   `json:"node_count"`
+	Root       *services.MindMapTree `json:"root,omitempty"`
+	CreatedAt  string                `json:"created_at"`
+}
+
+type MindMapNodeResp struct {
+	Index    uint   `json:"index"`
+	ParentID *uint  `json:"parent_id"`
+	Label    string `json:"label"`
+	Note     string `json:"note"`
+	Position int    `json:"position"`
+}
+
+func toMindMapResp(mindMap models.MindMap, withTree bool) MindMapResp {
+	resp := MindMapResp{
+		Index:      mindMap.ID,
+		Title:      mindMap.Title,
+		DocumentID: mindMap.DocumentID,
+		NodeCount:  len(mindMap.Nodes),
+		CreatedAt:  mindMap.CreatedAt.Format("2006-01-02 15:04:05"),
+	}
+	if withTree {
+		resp.Root = mindMapTree(mindMap.Nodes)
+	}
+	return resp
+}
+
+func toMindMapNodeResp(node models.MindMapNode) MindMapNodeResp {
+	return MindMapNodeResp{
+		Index:    node.ID,
+		ParentID: node.ParentID,
+		Label:    node.Label,
+		Note:     node.Note,
+		Position: node.Position,
+	}
+}
+
+// mindMapTree assembles nodes ordered by position into a tree under the root node
+func mindMapTree(nodes []models.MindMapNode) *services.MindMapTree {
+	children := make(map[uint][]models.MindMapNode)
+	var root *models.MindMapNode
+	for i, n := range nodes {
+		if n.ParentID == nil {
+			if root == nil {
+				root = &nodes[i]
+			}
+			continue
+		}
+		children[*n.ParentID] = append(children[*n.ParentID], n)
+	}
+	if root == nil {
+		return nil
+	}
+
+	var build func(n models.MindMapNode) services.MindMapTree
+	build = func(n models.MindMapNode) services.MindMapTree {
+		tree := services.MindMapTree{ID: n.ID, Label: n.Label, Note: n.Note}
+		for _, child := range children[n.ID] {
+			tree.Children = append(tree.Children, build(child))
+		}
+		return tree
+	}
+
+	tree := build(*root)
+	return &tree
+}
+
+// saveMindMapTree stores a node and its descendants under parentID
+func saveMindMapTree(tx *gorm.DB, mindMapID uint, parentID *uint, tree services.MindMapTree, position int) error {
+	node := models.MindMapNode{
+		MindMapID: mindMapID,
+		ParentID:  parentID,
+		Label:     tree.Label,
+		Note:      tree.Note,
+		Position:  position,
+	}
+	if err := tx.Create(&node).Error; err != nil {
+		return err
+	}
+
+	for i, child := range tree.Children {
+		if err := saveMindMapTree(tx, mindMapID, &node.ID, child, i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type CreateMindMapInput struct {
+	Title      string `json:"title"`
+	DocumentID *uint  `json:"document_id"`
+}
+
+// CreateMindMap generates a mind map of one document, or of the whole chat
+func (h *Handler) CreateMindMap(c *fiber.Ctx) error {
+	chat, err := ownedChat(c)
+	if err != nil {
+		return err
+	}
+
+	var input CreateMindMapInput
+	if err := c.BodyParser(&input); err != nil {
+		return customerrors.NewBadRequestError("Invalid request body")
+	}
+
+	var source string
+	if input.DocumentID != nil {
+		source, err = documentSource(chat.ID, *input.DocumentID)
+		if err != nil {
+			return err
+		}
+	} else {
+		source, err = chatSource(chat.ID)
+		if err != nil {
+			return customerrors.NewInternalServerError("Database error")
+		}
+	}
+	if source == "" {
+		return customerrors.NewBadRequestError("Nothing to build a mind map from")
+	}
+
+	system, err := chatInstructions(chat)
+	if err != nil {
+		return customerrors.NewInternalServerError("Database error")
+	}
+
+	tree, err := h.AI.GenerateMindMap(system, source)
+	if err != nil {
+		return customerrors.NewInternalServerError("Failed to generate mind map")
+	}
+
+	title := strings.TrimSpace(input.Title)
+	if title == "" {
+		title = tree.Label
+	}
+
+	mindMap := models.MindMap{
+		Title:      title,
+		UserID:     chat.UserID,
+		ChatID:     chat.ID,
+		DocumentID: input.DocumentID,
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&mindMap).Error; err != nil {
+			return err
+		}
+		return saveMindMapTree(tx, mindMap.ID, nil, *tree, 0)
+	})
+	if err != nil {
+		return customerrors.NewInternalServerError("Failed to save mind map")
+	}
+
+	mindMap, err = loadMindMap(chat.ID, strconv.FormatUint(uint64(mindMap.ID), 10))
+	if err != nil {
+		return err
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"success": true,
+		"data":    toMindMapResp(mindMap, true),
+		"message": "Mind map created successfully",
+	})
+}
+
+func GetMindMaps(c *fiber.Ctx) error {
+	chat, err := ownedChat(c)
+	if err != nil {
+		return err
+	}
+
+	var mxs []models.MindMap
+	if err := config.DB.Where("chat_id = ?", chat.ID).
+		Preload("Nodes").
+		Order("created_at DESC").
+		Find(&mxs).Error; err != nil {
+		return customerrors.NewInternalServerError("Database error")
+	}
+
+	var response []MindMapResp
+	for _, m := range mxs {
+		response = append(response, toMindMapResp(m, false))
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"success": true,
+		"data":    response,
+		"message": "Mind maps retrieved successfully",
+	})
+}
+
+// loadMindMap loads a mind map of the chat with its nodes in sibling order
+func loadMindMap(chatID uint, mapID string) (models.MindMap, error) {
+	var mindMap models.MindMap
+	err := config.DB.Where("id = ? AND chat_id = ?", mapID, chatID).
+		Preload("Nodes", func(db *gorm.DB) *gorm.DB {
+			return db.Order("position ASC, id ASC")
+		}).
+		First(&mindMap).Error
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return mindMap, customerrors.NewNotFoundError("Mind map not found")
+		}
+		return mindMap, customerrors.NewInternalServerError("Database error")
+	}
+
+	return mindMap, nil
+}
+
+// ownedMindMap loads the mind map from the mapID parameter of the current chat
+func ownedMindMap(c *fiber.Ctx) (models.MindMap, error) {
+	chat, err := ownedChat(c)
+	if err != nil {
+		return models.MindMap{}, err
+	}
+	return loadMindMap(chat.ID, c.Params("mapID"))
+}
+
+func GetMindMap(c *fiber.Ctx) error {
+	mindMap, err := ownedMindMap(c)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"success": true,
+		"data":    toMindMapResp(mindMap, true),
+		"message": "Mind map retrieved successfully",
+	})
+}
+
+func DelMindMap(c *fiber.Ctx) error {
+	chat, err := ownedChat(c)
+	if err != nil {
+		return err
+	}
+
+	var mindMap models.MindMap
+	result := config.DB.Where("id = ? AND chat_id = ?", c.Params("mapID"), chat.ID).Delete(&mindMap)
+
+	if result.Error != nil {
+		return customerrors.NewInternalServerError("Failed to delete mind map")
+	}
+
+	if result.RowsAffected == 0 {
+		return customerrors.NewNotFoundError("Mind map not found")
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"success": true,
+		"message": "Mind map deleted successfully",
+	})
+}
+
+// ExportMindMap renders the mind map as ?format=json (default), opml or mermaid
+func ExportMindMap(c *fiber.Ctx) error {
+	mindMap, err := ownedMindMap(c)
+	if err != nil {
+		return err
+	}
+
+	root := mindMapTree(mindMap.Nodes)
+	if root == nil {
+		return customerrors.NewInternalServerError("Mind map has no root node")
+	}
+
+	var buf bytes.Buffer
+	var contentType, ext string
+
+	switch strings.ToLower(c.Query("format", "json")) {
+	case "json":
+		if err := json.NewEncoder(&buf).Encode(root); err != nil {
+			return customerrors.NewInternalServerError("Failed to render mind map")
+		}
+		contentType, ext = fiber.MIMEApplicationJSONCharsetUTF8, "json"
+	case "opml":
+		if err := services.RenderOPML(mindMap.Title, *root, &buf); err != nil {
+			return customerrors.NewInternalServerError("Failed to render mind map")
+		}
+		contentType, ext = "text/x-opml; charset=utf-8", "opml"
+	case "mermaid", "mmd":
+		buf.WriteString(services.RenderMermaid(*root))
+		contentType, ext = fiber.MIMETextPlainCharsetUTF8, "mmd"
+	default:
+		return customerrors.NewBadRequestError("Format must be 'json', 'opml' or 'mermaid'")
+	}
+
+	c.Set(fiber.HeaderContentType, contentType)
+	setAttachment(c, mindMap.Title, "mind_map", ext)
+	return c.Status(200).Send(buf.Bytes())
+}
+
+// findMindMapNode returns the node with id among the mind map's nodes
+func findMindMapNode(mindMap models.MindMap, id uint) (models.MindMapNode, bool) {
+	for _, n := range mindMap.Nodes {
+		if n.ID == id {
+			return n, true
+		}
+	}
+	return models.MindMapNode{}, false
+}
+
+// mindMapSubtree lists the ids of a node and all of its descendants
+func mindMapSubtree(mindMap models.MindMap, id uint) []uint {
+	ids := []uint{id}
+	for i := 0; i < len(ids); i++ {
+		for _, n := range mindMap.Nodes {
+			if n.ParentID != nil && *n.ParentID == ids[i] {
+				ids = append(ids, n.ID)
+			}
+		}
+	}
+	return ids
+}
+
+type MindMapNodeInput struct {
+	ParentID *uint   `json:"parent_id"`
+	Label    *string `json:"label"`
+	Note     *string `json:"note"`
+	Position *int    `json:"position"`
+}
+
+// AddMindMapNode adds a node under parent_id, last among its siblings unless a position is given
+func AddMindMapNode(c *fiber.Ctx) error {
+	mindMap, err := ownedMindMap(c)
+	if err != nil {
+		return err
+	}
+
+	var input MindMapNodeInput
+	if err := c.BodyParser(&input); err != nil {
+		return customerrors.NewBadRequestError("Invalid request body")
+	}
+
+	if input.ParentID == nil {
+		return customerrors.NewBadRequestError("Parent ID is required")
+	}
+	if _, ok := findMindMapNode(mindMap, *input.ParentID); !ok {
+		return customerrors.NewNotFoundError("Parent node not found")
+	}
+	if input.Label == nil || strings.TrimSpace(*input.Label) == "" {
+		return customerrors.NewBadRequestError("Label is required")
+	}
+
+	node := models.MindMapNode{
+		MindMapID: mindMap.ID,
+		ParentID:  input.ParentID,
+		Label:     strings.TrimSpace(*input.Label),
+	}
+	if input.Note != nil {
+		node.Note = strings.TrimSpace(*input.Note)
+	}
+	if input.Position != nil {
+		node.Position = *input.Position
+	} else {
+		for _, n := range mindMap.Nodes {
+			if n.ParentID != nil && *n.ParentID == *input.ParentID && n.Position >= node.Position {
+				node.Position = n.Position + 1
+			}
+		}
+	}
+
+	if err := config.DB.Create(&node).Error; err != nil {
+		return customerrors.NewInternalServerError("Failed to save node")
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"success": true,
+		"data":    toMindMapNodeResp(node),
+		"message": "Node added successfully",
+	})
+}
+
+// UpdMindMapNode edits a node's label, note or position, or moves it under another parent
+func UpdMindMapNode(c *fiber.Ctx) error {
+	mindMap, err := ownedMindMap(c)
+	if err != nil {
+		return err
+	}
+
+	nodeID, err := c.ParamsInt("nodeID")
+	if err != nil || nodeID <= 0 {
+		return customerrors.NewBadRequestError("Invalid node ID format")
+	}
+	node, ok := findMindMapNode(mindMap, uint(nodeID))
+	if !ok {
+		return customerrors.NewNotFoundError("Node not found")
+	}
+
+	var input MindMapNodeInput
+	if err := c.BodyParser(&input); err != nil {
+		return customerrors.NewBadRequestError("Invalid request body")
+	}
+
+	updates := map[string]interface{}{}
+
+	if input.Label != nil {
+		label := strings.TrimSpace(*input.Label)
+		if label == "" {
+			return customerrors.NewBadRequestError("Label cannot be empty")
+		}
+		node.Label = label
+		updates["label"] = label
+	}
+	if input.Note != nil {
+		node.Note = strings.TrimSpace(*input.Note)
+		updates["note"] = node.Note
+	}
+	if input.Position != nil {
+		node.Position = *input.Position
+		updates["position"] = node.Position
+	}
+	if input.ParentID != nil {
+		if node.ParentID == nil {
+			return customerrors.NewBadRequestError("The root node cannot be moved")
+		}
+		if _, ok := findMindMapNode(mindMap, *input.ParentID); !ok {
+			return customerrors.NewNotFoundError("Parent node not found")
+		}
+		// A node cannot move under itself or one of its descendants
+		for _, id := range mindMapSubtree(mindMap, node.ID) {
+			if id == *input.ParentID {
+				return customerrors.NewBadRequestError("A node cannot be moved under its own subtree")
+			}
+		}
+		node.ParentID = input.ParentID
+		updates["parent_id"] = *input.ParentID
+	}
+
+	if len(updates) == 0 {
+		return customerrors.NewBadRequestError("Nothing to update")
+	}
+
+	if err := config.DB.Model(&node).Updates(updates).Error; err != nil {
+		return customerrors.NewInternalServerError("Failed to update node")
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"success": true,
+		"data":    toMindMapNodeResp(node),
+		"message": "Node updated successfully",
+	})
+}
+
+// DelMindMapNode removes a node together with its descendants
+func DelMindMapNode(c *fiber.Ctx) error {
+	mindMap, err := ownedMindMap(c)
+	if err != nil {
+		return err
+	}
+
+	nodeID, err := c.ParamsInt("nodeID")
+	if err != nil || nodeID <= 0 {
+		return customerrors.NewBadRequestError("Invalid node ID format")
+	}
+	node, ok := findMindMapNode(mindMap, uint(nodeID))
+	if !ok {
+		return customerrors.NewNotFoundError("Node not found")
+	}
+	if node.ParentID == nil {
+		return customerrors.NewBadRequestError("The root node cannot be deleted")
+	}
+
+	if err := config.DB.Where("id IN ?", mindMapSubtree(mindMap, node.ID)).Delete(&models.MindMapNode{}).Error; err != nil {
+		return customerrors.NewInternalServerError("Failed to delete node")
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"success": true,
+		"message": "Node deleted successfully",
+	})
+}
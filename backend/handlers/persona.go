@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/MadMax168/Readsum/config"
+	"github.com/MadMax168/Readsum/customerrors"
+	"github.com/MadMax168/Readsum/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type PersonaResp struct {
+	Index        uint   `json:"index"`
+	Name         string `json:"name"`
+	Instructions string `json:"instructions"`
+	CreatedAt    string `json:"created_at"`
+}
+
+func toPersonaResp(persona models.Persona) PersonaResp {
+	return PersonaResp{
+		Index:        persona.ID,
+		Name:         persona.Name,
+		Instructions: persona.Instructions,
+		CreatedAt:    persona.CreatedAt.Format("2006-01-02 15:04:05"),
+	}
+}
+
+func GetPersonas(c *fiber.Ctx) error {
+	UID, ok := c.Locals("userID").(uint)
+	if !ok || UID == 0 {
+		return customerrors.NewUnauthorizedError("Authentication required")
+	}
+
+	var pxs []models.Persona
+	if err := config.DB.Where("user_id = ?", UID).Order("name ASC").Find(&pxs).Error; err != nil {
+		return customerrors.NewInternalServerError("Database error")
+	}
+
+	var response []PersonaResp
+	for _, p := range pxs {
+		response = append(response, toPersonaResp(p))
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"success": true,
+		"data":    response,
+		"message": "Personas retrieved successfully",
+	})
+}
+
+type PersonaInput struct {
+	Name         string `json:"name"`
+	Instructions string `json:"instructions"`
+}
+
+// CreatePersona saves a reusable assistant voice. It is applied to a chat by
+// setting the chat's persona_id.
+func CreatePersona(c *fiber.Ctx) error {
+	UID, ok := c.Locals("userID").(uint)
+	if !ok || UID == 0 {
+		return customerrors.NewUnauthorizedError("Authentication required")
+	}
+
+	var input PersonaInput
+	if err := c.BodyParser(&input); err != nil {
+		return customerrors.NewBadRequestError("Invalid request body")
+	}
+
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" {
+		return customerrors.NewBadRequestError("Persona name is required")
+	}
+
+	instructions, err := checkInstructions(input.Instructions)
+	if err != nil {
+		return err
+	}
+	if instructions == "" {
+		return customerrors.NewBadRequestError("Persona instructions are required")
+	}
+
+	persona := models.Persona{
+		Name:         input.Name,
+		Instructions: instructions,
+		UserID:       UID,
+	}
+	if err := config.DB.Create(&persona).Error; err != nil {
+		return customerrors.NewInternalServerError("Failed to create persona")
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"success": true,
+		"data":    toPersonaResp(persona),
+		"message": "Persona created successfully",
+	})
+}
+
+// ownedPersona loads the persona from the personaID parameter for the current user
+func ownedPersona(c *fiber.Ctx) (models.Persona, error) {
+	var persona models.Persona
+
+	UID, ok := c.Locals("userID").(uint)
+	if !ok || UID == 0 {
+		return persona, customerrors.NewUnauthorizedError("Authentication required")
+	}
+
+	if err := config.DB.Where("id = ? AND user_id = ?", c.Params("personaID"), UID).First(&persona).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return persona, customerrors.NewNotFoundError("Persona not found")
+		}
+		return persona, customerrors.NewInternalServerError("Database error")
+	}
+
+	return persona, nil
+}
+
+// UpdPersona changes a persona; every chat using it picks up the change
+func UpdPersona(c *fiber.Ctx) error {
+	persona, err := ownedPersona(c)
+	if err != nil {
+		return err
+	}
+
+	var input PersonaInput
+	if err := c.BodyParser(&input); err != nil {
+		return customerrors.NewBadRequestError("Invalid request body")
+	}
+
+	updates := map[string]interface{}{}
+	if name := strings.TrimSpace(input.Name); name != "" {
+		updates["name"] = name
+	}
+	if strings.TrimSpace(input.Instructions) != "" {
+		instructions, err := checkInstructions(input.Instructions)
+		if err != nil {
+			return err
+		}
+		updates["instructions"] = instructions
+	}
+	if len(updates) == 0 {
+		return customerrors.NewBadRequestError("Nothing to update")
+	}
+
+	if err := config.DB.Model(&persona).Updates(updates).Error; err != nil {
+		return customerrors.NewInternalServerError("Failed to update persona")
+	}
+
+	config.DB.First(&persona, persona.ID)
+
+	return c.Status(200).JSON(fiber.Map{
+		"success": true,
+		"data":    toPersonaResp(persona),
+		"message": "Persona updated successfully",
+	})
+}
+
+// DelPersona deletes a persona; chats using it keep only their own system prompt
+func DelPersona(c *fiber.Ctx) error {
+	persona, err := ownedPersona(c)
+	if err != nil {
+		return err
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Chat{}).
+			Where("persona_id = ?", persona.ID).
+			Update("persona_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&persona).Error
+	})
+	if err != nil {
+		return customerrors.NewInternalServerError("Failed to delete persona")
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"success": true,
+		"message": "Persona deleted successfully",
+	})
+}
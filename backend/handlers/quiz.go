@@ -0,0 +1,476 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/MadMax168/Readsum/config"
+	"github.com/MadMax168/Readsum/customerrors"
+	"github.com/MadMax168/Readsum/models"
+	"github.com/MadMax168/Readsum/services"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Correct options and explanations are only revealed through graded attempts
+type OptionResp struct {
+	Index uint   `json:"index"`
+	Text  string `json:"text"`
+}
+
+// RubricItemResp outlines a rubric criterion before submission; its description
+// says what a good answer contains, so it is only shown with graded attempts
+type RubricItemResp struct {
+	Name      string  `json:"name"`
+	MaxPoints float64 `json:"max_points"`
+}
+
+func toRubricItems(rubric models.Rubric) []RubricItemResp {
+	var items []RubricItemResp
+	for _, c := range rubric {
+		items = append(items, RubricItemResp{Name: c.Name, MaxPoints: c.MaxPoints})
+	}
+	return items
+}
+
+type QuestionResp struct {
+	Index        uint             `json:"index"`
+	Type         string           `json:"type"`
+	Concept      string           `json:"concept,omitempty"`
+	Difficulty   string           `json:"difficulty"`
+	Verification string           `json:"verification"`
+	Prompt       string           `json:"prompt"`
+	Options      []OptionResp     `json:"options,omitempty"`
+	Rubric       []RubricItemResp `json:"rubric,omitempty"`
+}
+
+type QuizResp struct {
+	Index     uint           `json:"index"`
+	Title     string         `json:"title"`
+	Questions []QuestionResp `json:"questions,omitempty"`
+	CreatedAt string         `json:"created_at"`
+}
+
+func toQuizResp(quiz models.Quiz) QuizResp {
+	resp := QuizResp{
+		Index:     quiz.ID,
+		Title:     quiz.Title,
+		CreatedAt: quiz.CreatedAt.Format("2006-01-02 15:04:05"),
+	}
+
+	for _, q := range quiz.Questions {
+		question := QuestionResp{
+			Index:        q.ID,
+			Type:         q.Type,
+			Concept:      q.Concept,
+			Difficulty:   q.Difficulty,
+			Verification: q.Verification,
+			Prompt:       q.Prompt,
+			Rubric:       toRubricItems(q.Rubric),
+		}
+		for _, o := range q.Options {
+			question.Options = append(question.Options, OptionResp{
+				Index: o.ID,
+				Text:  o.Text,
+			})
+		}
+		resp.Questions = append(resp.Questions, question)
+	}
+
+	return resp
+}
+
+const (
+	defaultQuizQuestions = 5
+	maxQuizQuestions     = 20
+)
+
+type CreateQuizInput struct {
+	Title     string `json:"title"`
+	Questions int    `json:"questions"`
+	Type      string `json:"type"`
+}
+
+func (h *Handler) CreateQuiz(c *fiber.Ctx) error {
+	chat, err := ownedChat(c)
+	if err != nil {
+		return err
+	}
+
+	var input CreateQuizInput
+	if err := c.BodyParser(&input); err != nil {
+		return customerrors.NewBadRequestError("Invalid request body")
+	}
+
+	stats, err := conceptAccuracy(chat.ID, chat.UserID)
+	if err != nil {
+		return customerrors.NewInternalServerError("Database error")
+	}
+
+	// Reuse existing concept names so accuracy keeps adding up per concept
+	plan := &services.QuizPlan{}
+	for _, s := range stats {
+		plan.KnownConcepts = append(plan.KnownConcepts, s.Concept)
+	}
+
+	quiz, err := h.generateQuiz(chat, input, plan)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"success": true,
+		"data":    toQuizResp(quiz),
+		"message": "Quiz created successfully",
+	})
+}
+
+// generateQuiz validates the input, generates the questions from the chat's
+// material following plan, and saves the quiz
+func (h *Handler) generateQuiz(chat models.Chat, input CreateQuizInput, plan *services.QuizPlan) (models.Quiz, error) {
+	var quiz models.Quiz
+
+	if input.Questions == 0 {
+		input.Questions = defaultQuizQuestions
+	}
+	if input.Questions < 1 || input.Questions > maxQuizQuestions {
+		return quiz, customerrors.NewBadRequestError("Questions must be between 1 and 20")
+	}
+
+	input.Type = strings.ToLower(strings.TrimSpace(input.Type))
+	if input.Type == "" {
+		input.Type = models.QuestionMultipleChoice
+	}
+	if input.Type != models.QuestionMultipleChoice && input.Type != models.QuestionShortAnswer && input.Type != models.QuestionEssay {
+		return quiz, customerrors.NewBadRequestError("Type must be 'multiple_choice', 'short_answer' or 'essay'")
+	}
+
+	source, err := chatSource(chat.ID)
+	if err != nil {
+		return quiz, customerrors.NewInternalServerError("Database error")
+	}
+	if source == "" {
+		return quiz, customerrors.NewBadRequestError("Chat has no documents or messages to build a quiz from")
+	}
+
+	system, err := chatInstructions(chat)
+	if err != nil {
+		return quiz, customerrors.NewInternalServerError("Database error")
+	}
+
+	// Ask for a few spare questions to make up for the ones verification rejects
+	requested := input.Questions + max(1, input.Questions/4)
+
+	var generatedTitle string
+	var questions []models.Question
+	if input.Type == models.QuestionMultipleChoice {
+		generated, err := h.AI.GenerateQuiz(system, source, requested, plan)
+		if err != nil {
+			return quiz, customerrors.NewInternalServerError("Failed to generate quiz")
+		}
+		generatedTitle = generated.Title
+		questions = choiceQuestions(generated.Questions, requested)
+	} else {
+		generated, err := h.AI.GenerateFreeResponse(system, source, requested, input.Type == models.QuestionEssay, plan)
+		if err != nil {
+			return quiz, customerrors.NewInternalServerError("Failed to generate quiz")
+		}
+		generatedTitle = generated.Title
+		questions = freeResponseQuestions(generated.Questions, input.Type, requested)
+	}
+
+	existing, err := chatQuestionPrompts(chat.ID)
+	if err != nil {
+		return quiz, customerrors.NewInternalServerError("Database error")
+	}
+	questions, err = h.verifyQuestions(source, questions, existing, input.Questions)
+	if err != nil {
+		return quiz, customerrors.NewInternalServerError("Failed to verify generated questions")
+	}
+
+	if len(questions) == 0 {
+		return quiz, customerrors.NewInternalServerError("Model did not return any valid questions")
+	}
+
+	title := strings.TrimSpace(input.Title)
+	if title == "" {
+		title = strings.TrimSpace(generatedTitle)
+	}
+	if title == "" {
+		title = chat.Title + " Quiz"
+	}
+
+	quiz = models.Quiz{
+		Title:     title,
+		UserID:    chat.UserID,
+		ChatID:    chat.ID,
+		Questions: questions,
+	}
+
+	if err := config.DB.Create(&quiz).Error; err != nil {
+		return quiz, customerrors.NewInternalServerError("Failed to save quiz")
+	}
+
+	return quiz, nil
+}
+
+// chatQuestionPrompts lists the prompts of every question already asked in the chat's quizzes
+func chatQuestionPrompts(chatID uint) ([]string, error) {
+	var prompts []string
+	err := config.DB.Model(&models.Question{}).
+		Joins("JOIN quizzes ON quizzes.id = questions.quiz_id AND quizzes.deleted_at IS NULL").
+		Where("quizzes.chat_id = ?", chatID).
+		Pluck("questions.prompt", &prompts).Error
+	return prompts, err
+}
+
+// verifyAttempts is how often the verification call is tried before quiz generation fails
+const verifyAttempts = 3
+
+// verifyQuestions checks generated questions before they are saved. Duplicates of
+// each other or of existing prompts are dropped, and so are questions whose answer
+// the material does not support. Supported questions keep the passage backing
+// them; ambiguous ones, or ones whose passage cannot be found in the material,
+// are kept but flagged. Verified questions are preferred when trimming to limit.
+// A failed check is retried; if it keeps failing the questions are not saved,
+// since unchecked questions would reach quizzes and exams looking usable.
+func (h *Handler) verifyQuestions(source string, questions []models.Question, existing []string, limit int) ([]models.Question, error) {
+	var unique []models.Question
+	seen := existing
+	for _, q := range questions {
+		if services.IsDuplicate(q.Prompt, seen) {
+			continue
+		}
+		seen = append(seen, q.Prompt)
+		unique = append(unique, q)
+	}
+	if len(unique) == 0 {
+		return nil, nil
+	}
+
+	var items []services.VerifyItem
+	for _, q := range unique {
+		item := services.VerifyItem{Prompt: q.Prompt, Answer: q.ExpectedAnswer}
+		for _, o := range q.Options {
+			item.Options = append(item.Options, o.Text)
+			if o.IsCorrect {
+				item.Answer = o.Text
+			}
+		}
+		items = append(items, item)
+	}
+
+	var checks []services.QuestionCheck
+	var err error
+	for attempt := 0; attempt < verifyAttempts; attempt++ {
+		if checks, err = h.AI.VerifyQuestions(source, items); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var checked []models.Question
+	for i, q := range unique {
+		check := checks[i]
+		if !check.Supported {
+			continue
+		}
+
+		passage, found := services.FindPassage(source, check.Passage)
+		q.SourcePassage = passage
+		q.Verification = models.VerificationVerified
+		switch {
+		case check.Ambiguous:
+			q.Verification = models.VerificationFlagged
+			q.VerificationNote = strings.TrimSpace(check.Issue)
+		case !found:
+			q.SourcePassage = strings.TrimSpace(check.Passage)
+			q.Verification = models.VerificationFlagged
+			q.VerificationNote = "The supporting passage was not found word for word in the material"
+		}
+		checked = append(checked, q)
+	}
+
+	// Keep verified questions first, then the rest, in their original order
+	keep := make([]bool, len(checked))
+	kept := 0
+	for _, verified := range []bool{true, false} {
+		for i, q := range checked {
+			if kept < limit && !keep[i] && (q.Verification == models.VerificationVerified) == verified {
+				keep[i] = true
+				kept++
+			}
+		}
+	}
+
+	var result []models.Question
+	for i, q := range checked {
+		if keep[i] {
+			q.Position = len(result) + 1
+			result = append(result, q)
+		}
+	}
+	return result, nil
+}
+
+// normalizeDifficulty falls back to medium for labels the model made up
+func normalizeDifficulty(d string) string {
+	d = strings.ToLower(strings.TrimSpace(d))
+	if d != services.DifficultyEasy && d != services.DifficultyHard {
+		return services.DifficultyMedium
+	}
+	return d
+}
+
+// choiceQuestions keeps up to limit valid multiple-choice questions,
+// dropping invalid ones instead of failing the whole quiz
+func choiceQuestions(generated []services.GeneratedQuestion, limit int) []models.Question {
+	var questions []models.Question
+	for _, q := range generated {
+		if len(questions) == limit {
+			break
+		}
+		if err := services.ValidateQuestion(q); err != nil {
+			continue
+		}
+
+		question := models.Question{
+			Type:        models.QuestionMultipleChoice,
+			Prompt:      strings.TrimSpace(q.Prompt),
+			Explanation: strings.TrimSpace(q.Explanation),
+			Position:    len(questions) + 1,
+			Concept:     strings.TrimSpace(q.Concept),
+			Difficulty:  normalizeDifficulty(q.Difficulty),
+		}
+		for i, o := range q.Options {
+			question.Options = append(question.Options, models.Option{
+				Text:      strings.TrimSpace(o.Text),
+				IsCorrect: o.IsCorrect,
+				Position:  i + 1,
+			})
+		}
+		questions = append(questions, question)
+	}
+	return questions
+}
+
+// freeResponseQuestions keeps up to limit gradable short-answer or essay questions
+func freeResponseQuestions(generated []services.GeneratedFreeResponse, questionType string, limit int) []models.Question {
+	var questions []models.Question
+	for _, q := range generated {
+		if len(questions) == limit {
+			break
+		}
+		if err := services.ValidateFreeResponse(q); err != nil {
+			continue
+		}
+
+		question := models.Question{
+			Type:           questionType,
+			Prompt:         strings.TrimSpace(q.Prompt),
+			ExpectedAnswer: strings.TrimSpace(q.ExpectedAnswer),
+			Position:       len(questions) + 1,
+			Concept:        strings.TrimSpace(q.Concept),
+			Difficulty:     normalizeDifficulty(q.Difficulty),
+		}
+		for _, c := range q.Rubric {
+			question.Rubric = append(question.Rubric, models.RubricCriterion{
+				Name:        strings.TrimSpace(c.Name),
+				Description: strings.TrimSpace(c.Description),
+				MaxPoints:   c.MaxPoints,
+			})
+		}
+		questions = append(questions, question)
+	}
+	return questions
+}
+
+func GetQuizzes(c *fiber.Ctx) error {
+	chat, err := ownedChat(c)
+	if err != nil {
+		return err
+	}
+
+	var qxs []models.Quiz
+	if err := config.DB.Where("chat_id = ?", chat.ID).
+		Order("created_at DESC").
+		Find(&qxs).Error; err != nil {
+		return customerrors.NewInternalServerError("Database error")
+	}
+
+	var response []QuizResp
+	for _, q := range qxs {
+		response = append(response, toQuizResp(q))
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"success": true,
+		"data":    response,
+		"message": "Quizzes retrieved successfully",
+	})
+}
+
+// loadQuiz fetches a quiz of the chat with its questions and options in order
+func loadQuiz(chatID uint, quizID string) (models.Quiz, error) {
+	var quiz models.Quiz
+	err := config.DB.Where("id = ? AND chat_id = ?", quizID, chatID).
+		Preload("Questions", func(db *gorm.DB) *gorm.DB {
+			return db.Order("position ASC")
+		}).
+		Preload("Questions.Options", func(db *gorm.DB) *gorm.DB {
+			return db.Order("position ASC")
+		}).
+		First(&quiz).Error
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return quiz, customerrors.NewNotFoundError("Quiz not found")
+		}
+		return quiz, customerrors.NewInternalServerError("Database error")
+	}
+
+	return quiz, nil
+}
+
+func GetQuiz(c *fiber.Ctx) error {
+	chat, err := ownedChat(c)
+	if err != nil {
+		return err
+	}
+
+	quiz, err := loadQuiz(chat.ID, c.Params("quizID"))
+	if err != nil {
+		return err
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"success": true,
+		"data":    toQuizResp(quiz),
+		"message": "Quiz retrieved successfully",
+	})
+}
+
+func DelQuiz(c *fiber.Ctx) error {
+	chat, err := ownedChat(c)
+	if err != nil {
+		return err
+	}
+
+	var quiz models.Quiz
+	result := config.DB.Where("id = ? AND chat_id = ?", c.Params("quizID"), chat.ID).Delete(&quiz)
+
+	if result.Error != nil {
+		return customerrors.NewInternalServerError("Failed to delete quiz")
+	}
+
+	if result.RowsAffected == 0 {
+		return customerrors.NewNotFoundError("Quiz not found")
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"success": true,
+		"message": "Quiz deleted successfully",
+	})
+}
@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/MadMax168/Readsum/config"
+	"github.com/MadMax168/Readsum/llm"
+	"github.com/MadMax168/Readsum/models"
+	"github.com/MadMax168/Readsum/services"
+)
+
+const plantSource = "Plants make food in their leaves. They release oxygen into the air."
+
+// studyChat creates a chat whose only material is a message with plantSource
+func studyChat(t *testing.T) models.Chat {
+	t.Helper()
+
+	chat := testChat(t, models.ChatModeStandard)
+	message := models.Message{Text: plantSource, Role: "user", ChatID: chat.ID}
+	if err := appendMessage(&message); err != nil {
+		t.Fatal(err)
+	}
+	return chat
+}
+
+func TestCreateQuiz(t *testing.T) {
+	chat := studyChat(t)
+	fake := llm.NewFake(`{"title": "Plants", "questions": [
+		{"prompt": "Where do plants make their food?", "explanation": "", "concept": "photosynthesis", "difficulty": "easy",
+		 "options": [{"text": "In the roots", "is_correct": false}, {"text": "In the leaves", "is_correct": true}]},
+		{"prompt": "What colour is the sky?", "explanation": "", "concept": "weather", "difficulty": "easy",
+		 "options": [{"text": "Blue", "is_correct": false}, {"text": "Grey", "is_correct": false}]},
+		{"prompt": "Which gas do plants release?", "explanation": "", "concept": "photosynthesis", "difficulty": "extreme",
+		 "options": [{"text": "Oxygen", "is_correct": true}, {"text": "Carbon dioxide", "is_correct": false}]}
+	]}`, `{"checks": [
+		{"number": 1, "supported": true, "ambiguous": false, "passage": "Plants make food in their leaves.", "issue": ""},
+		{"number": 2, "supported": true, "ambiguous": false, "passage": "They release oxygen into the air.", "issue": ""}
+	]}`)
+	app := testApp(New(services.NewAI(fake)))
+
+	resp := send(t, app, chat, "POST", "/quizzes", CreateQuizInput{Questions: 2})
+	if resp.StatusCode != 201 {
+		t.Fatalf("status %d, want 201", resp.StatusCode)
+	}
+	var quiz QuizResp
+	decode(t, resp, &quiz)
+	if quiz.Title != "Plants" || len(quiz.Questions) != 2 {
+		t.Fatalf("quiz %q with %d questions, want Plants with the 2 valid ones", quiz.Title, len(quiz.Questions))
+	}
+	if q := quiz.Questions[1]; q.Prompt != "Which gas do plants release?" || q.Difficulty != services.DifficultyMedium {
+		t.Errorf("second question %q is %s, want the made-up difficulty replaced by medium", q.Prompt, q.Difficulty)
+	}
+
+	var saved []models.Question
+	config.DB.Where("quiz_id = ?", quiz.Index).Preload("Options").Order("position ASC").Find(&saved)
+	if len(saved) != 2 || saved[0].Position != 1 || saved[1].Position != 2 {
+		t.Fatalf("saved %d questions, want 2 numbered from 1", len(saved))
+	}
+	if o := saved[0].Options; len(o) != 2 || o[0].Position != 1 || !o[1].IsCorrect {
+		t.Errorf("options of the first question = %+v, want them in order with the second correct", o)
+	}
+}
+
+func TestCreateQuizWithoutMaterial(t *testing.T) {
+	chat := testChat(t, models.ChatModeStandard)
+	fake := llm.NewFake()
+	app := testApp(New(services.NewAI(fake)))
+
+	resp := send(t, app, chat, "POST", "/quizzes", CreateQuizInput{Questions: 2})
+	resp.Body.Close()
+	if resp.StatusCode == 201 {
+		t.Error("a quiz was created for a chat with nothing to build it from")
+	}
+	if len(fake.Requests) != 0 {
+		t.Errorf("made %d model calls for an empty chat", len(fake.Requests))
+	}
+}
+
+func TestCreateShortAnswerQuizAndGrade(t *testing.T) {
+	chat := studyChat(t)
+	fake := llm.NewFake(`{"title": "Plants", "questions": [
+		{"prompt": "Where do plants make their food?", "expected_answer": "In their leaves", "concept": "photosynthesis", "difficulty": "easy",
+		 "rubric": [{"name": "Place", "description": "Names the leaves", "max_points": 2}]}
+	]}`, `{"checks": [
+		{"number": 1, "supported": true, "ambiguous": false, "passage": "Plants make food in their leaves.", "issue": ""}
+	]}`, `{"criteria": [{"name": "Place", "points": 2, "feedback": "Correct"}], "feedback": "Well done", "rationale": "Names the leaves"}`)
+	app := testApp(New(services.NewAI(fake)))
+
+	resp := send(t, app, chat, "POST", "/quizzes", CreateQuizInput{Questions: 1, Type: models.QuestionShortAnswer})
+	var quiz QuizResp
+	decode(t, resp, &quiz)
+	if len(quiz.Questions) != 1 {
+		t.Fatalf("quiz has %d questions, want 1", len(quiz.Questions))
+	}
+	if rubric := quiz.Questions[0].Rubric; len(rubric) != 1 || rubric[0].Name != "Place" || rubric[0].MaxPoints != 2 {
+		t.Errorf("rubric outline = %+v", rubric)
+	}
+
+	q := quiz.Questions[0]
+	resp = send(t, app, chat, "POST", fmt.Sprintf("/quizzes/%d/attempts", quiz.Index), SubmitAttemptInput{
+		Answers: []SubmittedAnswer{{QuestionID: q.Index, Text: "In the leaves"}},
+	})
+	var attempt AttemptResp
+	decode(t, resp, &attempt)
+	if attempt.Score != 2 || attempt.MaxScore != 2 {
+		t.Errorf("scored %v of %v, want 2 of 2", attempt.Score, attempt.MaxScore)
+	}
+	answer := attempt.Answers[0]
+	if answer.GradingStatus != models.GradingGraded || answer.Feedback != "Well done" {
+		t.Errorf("answer is %s with feedback %q", answer.GradingStatus, answer.Feedback)
+	}
+	if len(answer.Rubric) != 1 || answer.Rubric[0].Description != "Names the leaves" {
+		t.Errorf("graded answer shows rubric %+v, want the full criteria", answer.Rubric)
+	}
+}
+
+func plantQuestions() []models.Question {
+	return []models.Question{
+		{Prompt: "Where do plants make their food?", Options: []models.Option{
+			{Text: "In the leaves", IsCorrect: true}, {Text: "In the roots"},
+		}},
+		{Prompt: "What colour is a ripe banana?", Options: []models.Option{
+			{Text: "Yellow", IsCorrect: true}, {Text: "Blue"},
+		}},
+		{Prompt: "Which gas do plants release?", Options: []models.Option{
+			{Text: "Oxygen", IsCorrect: true}, {Text: "Carbon dioxide"},
+		}},
+		{Prompt: "Where do plants make their own food?", Options: []models.Option{
+			{Text: "In the leaves", IsCorrect: true}, {Text: "In the stem"},
+		}},
+	}
+}
+
+// plantChecks supports the first question, rejects the second and finds the
+// third ambiguous; the fourth repeats the first and is never sent
+const plantChecks = `{"checks": [
+	{"number": 1, "supported": true, "ambiguous": false, "passage": "Plants make food in their leaves.", "issue": ""},
+	{"number": 2, "supported": false, "ambiguous": false, "passage": "", "issue": "Not in the material"},
+	{"number": 3, "supported": true, "ambiguous": true, "passage": "They release oxygen into the air.", "issue": "Both gases are exchanged"}
+]}`
+
+func TestVerifyQuestions(t *testing.T) {
+	fake := llm.NewFake(plantChecks)
+	h := New(services.NewAI(fake))
+
+	questions, err := h.verifyQuestions(plantSource, plantQuestions(), nil, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(questions) != 2 {
+		t.Fatalf("kept %d questions, want 2", len(questions))
+	}
+
+	first, second := questions[0], questions[1]
+	if first.Verification != models.VerificationVerified || first.SourcePassage != "Plants make food in their leaves." || first.Position != 1 {
+		t.Errorf("first question = %q (%s, passage %q, position %d), want it verified at position 1",
+			first.Prompt, first.Verification, first.SourcePassage, first.Position)
+	}
+	if second.Verification != models.VerificationFlagged || second.VerificationNote != "Both gases are exchanged" || second.Position != 2 {
+		t.Errorf("second question = %q (%s, note %q, position %d), want it flagged at position 2",
+			second.Prompt, second.Verification, second.VerificationNote, second.Position)
+	}
+}
+
+func TestVerifyQuestionsPrefersVerified(t *testing.T) {
+	fake := llm.NewFake(`{"checks": [
+		{"number": 1, "supported": true, "ambiguous": true, "passage": "Plants make food in their leaves.", "issue": "Unclear"},
+		{"number": 2, "supported": true, "ambiguous": false, "passage": "Bananas are yellow.", "issue": ""},
+		{"number": 3, "supported": true, "ambiguous": false, "passage": "They release oxygen into the air.", "issue": ""}
+	]}`)
+	h := New(services.NewAI(fake))
+
+	questions, err := h.verifyQuestions(plantSource, plantQuestions(), nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The second question's passage is not in the material, so only the third is verified
+	if len(questions) != 1 || questions[0].Prompt != "Which gas do plants release?" {
+		t.Fatalf("kept %v, want only the verified question", questions)
+	}
+}
+
+func TestVerifyQuestionsRetries(t *testing.T) {
+	fake := llm.NewFake("not json", plantChecks)
+	h := New(services.NewAI(fake))
+
+	questions, err := h.verifyQuestions(plantSource, plantQuestions(), nil, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(questions) != 2 {
+		t.Errorf("kept %d questions, want 2", len(questions))
+	}
+	if len(fake.Requests) != 2 {
+		t.Errorf("made %d model calls, want 2", len(fake.Requests))
+	}
+}
+
+func TestVerifyQuestionsFailsClosed(t *testing.T) {
+	fake := llm.NewFake("not json", "not json", "not json")
+	h := New(services.NewAI(fake))
+
+	questions, err := h.verifyQuestions(plantSource, plantQuestions(), nil, 10)
+	if err == nil {
+		t.Fatalf("kept %d unchecked questions, want an error", len(questions))
+	}
+	if len(fake.Requests) != verifyAttempts {
+		t.Errorf("made %d model calls, want %d", len(fake.Requests), verifyAttempts)
+	}
+}
+
+func TestVerifyQuestionsDropsExisting(t *testing.T) {
+	fake := llm.NewFake(`{"checks": [
+		{"number": 1, "supported": true, "ambiguous": false, "passage": "Bananas are yellow.", "issue": ""},
+		{"number": 2, "supported": true, "ambiguous": false, "passage": "They release oxygen into the air.", "issue": ""}
+	]}`)
+	h := New(services.NewAI(fake))
+
+	existing := []string{"Where do plants make their food?"}
+	questions, err := h.verifyQuestions(plantSource, plantQuestions(), existing, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range questions {
+		if q.Prompt == "Where do plants make their food?" || q.Prompt == "Where do plants make their own food?" {
+			t.Errorf("kept %q, which repeats an existing question", q.Prompt)
+		}
+	}
+	if len(questions) != 2 {
+		t.Errorf("kept %d questions, want 2", len(questions))
+	}
+}
+
+func TestVerifyQuestionsAllRepeated(t *testing.T) {
+	fake := llm.NewFake()
+	h := New(services.NewAI(fake))
+
+	existing := []string{"Where do plants make their food?", "What colour is a ripe banana?", "Which gas do plants release?"}
+	questions, err := h.verifyQuestions(plantSource, plantQuestions(), existing, 10)
+	if err != nil || len(questions) != 0 {
+		t.Fatalf("kept %d questions with error %v, want none and no error", len(questions), err)
+	}
+	if len(fake.Requests) != 0 {
+		t.Errorf("made %d model calls with nothing to verify", len(fake.Requests))
+	}
+}
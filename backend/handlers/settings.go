@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/MadMax168/Readsum/config"
+	"github.com/MadMax168/Readsum/customerrors"
+	"github.com/MadMax168/Readsum/models"
+	"github.com/MadMax168/Readsum/services"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Unset fields mean the server default applies
+type ModelSettingsResp struct {
+	Model           string   `json:"model,omitempty"`
+	Temperature     *float32 `json:"temperature,omitempty"`
+	TopP            *float32 `json:"top_p,omitempty"`
+	MaxOutputTokens *int     `json:"max_output_tokens,omitempty"`
+	Safety          string   `json:"safety,omitempty"`
+}
+
+func toModelSettingsResp(chat models.Chat) ModelSettingsResp {
+	return ModelSettingsResp{
+		Model:           chat.ModelName,
+		Temperature:     chat.Temperature,
+		TopP:            chat.TopP,
+		MaxOutputTokens: chat.MaxOutputTokens,
+		Safety:          chat.SafetyLevel,
+	}
+}
+
+// chatModelSettings are the settings the chat's replies are generated with
+func chatModelSettings(chat models.Chat) services.ModelSettings {
+	return services.ModelSettings{
+		Model:           chat.ModelName,
+		Temperature:     chat.Temperature,
+		TopP:            chat.TopP,
+		MaxOutputTokens: chat.MaxOutputTokens,
+		Safety:          chat.SafetyLevel,
+	}
+}
+
+// GetModelLimits lists the models and ranges chats may choose from, and the defaults
+func GetModelLimits(c *fiber.Ctx) error {
+	return c.Status(200).JSON(fiber.Map{
+		"success": true,
+		"data":    services.CurrentModelLimits(),
+		"message": "Model limits retrieved successfully",
+	})
+}
+
+type ModelSettingsInput struct {
+	Model           string   `json:"model"`
+	Temperature     *float32 `json:"temperature"`
+	TopP            *float32 `json:"top_p"`
+	MaxOutputTokens *int     `json:"max_output_tokens"`
+	Safety          string   `json:"safety"`
+}
+
+// UpdModelSettings replaces the chat's model settings; fields left out go back
+// to the server defaults
+func UpdModelSettings(c *fiber.Ctx) error {
+	chat, err := ownedChat(c)
+	if err != nil {
+		return err
+	}
+
+	var input ModelSettingsInput
+	if err := c.BodyParser(&input); err != nil {
+		return customerrors.NewBadRequestError("Invalid request body")
+	}
+
+	settings := services.ModelSettings{
+		Model:           strings.TrimSpace(input.Model),
+		Temperature:     input.Temperature,
+		TopP:            input.TopP,
+		MaxOutputTokens: input.MaxOutputTokens,
+		Safety:          strings.ToLower(strings.TrimSpace(input.Safety)),
+	}
+	if err := services.ValidateModelSettings(settings); err != nil {
+		return customerrors.NewBadRequestError(err.Error())
+	}
+
+	if err := config.DB.Model(&chat).Updates(map[string]interface{}{
+		"model_name":        settings.Model,
+		"temperature":       settings.Temperature,
+		"top_p":             settings.TopP,
+		"max_output_tokens": settings.MaxOutputTokens,
+		"safety_level":      settings.Safety,
+	}).Error; err != nil {
+		return customerrors.NewInternalServerError("Failed to update model settings")
+	}
+
+	config.DB.First(&chat, chat.ID)
+	return c.Status(200).JSON(fiber.Map{
+		"success": true,
+		"data":    toModelSettingsResp(chat),
+		"message": "Model settings updated successfully",
+	})
+}
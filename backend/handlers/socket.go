@@ -0,0 +1,345 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MadMax168/Readsum/config"
+	"github.com/MadMax168/Readsum/customerrors"
+	"github.com/MadMax168/Readsum/models"
+	"github.com/MadMax168/Readsum/realtime"
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	// Clients that miss pongs for this long are disconnected
+	pongWait = 60 * time.Second
+	// Pings are sent often enough to arrive well within pongWait
+	pingPeriod = 25 * time.Second
+	writeWait  = 10 * time.Second
+	// maxFrameBytes bounds a single client frame
+	maxFrameBytes = 64 * 1024
+)
+
+// socketFrame is a request from a client. Ref is echoed back on the replies.
+//
+//	subscribe    {chat_id}            receive the chat's events
+//	unsubscribe  {chat_id}
+//	resume       {chat_ids, last_seq} subscribe and replay events missed since last_seq
+//	send         {chat_id, text}      post a message; the reply streams back
+//	ping                              answered with pong
+type socketFrame struct {
+	Type    string `json:"type"`
+	Ref     string `json:"ref"`
+	ChatID  uint   `json:"chat_id"`
+	ChatIDs []uint `json:"chat_ids"`
+	LastSeq uint64 `json:"last_seq"`
+	Text    string `json:"text"`
+}
+
+// userChat loads a chat of the user
+func userChat(userID, chatID uint) (models.Chat, error) {
+	var chat models.Chat
+	if err := config.DB.Where("id = ? AND user_id = ?", chatID, userID).First(&chat).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return chat, customerrors.NewNotFoundError("Chat not found")
+		}
+		return chat, customerrors.NewInternalServerError("Database error")
+	}
+	return chat, nil
+}
+
+// socketSession is the server side of one WebSocket connection
+type socketSession struct {
+	h      *Handler
+	client *realtime.Client
+	ctx    context.Context
+	// replies tracks the streaming replies still running
+	replies sync.WaitGroup
+}
+
+func (s *socketSession) send(e realtime.Event) {
+	s.client.Send(e)
+}
+
+func (s *socketSession) fail(ref string, err error) {
+	s.send(realtime.Event{Type: "error", Ref: ref, Data: fiber.Map{"error": errorMessage(err)}})
+}
+
+func (s *socketSession) subscribe(ref string, chatID uint) bool {
+	if _, err := userChat(s.client.UserID, chatID); err != nil {
+		s.fail(ref, err)
+		return false
+	}
+	realtime.Default.Subscribe(s.client, chatID)
+	return true
+}
+
+func (s *socketSession) handle(frame socketFrame) {
+	switch frame.Type {
+	case "ping":
+		s.send(realtime.Event{Type: "pong", Ref: frame.Ref})
+
+	case "subscribe":
+		if s.subscribe(frame.Ref, frame.ChatID) {
+			s.send(realtime.Event{Type: "subscribed", ChatID: frame.ChatID, Ref: frame.Ref})
+		}
+
+	case "unsubscribe":
+		realtime.Default.Unsubscribe(s.client, frame.ChatID)
+		s.send(realtime.Event{Type: "unsubscribed", ChatID: frame.ChatID, Ref: frame.Ref})
+
+	case "resume":
+		chats := make(map[uint]bool)
+		for _, chatID := range frame.ChatIDs {
+			if s.subscribe(frame.Ref, chatID) {
+				chats[chatID] = true
+			}
+		}
+
+		events, ok := realtime.Default.Since(frame.LastSeq, chats)
+		if !ok {
+			// Too much was missed: the client reloads the chats over REST
+			s.send(realtime.Event{Type: "resync", Ref: frame.Ref, Data: fiber.Map{"seq": realtime.Default.Seq()}})
+			return
+		}
+		for _, e := range events {
+			s.send(e)
+		}
+		s.send(realtime.Event{Type: "resumed", Ref: frame.Ref, Data: fiber.Map{"seq": realtime.Default.Seq()}})
+
+	case "send":
+		s.sendMessage(frame)
+
+	default:
+		s.fail(frame.Ref, customerrors.NewBadRequestError("Unknown frame type"))
+	}
+}
+
+// sendMessage saves the user's message, which reaches the chat's subscribers
+// as a message.created event, and streams the reply back to this client
+func (s *socketSession) sendMessage(frame socketFrame) {
+	text := strings.TrimSpace(frame.Text)
+	if text == "" {
+		s.fail(frame.Ref, customerrors.NewBadRequestError("Message text cannot be empty"))
+		return
+	}
+
+	chat, err := userChat(s.client.UserID, frame.ChatID)
+	if err != nil {
+		s.fail(frame.Ref, err)
+		return
+	}
+	realtime.Default.Subscribe(s.client, chat.ID)
+
+	message := models.Message{
+		Text:   text,
+		Role:   "user",
+		ChatID: chat.ID,
+	}
+	if err := appendMessage(&message); err != nil {
+		s.fail(frame.Ref, customerrors.NewInternalServerError("Failed to create message"))
+		return
+	}
+
+	s.replies.Add(1)
+	go func() {
+		defer s.replies.Done()
+
+		reply, err := s.h.streamReply(s.ctx, chat, &message, func(chunk string) error {
+			if s.ctx.Err() != nil || !s.client.Send(realtime.Event{Type: "reply.delta", ChatID: chat.ID, Ref: frame.Ref, Data: fiber.Map{"text": chunk}}) {
+				return errClientGone
+			}
+			return nil
+		})
+		if errors.Is(err, errClientGone) {
+			return
+		}
+		if err != nil {
+			s.send(realtime.Event{Type: "reply.error", ChatID: chat.ID, Ref: frame.Ref, Data: fiber.Map{"error": errorMessage(err)}})
+			return
+		}
+		s.send(realtime.Event{Type: "reply.done", ChatID: chat.ID, Ref: frame.Ref, Data: toTextResp(*reply)})
+	}()
+}
+
+// writeSocket is the connection's only writer: it sends queued events and
+// pings until the client is closed
+func writeSocket(conn *websocket.Conn, client *realtime.Client) {
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case e, ok := <-client.Out:
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+				return
+			}
+			if err := conn.WriteJSON(e); err != nil {
+				// Unblocks the reader, which then cleans up
+				conn.Close()
+				client.Close()
+				return
+			}
+		case <-ticker.C:
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				conn.Close()
+				client.Close()
+				return
+			}
+		}
+	}
+}
+
+// ChatSocket is a WebSocket carrying several chats on one connection. After
+// connecting, the client gets a ready event with the current sequence number,
+// subscribes to chats (or resumes them after a reconnect) and receives their
+// events: message.created, message.updated, message.stale, branch.switched,
+// chat.updated and document.updated. Messages it
+// sends are answered with reply.delta events followed by reply.done or
+// reply.error. The server pings every 25 seconds and drops clients that stop
+// answering.
+func (h *Handler) ChatSocket(conn *websocket.Conn) {
+	userID, _ := conn.Locals("userID").(uint)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	session := &socketSession{
+		h:      h,
+		client: realtime.Default.Register(userID),
+		ctx:    ctx,
+	}
+
+	written := make(chan struct{})
+	go func() {
+		writeSocket(conn, session.client)
+		close(written)
+	}()
+
+	conn.SetReadLimit(maxFrameBytes)
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	session.send(realtime.Event{Type: "ready", Data: fiber.Map{"seq": realtime.Default.Seq()}})
+
+	for {
+		var frame socketFrame
+		if err := conn.ReadJSON(&frame); err != nil {
+			break
+		}
+		conn.SetReadDeadline(time.Now().Add(pongWait))
+		session.handle(frame)
+	}
+
+	// The connection is released when this returns, so wait for its users
+	cancel()
+	session.replies.Wait()
+	realtime.Default.Unregister(session.client)
+	<-written
+}
+
+// RegisterRealtimeCallbacks publishes every chat, message and document saved through
+// db to the chat's WebSocket subscribers, whichever endpoint saved it. Writes
+// made inside transaction are published once it commits.
+func RegisterRealtimeCallbacks(db *gorm.DB) {
+	db.Callback().Create().After("gorm:create").Register("realtime:after_create", func(tx *gorm.DB) {
+		publishChanges(tx, "created")
+	})
+	db.Callback().Update().After("gorm:update").Register("realtime:after_update", func(tx *gorm.DB) {
+		publishChanges(tx, "updated")
+	})
+}
+
+// eventsKey holds the *pendingEvents of a transaction in its context
+type eventsKey struct{}
+
+// pendingEvents are the realtime events of a transaction, held until it commits
+type pendingEvents struct {
+	events []realtime.Event
+}
+
+// publish sends an event to the chat's subscribers, or holds it until the
+// transaction db belongs to commits when it was started with transaction
+func publish(db *gorm.DB, chatID uint, eventType string, data interface{}) {
+	if pending, ok := db.Statement.Context.Value(eventsKey{}).(*pendingEvents); ok {
+		pending.events = append(pending.events, realtime.Event{Type: eventType, ChatID: chatID, Data: data})
+		return
+	}
+	realtime.Default.Publish(chatID, eventType, data)
+}
+
+// transaction runs fn in a database transaction. The realtime events of its
+// writes are published once it commits; a rolled back transaction publishes
+// nothing.
+func transaction(fn func(tx *gorm.DB) error) error {
+	pending := &pendingEvents{}
+	ctx := context.WithValue(context.Background(), eventsKey{}, pending)
+	if err := config.DB.WithContext(ctx).Transaction(fn); err != nil {
+		return err
+	}
+	for _, e := range pending.events {
+		realtime.Default.Publish(e.ChatID, e.Type, e.Data)
+	}
+	return nil
+}
+
+func publishChanges(tx *gorm.DB, action string) {
+	if tx.Error != nil || tx.Statement.Schema == nil || tx.RowsAffected == 0 {
+		return
+	}
+
+	rv := reflect.Indirect(tx.Statement.ReflectValue)
+	var values []interface{}
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			values = append(values, reflect.Indirect(rv.Index(i)).Interface())
+		}
+	case reflect.Struct:
+		values = append(values, rv.Interface())
+	}
+
+	// Updates through an empty model, such as Model(&models.Message{}).Where(...),
+	// have no ID and are not published here; their callers publish them
+	for _, v := range values {
+		switch m := v.(type) {
+		case models.Message:
+			// Partial updates may not have loaded the chat
+			if m.ChatID == 0 && m.ID != 0 {
+				tx.Session(&gorm.Session{NewDB: true}).First(&m, m.ID)
+			}
+			if m.ChatID != 0 {
+				publish(tx, m.ChatID, "message."+action, toTextResp(m))
+			}
+		case models.Chat:
+			// Chats are announced when they change, e.g. renamed from the
+			// conversation. Updates are applied to the loaded chat, so it is
+			// current without reading it back.
+			if action == "updated" && m.ID != 0 {
+				publish(tx, m.ID, "chat.updated", toChatResp(m))
+			}
+		case models.Document:
+			if m.ChatID == 0 && m.ID != 0 {
+				tx.Session(&gorm.Session{NewDB: true}).First(&m, m.ID)
+			}
+			if m.ChatID != 0 {
+				publish(tx, m.ChatID, "document.updated", fiber.Map{
+					"index":      m.ID,
+					"title":      m.Title,
+					"status":     m.Status,
+					"word_count": m.WordCount,
+				})
+			}
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/MadMax168/Readsum/customerrors"
+	"github.com/MadMax168/Readsum/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// writeEvent sends one Server-Sent Event. The flush fails once the client has gone.
+func writeEvent(w *bufio.Writer, event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// errClientGone means the client disconnected while the reply was streaming
+var errClientGone = errors.New("client disconnected")
+
+// streamReply generates and saves the assistant's answer to message, passing
+// the text to onChunk as it arrives. Tutor replies are structured, so they
+// arrive in one piece. If onChunk fails because the client has gone, the text
+// so far is saved as an incomplete reply and errClientGone is returned.
+func (h *Handler) streamReply(ctx context.Context, chat models.Chat, message *models.Message, onChunk func(string) error) (*models.Message, error) {
+	if chat.Mode == models.ChatModeTutor {
+		reply, _, err := h.tutorMessage(chat, message)
+		if err != nil {
+			var customErr *customerrors.CustomError
+			if errors.As(err, &customErr) {
+				return nil, err
+			}
+			return nil, customerrors.NewInternalServerError("Failed to generate reply")
+		}
+		if err := onChunk(reply.Text); err != nil {
+			return nil, errClientGone
+		}
+		return reply, nil
+	}
+
+	system, history, err := replyContext(chat, *message)
+	if err != nil {
+		return nil, customerrors.NewInternalServerError("Database error")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	disconnected := false
+	text, err := h.AI.StreamReply(ctx, chatModelSettings(chat), system, history, func(chunk string) error {
+		if err := onChunk(chunk); err != nil {
+			disconnected = true
+			return err
+		}
+		return nil
+	})
+
+	if disconnected {
+		if strings.TrimSpace(text) != "" {
+			if err := replyTo(*message, &models.Message{
+				Text:       text,
+				Role:       "assistant",
+				ChatID:     chat.ID,
+				Incomplete: true,
+			}, false); err != nil {
+				log.Printf("chat %d: failed to save incomplete reply: %v", chat.ID, err)
+			}
+		}
+		return nil, errClientGone
+	}
+	if err != nil {
+		return nil, customerrors.NewInternalServerError("Failed to generate reply")
+	}
+
+	reply := models.Message{
+		Text:   text,
+		Role:   "assistant",
+		ChatID: chat.ID,
+	}
+	if err := replyTo(*message, &reply, false); err != nil {
+		return nil, customerrors.NewInternalServerError("Failed to save reply")
+	}
+	go h.afterReply(chat.ID)
+	return &reply, nil
+}
+
+// errorMessage is the user-facing text of err
+func errorMessage(err error) string {
+	var customErr *customerrors.CustomError
+	if errors.As(err, &customErr) {
+		return customErr.Message
+	}
+	return "Internal server error"
+}
+
+type StreamMessageInput struct {
+	Text string `json:"text"`
+}
+
+// StreamMessage is PostMessage with the assistant's reply streamed as
+// Server-Sent Events:
+//
+//	message  the saved user message
+//	delta    {"text": "..."} for each piece of the reply
+//	done     the saved assistant message (terminal)
+//	error    {"error": "..."} when the reply fails (terminal)
+//
+// If the client disconnects mid-stream, the text received so far is saved as
+// an incomplete assistant message.
+func (h *Handler) StreamMessage(c *fiber.Ctx) error {
+	chat, err := ownedChat(c)
+	if err != nil {
+		return err
+	}
+
+	var input StreamMessageInput
+	if err := c.BodyParser(&input); err != nil {
+		return customerrors.NewBadRequestError("Invalid request body")
+	}
+
+	input.Text = strings.TrimSpace(input.Text)
+	if input.Text == "" {
+		return customerrors.NewBadRequestError("Message text cannot be empty")
+	}
+
+	message := models.Message{
+		Text:   input.Text,
+		Role:   "user",
+		ChatID: chat.ID,
+	}
+
+	if err := appendMessage(&message); err != nil {
+		return customerrors.NewInternalServerError("Failed to create message")
+	}
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no") // Stop nginx from buffering the stream
+
+	// The writer runs after the handler returns, so it must not touch c
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		if err := writeEvent(w, "message", toTextResp(message)); err != nil {
+			return
+		}
+
+		// The model call stops as soon as a write shows the client has gone
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		reply, err := h.streamReply(ctx, chat, &message, func(chunk string) error {
+			if err := writeEvent(w, "delta", fiber.Map{"text": chunk}); err != nil {
+				cancel()
+				return err
+			}
+			return nil
+		})
+		if errors.Is(err, errClientGone) {
+			return
+		}
+		if err != nil {
+			writeEvent(w, "error", fiber.Map{"error": errorMessage(err)})
+			return
+		}
+		writeEvent(w, "done", toTextResp(*reply))
+	})
+
+	return nil
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/MadMax168/Readsum/config"
+	"github.com/MadMax168/Readsum/llm"
+	"github.com/MadMax168/Readsum/models"
+	"github.com/MadMax168/Readsum/services"
+)
+
+type sseEvent struct {
+	Name string
+	Data string
+}
+
+func readEvents(t *testing.T, r *bufio.Reader) []sseEvent {
+	t.Helper()
+
+	var events []sseEvent
+	var current sseEvent
+	for {
+		line, err := r.ReadString('\n')
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			current.Name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			current.Data = strings.TrimPrefix(line, "data: ")
+		case line == "" && current.Name != "":
+			events = append(events, current)
+			current = sseEvent{}
+		}
+		if err != nil {
+			return events
+		}
+	}
+}
+
+func TestStreamMessage(t *testing.T) {
+	chat := testChat(t, models.ChatModeStandard)
+	fake := llm.NewFake("Plants make food from light")
+	app := testApp(New(services.NewAI(fake)))
+
+	resp := send(t, app, chat, "POST", "/messages/stream", StreamMessageInput{Text: "How do plants make food?"})
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("content type = %q, want text/event-stream", ct)
+	}
+
+	events := readEvents(t, bufio.NewReader(resp.Body))
+	if len(events) < 3 || events[0].Name != "message" || events[len(events)-1].Name != "done" {
+		t.Fatalf("events = %v, want message, deltas, done", events)
+	}
+
+	var streamed strings.Builder
+	for _, e := range events[1 : len(events)-1] {
+		if e.Name != "delta" {
+			t.Fatalf("got a %q event mid-stream", e.Name)
+		}
+		var delta struct {
+			Text string `json:"text"`
+		}
+		if err := json.Unmarshal([]byte(e.Data), &delta); err != nil {
+			t.Fatal(err)
+		}
+		streamed.WriteString(delta.Text)
+	}
+	if streamed.String() != "Plants make food from light" {
+		t.Errorf("deltas add up to %q", streamed.String())
+	}
+
+	var question, reply TextResp
+	if err := json.Unmarshal([]byte(events[0].Data), &question); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(events[len(events)-1].Data), &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply.Text != "Plants make food from light" || reply.ParentID == nil || *reply.ParentID != question.Index {
+		t.Errorf("done = %+v, want the full reply following message %d", reply, question.Index)
+	}
+
+	var saved models.Chat
+	config.DB.First(&saved, chat.ID)
+	if saved.LeafMessageID == nil || *saved.LeafMessageID != reply.Index {
+		t.Errorf("chat shows message %v, want the reply %d", saved.LeafMessageID, reply.Index)
+	}
+}
+
+func TestStreamReplySavesPartialReply(t *testing.T) {
+	chat := testChat(t, models.ChatModeStandard)
+	fake := llm.NewFake("Plants make food from light")
+	h := New(services.NewAI(fake))
+
+	message := models.Message{Text: "How do plants make food?", Role: "user", ChatID: chat.ID}
+	if err := appendMessage(&message); err != nil {
+		t.Fatal(err)
+	}
+
+	chunks := 0
+	_, err := h.streamReply(context.Background(), chat, &message, func(chunk string) error {
+		if chunks++; chunks == 3 {
+			return errors.New("broken pipe")
+		}
+		return nil
+	})
+	if !errors.Is(err, errClientGone) {
+		t.Fatalf("streamReply() error = %v, want errClientGone", err)
+	}
+
+	var partial models.Message
+	if err := config.DB.Where("parent_id = ?", message.ID).First(&partial).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !partial.Incomplete || partial.Text != "Plants make food " {
+		t.Errorf("saved %q (incomplete %v), want the text streamed before the client left", partial.Text, partial.Incomplete)
+	}
+}
+
+func TestStreamReplyUsesChatSettings(t *testing.T) {
+	chat := testChat(t, models.ChatModeStandard)
+	temperature := float32(0.1)
+	config.DB.Model(&chat).Updates(map[string]interface{}{"model_name": "small", "temperature": temperature, "max_output_tokens": 64})
+	config.DB.First(&chat, chat.ID)
+
+	fake := llm.NewFake("Light")
+	h := New(services.NewAI(fake))
+
+	message := models.Message{Text: "What do plants need?", Role: "user", ChatID: chat.ID}
+	if err := appendMessage(&message); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.streamReply(context.Background(), chat, &message, func(string) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	req := fake.Requests[0]
+	if req.Model != "small" || req.Temperature != temperature || req.MaxOutputTokens != 64 {
+		t.Errorf("reply used model %q at temperature %v with %d tokens, want the chat's settings", req.Model, req.Temperature, req.MaxOutputTokens)
+	}
+	if n := len(req.Messages); n == 0 || req.Messages[n-1].Text != "What do plants need?" {
+		t.Errorf("history = %v, want it to end with the new message", req.Messages)
+	}
+}
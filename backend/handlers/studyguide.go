@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/MadMax168/Readsum/config"
+	"github.com/MadMax168/Readsum/customerrors"
+	"github.com/MadMax168/Readsum/models"
+	"github.com/MadMax168/Readsum/services"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type StudyGuideResp struct {
+	Index     uint                 `json:"index"`
+	Title     string               `json:"title"`
+	Content   *services.StudyGuide `json:"content,omitempty"`
+	CreatedAt string               `json:"created_at"`
+}
+
+func toStudyGuideResp(guide models.StudyGuide, withContent bool) StudyGuideResp {
+	resp := StudyGuideResp{
+		Index:     guide.ID,
+		Title:     guide.Title,
+		CreatedAt: guide.CreatedAt.Format("2006-01-02 15:04:05"),
+	}
+	if withContent {
+		var content services.StudyGuide
+		if err := json.Unmarshal(guide.Content, &content); err == nil {
+			resp.Content = &content
+		}
+	}
+	return resp
+}
+
+type CreateStudyGuideInput struct {
+	Title string `json:"title"`
+}
+
+func (h *Handler) CreateStudyGuide(c *fiber.Ctx) error {
+	chat, err := ownedChat(c)
+	if err != nil {
+		return err
+	}
+
+	var input CreateStudyGuideInput
+	if err := c.BodyParser(&input); err != nil {
+		return customerrors.NewBadRequestError("Invalid request body")
+	}
+
+	documents, err := chatDocumentsText(chat.ID)
+	if err != nil {
+		return customerrors.NewInternalServerError("Database error")
+	}
+	conversation, err := chatConversationText(chat.ID)
+	if err != nil {
+		return customerrors.NewInternalServerError("Database error")
+	}
+	if documents == "" && conversation == "" {
+		return customerrors.NewBadRequestError("Chat has no documents or messages to build a study guide from")
+	}
+
+	system, err := chatInstructions(chat)
+	if err != nil {
+		return customerrors.NewInternalServerError("Database error")
+	}
+
+	generated, err := h.AI.GenerateStudyGuide(system, documents, conversation)
+	if err != nil {
+		return customerrors.NewInternalServerError("Failed to generate study guide")
+	}
+
+	if title := strings.TrimSpace(input.Title); title != "" {
+		generated.Title = title
+	}
+	if strings.TrimSpace(generated.Title) == "" {
+		generated.Title = chat.Title + " Study Guide"
+	}
+
+	content, err := json.Marshal(generated)
+	if err != nil {
+		return customerrors.NewInternalServerError("Failed to save study guide")
+	}
+
+	guide := models.StudyGuide{
+		Title:   generated.Title,
+		Content: content,
+		UserID:  chat.UserID,
+		ChatID:  chat.ID,
+	}
+
+	if err := config.DB.Create(&guide).Error; err != nil {
+		return customerrors.NewInternalServerError("Failed to save study guide")
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"success": true,
+		"data":    toStudyGuideResp(guide, true),
+		"message": "Study guide created successfully",
+	})
+}
+
+func GetStudyGuides(c *fiber.Ctx) error {
+	chat, err := ownedChat(c)
+	if err != nil {
+		return err
+	}
+
+	var gxs []models.StudyGuide
+	if err := config.DB.Where("chat_id = ?", chat.ID).
+		Omit("content").
+		Order("created_at DESC").
+		Find(&gxs).Error; err != nil {
+		return customerrors.NewInternalServerError("Database error")
+	}
+
+	var response []StudyGuideResp
+	for _, g := range gxs {
+		response = append(response, toStudyGuideResp(g, false))
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"success": true,
+		"data":    response,
+		"message": "Study guides retrieved successfully",
+	})
+}
+
+func loadStudyGuide(c *fiber.Ctx) (models.StudyGuide, error) {
+	var guide models.StudyGuide
+
+	chat, err := ownedChat(c)
+	if err != nil {
+		return guide, err
+	}
+
+	if err := config.DB.Where("id = ? AND chat_id = ?", c.Params("guideID"), chat.ID).First(&guide).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return guide, customerrors.NewNotFoundError("Study guide not found")
+		}
+		return guide, customerrors.NewInternalServerError("Database error")
+	}
+
+	return guide, nil
+}
+
+func GetStudyGuide(c *fiber.Ctx) error {
+	guide, err := loadStudyGuide(c)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"success": true,
+		"data":    toStudyGuideResp(guide, true),
+		"message": "Study guide retrieved successfully",
+	})
+}
+
+func DelStudyGuide(c *fiber.Ctx) error {
+	chat, err := ownedChat(c)
+	if err != nil {
+		return err
+	}
+
+	var guide models.StudyGuide
+	result := config.DB.Where("id = ? AND chat_id = ?", c.Params("guideID"), chat.ID).Delete(&guide)
+
+	if result.Error != nil {
+		return customerrors.NewInternalServerError("Failed to delete study guide")
+	}
+
+	if result.RowsAffected == 0 {
+		return customerrors.NewNotFoundError("Study guide not found")
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"success": true,
+		"message": "Study guide deleted successfully",
+	})
+}
+
+// ExportStudyGuide renders the guide as ?format=markdown (default), html or pdf
+func ExportStudyGuide(c *fiber.Ctx) error {
+	guide, err := loadStudyGuide(c)
+	if err != nil {
+		return err
+	}
+
+	var content services.StudyGuide
+	if err := json.Unmarshal(guide.Content, &content); err != nil {
+		return customerrors.NewInternalServerError("Study guide content is corrupted")
+	}
+
+	var buf bytes.Buffer
+	var contentType, ext string
+
+	switch strings.ToLower(c.Query("format", "markdown")) {
+	case "markdown", "md":
+		buf.WriteString(services.RenderMarkdown(content))
+		contentType, ext = "text/markdown; charset=utf-8", "md"
+	case "html":
+		if err := services.RenderHTML(content, &buf); err != nil {
+			return customerrors.NewInternalServerError("Failed to render study guide")
+		}
+		contentType, ext = fiber.MIMETextHTMLCharsetUTF8, "html"
+	case "pdf":
+		if err := services.RenderPDF(content, &buf); err != nil {
+			if errors.Is(err, services.ErrPDFFontRequired) {
+				return customerrors.NewBadRequestError("PDF export is not available for this language on this server; download the study guide as Markdown or HTML instead")
+			}
+			return customerrors.NewInternalServerError("Failed to render study guide")
+		}
+		contentType, ext = "application/pdf", "pdf"
+	default:
+		return customerrors.NewBadRequestError("Format must be 'markdown', 'html' or 'pdf'")
+	}
+
+	c.Set(fiber.HeaderContentType, contentType)
+	setAttachment(c, guide.Title, "study_guide", ext)
+	return c.Status(200).Send(buf.Bytes())
+}
@@ -0,0 +1,431 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/MadMax168/Readsum/config"
+	"github.com/MadMax168/Readsum/customerrors"
+	"github.com/MadMax168/Readsum/models"
+	"github.com/MadMax168/Readsum/services"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type StudyPlanItemResp struct {
+	Index       uint   `json:"index"`
+	Date        string `json:"date"`
+	Kind        string `json:"kind"`
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Minutes     int    `json:"minutes"`
+	DocumentID  *uint  `json:"document_id,omitempty"`
+	Concept     string `json:"concept,omitempty"`
+	Completed   bool   `json:"completed"`
+	CompletedAt string `json:"completed_at,omitempty"`
+}
+
+type StudyPlanResp struct {
+	Index            uint                `json:"index"`
+	Title            string              `json:"title"`
+	ExamDate         string              `json:"exam_date"`
+	DailyMinutes     int                 `json:"daily_minutes"`
+	FeedURL          string              `json:"feed_url"`
+	TotalItems       int                 `json:"total_items"`
+	CompletedItems   int                 `json:"completed_items"`
+	TotalMinutes     int                 `json:"total_minutes"`
+	CompletedMinutes int                 `json:"completed_minutes"`
+	Items            []StudyPlanItemResp `json:"items,omitempty"`
+	CreatedAt        string              `json:"created_at"`
+}
+
+func toStudyPlanItemResp(item models.StudyPlanItem) StudyPlanItemResp {
+	resp := StudyPlanItemResp{
+		Index:       item.ID,
+		Date:        item.Date.Format("2006-01-02"),
+		Kind:        item.Kind,
+		Title:       item.Title,
+		Description: item.Description,
+		Minutes:     item.Minutes,
+		DocumentID:  item.DocumentID,
+		Concept:     item.Concept,
+		Completed:   item.CompletedAt != nil,
+	}
+	if item.CompletedAt != nil {
+		resp.CompletedAt = item.CompletedAt.Format("2006-01-02 15:04:05")
+	}
+	return resp
+}
+
+// studyPlanFeedURL is the public calendar subscription address of a plan
+func studyPlanFeedURL(c *fiber.Ctx, plan models.StudyPlan) string {
+	return c.BaseURL() + "/api/v1/study-plans/feed/" + plan.FeedToken + ".ics"
+}
+
+func toStudyPlanResp(c *fiber.Ctx, plan models.StudyPlan, withItems bool) StudyPlanResp {
+	resp := StudyPlanResp{
+		Index:        plan.ID,
+		Title:        plan.Title,
+		ExamDate:     plan.ExamDate.Format("2006-01-02"),
+		DailyMinutes: plan.DailyMinutes,
+		FeedURL:      studyPlanFeedURL(c, plan),
+		TotalItems:   len(plan.Items),
+		CreatedAt:    plan.CreatedAt.Format("2006-01-02 15:04:05"),
+	}
+	for _, item := range plan.Items {
+		resp.TotalMinutes += item.Minutes
+		if item.CompletedAt != nil {
+			resp.CompletedItems++
+			resp.CompletedMinutes += item.Minutes
+		}
+		if withItems {
+			resp.Items = append(resp.Items, toStudyPlanItemResp(item))
+		}
+	}
+	return resp
+}
+
+const (
+	defaultDailyMinutes = 60
+	minDailyMinutes     = 15
+	maxDailyMinutes     = 600
+	maxPlanDays         = 365
+)
+
+type CreateStudyPlanInput struct {
+	Title        string `json:"title"`
+	ExamDate     string `json:"exam_date"`
+	DailyMinutes int    `json:"daily_minutes"`
+	DocumentIDs  []uint `json:"document_ids"`
+}
+
+// CreateStudyPlan schedules the chat's documents (or document_ids) from today up
+// to exam_date, sized by document length and the student's current mastery
+func CreateStudyPlan(c *fiber.Ctx) error {
+	chat, err := ownedChat(c)
+	if err != nil {
+		return err
+	}
+
+	var input CreateStudyPlanInput
+	if err := c.BodyParser(&input); err != nil {
+		return customerrors.NewBadRequestError("Invalid request body")
+	}
+
+	examDate, err := time.Parse("2006-01-02", input.ExamDate)
+	if err != nil {
+		return customerrors.NewBadRequestError("Exam date must be in YYYY-MM-DD format")
+	}
+	today := services.CalendarDay(time.Now())
+	if !examDate.After(today) {
+		return customerrors.NewBadRequestError("Exam date must be after today")
+	}
+	if examDate.After(today.AddDate(0, 0, maxPlanDays)) {
+		return customerrors.NewBadRequestError("Exam date must be within a year")
+	}
+
+	if input.DailyMinutes == 0 {
+		input.DailyMinutes = defaultDailyMinutes
+	}
+	if input.DailyMinutes < minDailyMinutes || input.DailyMinutes > maxDailyMinutes {
+		return customerrors.NewBadRequestError("Daily minutes must be between 15 and 600")
+	}
+
+	query := config.DB.Where("chat_id = ?", chat.ID)
+	if len(input.DocumentIDs) > 0 {
+		query = query.Where("id IN ?", input.DocumentIDs)
+	}
+	var dxs []models.Document
+	if err := query.Order("upload_date ASC, id ASC").Find(&dxs).Error; err != nil {
+		return customerrors.NewInternalServerError("Database error")
+	}
+	if len(input.DocumentIDs) > 0 && len(dxs) != len(input.DocumentIDs) {
+		return customerrors.NewNotFoundError("Document not found")
+	}
+
+	var docs []services.PlanDocument
+	for _, d := range dxs {
+		words := d.WordCount
+		if words == 0 {
+			words = len(strings.Fields(d.RawText))
+		}
+		docs = append(docs, services.PlanDocument{ID: d.ID, Title: d.Title, Words: words})
+	}
+
+	events, err := masteryEvents(chat.UserID, &chat.ID)
+	if err != nil {
+		return customerrors.NewInternalServerError("Database error")
+	}
+
+	if len(docs) == 0 && len(events) == 0 {
+		return customerrors.NewBadRequestError("Chat has no documents or practice history to plan from")
+	}
+
+	planned, warnings := services.BuildStudyPlan(services.PlanInput{
+		Start:        today,
+		ExamDate:     examDate,
+		DailyMinutes: input.DailyMinutes,
+		Documents:    docs,
+		Concepts:     services.ComputeMastery(events, time.Now()),
+	})
+
+	token, err := randomToken()
+	if err != nil {
+		return customerrors.NewInternalServerError("Failed to create study plan")
+	}
+
+	title := strings.TrimSpace(input.Title)
+	if title == "" {
+		title = chat.Title + " Study Plan"
+	}
+
+	plan := models.StudyPlan{
+		Title:        title,
+		ExamDate:     examDate,
+		DailyMinutes: input.DailyMinutes,
+		FeedToken:    token,
+		UserID:       chat.UserID,
+		ChatID:       chat.ID,
+	}
+	for i, p := range planned {
+		plan.Items = append(plan.Items, models.StudyPlanItem{
+			Date:        p.Date,
+			Kind:        p.Kind,
+			Title:       p.Title,
+			Description: p.Description,
+			Minutes:     p.Minutes,
+			DocumentID:  p.DocumentID,
+			Concept:     p.Concept,
+			Position:    i,
+		})
+	}
+
+	if err := config.DB.Create(&plan).Error; err != nil {
+		return customerrors.NewInternalServerError("Failed to save study plan")
+	}
+
+	if warnings == nil {
+		warnings = []string{}
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"success": true,
+		"data": fiber.Map{
+			"plan":     toStudyPlanResp(c, plan, true),
+			"warnings": warnings,
+		},
+		"message": "Study plan created successfully",
+	})
+}
+
+func GetStudyPlans(c *fiber.Ctx) error {
+	chat, err := ownedChat(c)
+	if err != nil {
+		return err
+	}
+
+	var pxs []models.StudyPlan
+	if err := config.DB.Where("chat_id = ?", chat.ID).
+		Preload("Items").
+		Order("created_at DESC").
+		Find(&pxs).Error; err != nil {
+		return customerrors.NewInternalServerError("Database error")
+	}
+
+	var response []StudyPlanResp
+	for _, p := range pxs {
+		response = append(response, toStudyPlanResp(c, p, false))
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"success": true,
+		"data":    response,
+		"message": "Study plans retrieved successfully",
+	})
+}
+
+func preloadPlanItems(db *gorm.DB) *gorm.DB {
+	return db.Order("date ASC, position ASC")
+}
+
+// ownedStudyPlan loads the plan from the planID parameter of the current chat
+func ownedStudyPlan(c *fiber.Ctx) (models.StudyPlan, error) {
+	var plan models.StudyPlan
+
+	chat, err := ownedChat(c)
+	if err != nil {
+		return plan, err
+	}
+
+	if err := config.DB.Where("id = ? AND chat_id = ?", c.Params("planID"), chat.ID).
+		Preload("Items", preloadPlanItems).
+		First(&plan).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return plan, customerrors.NewNotFoundError("Study plan not found")
+		}
+		return plan, customerrors.NewInternalServerError("Database error")
+	}
+
+	return plan, nil
+}
+
+func GetStudyPlan(c *fiber.Ctx) error {
+	plan, err := ownedStudyPlan(c)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"success": true,
+		"data":    toStudyPlanResp(c, plan, true),
+		"message": "Study plan retrieved successfully",
+	})
+}
+
+func DelStudyPlan(c *fiber.Ctx) error {
+	chat, err := ownedChat(c)
+	if err != nil {
+		return err
+	}
+
+	var plan models.StudyPlan
+	result := config.DB.Where("id = ? AND chat_id = ?", c.Params("planID"), chat.ID).Delete(&plan)
+
+	if result.Error != nil {
+		return customerrors.NewInternalServerError("Failed to delete study plan")
+	}
+
+	if result.RowsAffected == 0 {
+		return customerrors.NewNotFoundError("Study plan not found")
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"success": true,
+		"message": "Study plan deleted successfully",
+	})
+}
+
+type UpdPlanItemInput struct {
+	Completed *bool `json:"completed"`
+}
+
+// UpdStudyPlanItem marks a plan item as done or not done
+func UpdStudyPlanItem(c *fiber.Ctx) error {
+	plan, err := ownedStudyPlan(c)
+	if err != nil {
+		return err
+	}
+
+	var input UpdPlanItemInput
+	if err := c.BodyParser(&input); err != nil {
+		return customerrors.NewBadRequestError("Invalid request body")
+	}
+	if input.Completed == nil {
+		return customerrors.NewBadRequestError("Completed is required")
+	}
+
+	var item models.StudyPlanItem
+	if err := config.DB.Where("id = ? AND study_plan_id = ?", c.Params("itemID"), plan.ID).First(&item).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return customerrors.NewNotFoundError("Plan item not found")
+		}
+		return customerrors.NewInternalServerError("Database error")
+	}
+
+	item.CompletedAt = nil
+	if *input.Completed {
+		now := time.Now()
+		item.CompletedAt = &now
+	}
+
+	if err := config.DB.Model(&item).Update("completed_at", item.CompletedAt).Error; err != nil {
+		return customerrors.NewInternalServerError("Failed to update plan item")
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"success": true,
+		"data":    toStudyPlanItemResp(item),
+		"message": "Plan item updated successfully",
+	})
+}
+
+// studyPlanICS renders a plan as an iCalendar feed; completed items are ticked
+func studyPlanICS(plan models.StudyPlan) string {
+	var events []services.CalendarEvent
+	for _, item := range plan.Items {
+		summary := item.Title
+		if item.Minutes > 0 {
+			summary = fmt.Sprintf("%s (%d min)", summary, item.Minutes)
+		}
+		if item.CompletedAt != nil {
+			summary = "✓ " + summary
+		}
+		events = append(events, services.CalendarEvent{
+			UID:         fmt.Sprintf("plan-%d-item-%d@readsum", plan.ID, item.ID),
+			Date:        item.Date,
+			Summary:     summary,
+			Description: item.Description,
+		})
+	}
+	return services.RenderICS(plan.Title, events, time.Now())
+}
+
+// ExportStudyPlan downloads the plan as an .ics file
+func ExportStudyPlan(c *fiber.Ctx) error {
+	plan, err := ownedStudyPlan(c)
+	if err != nil {
+		return err
+	}
+
+	c.Set(fiber.HeaderContentType, "text/calendar; charset=utf-8")
+	setAttachment(c, plan.Title, "study_plan", "ics")
+	return c.Status(200).SendString(studyPlanICS(plan))
+}
+
+// RotateStudyPlanFeed replaces the feed token, revoking the old subscription URL
+func RotateStudyPlanFeed(c *fiber.Ctx) error {
+	plan, err := ownedStudyPlan(c)
+	if err != nil {
+		return err
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return customerrors.NewInternalServerError("Failed to rotate feed URL")
+	}
+
+	if err := config.DB.Model(&plan).Update("feed_token", token).Error; err != nil {
+		return customerrors.NewInternalServerError("Failed to rotate feed URL")
+	}
+	plan.FeedToken = token
+
+	return c.Status(200).JSON(fiber.Map{
+		"success": true,
+		"data":    toStudyPlanResp(c, plan, false),
+		"message": "Feed URL rotated successfully",
+	})
+}
+
+// StudyPlanFeed serves the calendar subscription feed. Calendar apps cannot send
+// a bearer token, so the unguessable token in the URL is the credential.
+func StudyPlanFeed(c *fiber.Ctx) error {
+	token := strings.TrimSuffix(c.Params("token"), ".ics")
+	if token == "" {
+		return customerrors.NewNotFoundError("Feed not found")
+	}
+
+	var plan models.StudyPlan
+	if err := config.DB.Where("feed_token = ?", token).
+		Preload("Items", preloadPlanItems).
+		First(&plan).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return customerrors.NewNotFoundError("Feed not found")
+		}
+		return customerrors.NewInternalServerError("Database error")
+	}
+
+	c.Set(fiber.HeaderContentType, "text/calendar; charset=utf-8")
+	return c.Status(200).SendString(studyPlanICS(plan))
+}
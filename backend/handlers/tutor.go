@@ -0,0 +1,378 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/MadMax168/Readsum/config"
+	"github.com/MadMax168/Readsum/customerrors"
+	"github.com/MadMax168/Readsum/models"
+	"github.com/MadMax168/Readsum/services"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// A step's answer is only shown once the student has solved it or the session is over
+type TutorStepResp struct {
+	Index       uint   `json:"index"`
+	Position    int    `json:"position"`
+	Description string `json:"description"`
+	Status      string `json:"status"`
+	Attempts    int    `json:"attempts"`
+	Answer      string `json:"answer,omitempty"`
+	SolvedAt    string `json:"solved_at,omitempty"`
+}
+
+type TutorSessionResp struct {
+	Index       uint            `json:"index"`
+	Problem     string          `json:"problem"`
+	Goal        string          `json:"goal"`
+	Status      string          `json:"status"`
+	SolvedSteps int             `json:"solved_steps"`
+	TotalSteps  int             `json:"total_steps"`
+	Steps       []TutorStepResp `json:"steps,omitempty"`
+	Summary     string          `json:"summary,omitempty"`
+	CreatedAt   string          `json:"created_at"`
+	EndedAt     string          `json:"ended_at,omitempty"`
+}
+
+func toTutorSessionResp(session models.TutorSession) TutorSessionResp {
+	resp := TutorSessionResp{
+		Index:      session.ID,
+		Problem:    session.Problem,
+		Goal:       session.Goal,
+		Status:     session.Status,
+		TotalSteps: len(session.Steps),
+		Summary:    session.Summary,
+		CreatedAt:  session.CreatedAt.Format("2006-01-02 15:04:05"),
+	}
+	if session.EndedAt != nil {
+		resp.EndedAt = session.EndedAt.Format("2006-01-02 15:04:05")
+	}
+
+	for _, s := range session.Steps {
+		step := TutorStepResp{
+			Index:       s.ID,
+			Position:    s.Position,
+			Description: s.Description,
+			Status:      s.Status,
+			Attempts:    s.Attempts,
+		}
+		if s.Status == models.StepSolved || session.Status == models.TutorCompleted {
+			step.Answer = s.Answer
+		}
+		if s.SolvedAt != nil {
+			resp.SolvedSteps++
+			step.SolvedAt = s.SolvedAt.Format("2006-01-02 15:04:05")
+		}
+		resp.Steps = append(resp.Steps, step)
+	}
+
+	return resp
+}
+
+func preloadTutorSteps(db *gorm.DB) *gorm.DB {
+	return db.Order("position ASC")
+}
+
+func tutorStepStates(steps []models.TutorStep) []services.TutorStepState {
+	var states []services.TutorStepState
+	for _, s := range steps {
+		states = append(states, services.TutorStepState{
+			Description: s.Description,
+			Answer:      s.Answer,
+			Attempts:    s.Attempts,
+			Solved:      s.Status == models.StepSolved,
+		})
+	}
+	return states
+}
+
+// tutorTranscript renders the session's messages before beforeID (all when 0),
+// without stale ones
+func tutorTranscript(sessionID, beforeID uint) (string, error) {
+	query := config.DB.Where("tutor_session_id = ? AND NOT stale", sessionID)
+	if beforeID != 0 {
+		query = query.Where("id < ?", beforeID)
+	}
+
+	var mxs []models.Message
+	if err := query.Order("created_at ASC, id ASC").Find(&mxs).Error; err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, m := range mxs {
+		b.WriteString(m.Role + ": " + m.Text + "\n")
+	}
+	return truncateSource(b.String()), nil
+}
+
+// tutorMessage answers a student's message in a tutor-mode chat. The first
+// message opens a session whose problem is split into sub-steps; later messages
+// continue it, recording attempted and solved steps. Once every step is solved
+// the session is closed with a summary.
+func (h *Handler) tutorMessage(chat models.Chat, message *models.Message) (*models.Message, *models.TutorSession, error) {
+	source, err := chatDocumentsText(chat.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	system, err := chatInstructions(chat)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var session models.TutorSession
+	err = config.DB.Where("chat_id = ? AND status = ?", chat.ID, models.TutorActive).
+		Preload("Steps", preloadTutorSteps).
+		Order("created_at DESC").
+		First(&session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		plan, err := h.AI.PlanTutorSession(chatModelSettings(chat), system, message.Text, source)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		session = models.TutorSession{
+			Problem: message.Text,
+			Goal:    strings.TrimSpace(plan.Goal),
+			Status:  models.TutorActive,
+			UserID:  chat.UserID,
+			ChatID:  chat.ID,
+		}
+		for i, s := range plan.Steps {
+			session.Steps = append(session.Steps, models.TutorStep{
+				Position:    i + 1,
+				Description: s.Description,
+				Answer:      s.Answer,
+				Status:      models.StepPending,
+			})
+		}
+		if err := config.DB.Create(&session).Error; err != nil {
+			return nil, nil, err
+		}
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	if err := config.DB.Model(message).Update("tutor_session_id", session.ID).Error; err != nil {
+		return nil, nil, err
+	}
+	message.TutorSessionID = &session.ID
+
+	transcript, err := tutorTranscript(session.ID, message.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	turn, err := h.AI.TutorReply(chatModelSettings(chat), system, session.Problem, source, tutorStepStates(session.Steps), transcript, message.Text)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	attempted := make(map[int]bool)
+	solved := make(map[int]bool)
+	for _, n := range turn.AttemptedSteps {
+		attempted[n] = true
+	}
+	for _, n := range turn.SolvedSteps {
+		attempted[n] = true
+		solved[n] = true
+	}
+
+	// Steps only move while the session is active; it may have been ended
+	// while the model was answering
+	active := config.DB.Model(&models.TutorSession{}).Select("id").
+		Where("id = ? AND status = ?", session.ID, models.TutorActive)
+
+	now := time.Now()
+	allSolved := true
+	for i := range session.Steps {
+		step := &session.Steps[i]
+		if step.Status != models.StepSolved && attempted[step.Position] {
+			step.Attempts++
+			step.Status = models.StepAttempted
+			if solved[step.Position] {
+				step.Status = models.StepSolved
+				step.SolvedAt = &now
+			}
+			result := config.DB.Model(step).
+				Where("tutor_session_id IN (?)", active).
+				Updates(map[string]interface{}{
+					"attempts":  step.Attempts,
+					"status":    step.Status,
+					"solved_at": step.SolvedAt,
+				})
+			if result.Error != nil {
+				return nil, nil, result.Error
+			}
+			if result.RowsAffected == 0 {
+				return nil, nil, customerrors.NewConflictError("Tutor session has already ended")
+			}
+		}
+		if step.Status != models.StepSolved {
+			allSolved = false
+		}
+	}
+
+	reply := models.Message{
+		Text:           strings.TrimSpace(turn.Reply),
+		Role:           "assistant",
+		ChatID:         chat.ID,
+		TutorSessionID: &session.ID,
+	}
+	if err := replyTo(*message, &reply, false); err != nil {
+		return nil, nil, err
+	}
+	go h.afterReply(chat.ID)
+
+	// The reply is already saved; if the summary fails the session stays
+	// active and the student can end it explicitly
+	if allSolved {
+		if err := h.finishTutorSession(chat, &session); err != nil {
+			log.Printf("tutor session %d: failed to finish: %v", session.ID, err)
+		}
+	}
+
+	return &reply, &session, nil
+}
+
+// finishTutorSession closes an active session and posts its summary to the chat
+func (h *Handler) finishTutorSession(chat models.Chat, session *models.TutorSession) error {
+	transcript, err := tutorTranscript(session.ID, 0)
+	if err != nil {
+		return err
+	}
+
+	system, err := chatInstructions(chat)
+	if err != nil {
+		return err
+	}
+
+	summary, err := h.AI.SummarizeTutorSession(chatModelSettings(chat), system, session.Problem, tutorStepStates(session.Steps), transcript)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	result := config.DB.Model(&models.TutorSession{}).
+		Where("id = ? AND status = ?", session.ID, models.TutorActive).
+		Updates(map[string]interface{}{
+			"status":   models.TutorCompleted,
+			"summary":  summary,
+			"ended_at": now,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return customerrors.NewConflictError("Tutor session has already ended")
+	}
+
+	session.Status = models.TutorCompleted
+	session.Summary = summary
+	session.EndedAt = &now
+
+	return appendMessage(&models.Message{
+		Text:           summary,
+		Role:           "assistant",
+		ChatID:         session.ChatID,
+		TutorSessionID: &session.ID,
+	})
+}
+
+func GetTutorSessions(c *fiber.Ctx) error {
+	chat, err := ownedChat(c)
+	if err != nil {
+		return err
+	}
+
+	var sxs []models.TutorSession
+	if err := config.DB.Where("chat_id = ?", chat.ID).
+		Preload("Steps", preloadTutorSteps).
+		Order("created_at DESC").
+		Find(&sxs).Error; err != nil {
+		return customerrors.NewInternalServerError("Database error")
+	}
+
+	var response []TutorSessionResp
+	for _, s := range sxs {
+		resp := toTutorSessionResp(s)
+		resp.Steps = nil
+		response = append(response, resp)
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"success": true,
+		"data":    response,
+		"message": "Tutor sessions retrieved successfully",
+	})
+}
+
+// ownedTutorSession loads the session from the sessionID parameter of the current chat
+func ownedTutorSession(c *fiber.Ctx) (models.TutorSession, error) {
+	var session models.TutorSession
+
+	chat, err := ownedChat(c)
+	if err != nil {
+		return session, err
+	}
+
+	if err := config.DB.Where("id = ? AND chat_id = ?", c.Params("sessionID"), chat.ID).
+		Preload("Steps", preloadTutorSteps).
+		First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return session, customerrors.NewNotFoundError("Tutor session not found")
+		}
+		return session, customerrors.NewInternalServerError("Database error")
+	}
+
+	return session, nil
+}
+
+func GetTutorSession(c *fiber.Ctx) error {
+	session, err := ownedTutorSession(c)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"success": true,
+		"data":    toTutorSessionResp(session),
+		"message": "Tutor session retrieved successfully",
+	})
+}
+
+// EndTutorSession closes the session before every step is solved and summarizes it
+func (h *Handler) EndTutorSession(c *fiber.Ctx) error {
+	chat, err := ownedChat(c)
+	if err != nil {
+		return err
+	}
+
+	session, err := ownedTutorSession(c)
+	if err != nil {
+		return err
+	}
+
+	if session.Status != models.TutorActive {
+		return customerrors.NewConflictError("Tutor session has already ended")
+	}
+
+	if err := h.finishTutorSession(chat, &session); err != nil {
+		var customErr *customerrors.CustomError
+		if errors.As(err, &customErr) {
+			return err
+		}
+		return customerrors.NewInternalServerError("Failed to summarize tutor session")
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"success": true,
+		"data":    toTutorSessionResp(session),
+		"message": "Tutor session ended successfully",
+	})
+}
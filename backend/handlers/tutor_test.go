@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/MadMax168/Readsum/config"
+	"github.com/MadMax168/Readsum/customerrors"
+	"github.com/MadMax168/Readsum/llm"
+	"github.com/MadMax168/Readsum/models"
+	"github.com/MadMax168/Readsum/services"
+	"github.com/gofiber/fiber/v2"
+)
+
+const plantPlan = `{"goal": "Explain how plants make food", "steps": [
+	{"description": "Where do plants make food?", "answer": "in the leaves"},
+	{"description": "What is the process called?", "answer": "photosynthesis"}
+]}`
+
+// postTutorMessage sends text to a tutor-mode chat and returns the tutor's reply
+func postTutorMessage(t *testing.T, h *Handler, chat models.Chat, text string) TextResp {
+	t.Helper()
+
+	resp := send(t, testApp(h), chat, "POST", "/messages", PostMessageInput{Text: text, Role: "user"})
+	defer resp.Body.Close()
+
+	var body struct {
+		AIResponse   *TextResp         `json:"ai_response"`
+		TutorSession *TutorSessionResp `json:"tutor_session"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.AIResponse == nil || body.TutorSession == nil {
+		t.Fatalf("no tutor reply to %q (status %d)", text, resp.StatusCode)
+	}
+	return *body.AIResponse
+}
+
+// endingProvider ends the tutor session before each model call, as if the
+// student ended it while the model was answering
+type endingProvider struct {
+	*llm.Fake
+	sessionID uint
+}
+
+func (p endingProvider) Generate(ctx context.Context, req llm.Request) (string, error) {
+	config.DB.Model(&models.TutorSession{}).Where("id = ?", p.sessionID).Update("status", models.TutorCompleted)
+	return p.Fake.Generate(ctx, req)
+}
+
+func TestTutorTurns(t *testing.T) {
+	chat := testChat(t, models.ChatModeTutor)
+	fake := llm.NewFake(
+		plantPlan,
+		`{"reply": "Good question! Which part of a plant catches the most sunlight?", "attempted_steps": [], "solved_steps": []}`,
+		`{"reply": "Right, the leaves. Do you know what the process is called?", "attempted_steps": [1, 2], "solved_steps": [1]}`,
+		`{"reply": "Exactly, photosynthesis!", "attempted_steps": [], "solved_steps": [2]}`,
+		"You worked out where and how plants make their food.",
+	)
+	h := New(services.NewAI(fake))
+
+	if reply := postTutorMessage(t, h, chat, "How do plants make food?"); reply.TutorSessionID == nil {
+		t.Fatal("reply is not linked to a tutor session")
+	}
+
+	var session models.TutorSession
+	if err := config.DB.Where("chat_id = ?", chat.ID).Preload("Steps", preloadTutorSteps).First(&session).Error; err != nil {
+		t.Fatal(err)
+	}
+	if session.Problem != "How do plants make food?" || len(session.Steps) != 2 {
+		t.Fatalf("session %q with %d steps, want the question split into 2 steps", session.Problem, len(session.Steps))
+	}
+
+	postTutorMessage(t, h, chat, "In the leaves? With chlorophyll?")
+	config.DB.Preload("Steps", preloadTutorSteps).First(&session, session.ID)
+	if s := session.Steps[0]; s.Status != models.StepSolved || s.Attempts != 1 {
+		t.Errorf("step 1 is %s after %d attempts, want solved after 1", s.Status, s.Attempts)
+	}
+	if s := session.Steps[1]; s.Status != models.StepAttempted || s.Attempts != 1 {
+		t.Errorf("step 2 is %s after %d attempts, want attempted once", s.Status, s.Attempts)
+	}
+	if session.Status != models.TutorActive {
+		t.Errorf("session is %s with a step left, want it active", session.Status)
+	}
+
+	postTutorMessage(t, h, chat, "Photosynthesis")
+	config.DB.Preload("Steps", preloadTutorSteps).First(&session, session.ID)
+	if session.Status != models.TutorCompleted || session.Summary != "You worked out where and how plants make their food." {
+		t.Errorf("session is %s with summary %q, want it completed with the recap", session.Status, session.Summary)
+	}
+	if s := session.Steps[1]; s.Status != models.StepSolved || s.Attempts != 2 {
+		t.Errorf("step 2 is %s after %d attempts, want solved after 2", s.Status, s.Attempts)
+	}
+
+	mxs, err := activeBranch(chat.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mxs) != 7 || mxs[6].Text != session.Summary {
+		t.Errorf("branch has %d messages, want 3 turns and the recap last", len(mxs))
+	}
+	for _, m := range mxs {
+		if m.TutorSessionID == nil || *m.TutorSessionID != session.ID {
+			t.Errorf("message %q is not linked to the session", m.Text)
+		}
+	}
+
+	for i, req := range fake.Requests {
+		if req.Schema == nil && i != len(fake.Requests)-1 {
+			t.Errorf("call %d has no schema; only the recap is free text", i)
+		}
+	}
+}
+
+func TestTutorTurnAfterSessionEnded(t *testing.T) {
+	chat := testChat(t, models.ChatModeTutor)
+	fake := llm.NewFake(
+		plantPlan,
+		`{"reply": "Which part of a plant catches the most sunlight?", "attempted_steps": [], "solved_steps": []}`,
+		`{"reply": "Yes, the leaves!", "attempted_steps": [1], "solved_steps": [1]}`,
+	)
+	postTutorMessage(t, New(services.NewAI(fake)), chat, "How do plants make food?")
+
+	var session models.TutorSession
+	config.DB.Where("chat_id = ?", chat.ID).Preload("Steps", preloadTutorSteps).First(&session)
+
+	h := New(services.NewAI(endingProvider{Fake: fake, sessionID: session.ID}))
+	message := models.Message{Text: "The leaves", Role: "user", ChatID: chat.ID}
+	if err := appendMessage(&message); err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err := h.tutorMessage(chat, &message)
+	var customErr *customerrors.CustomError
+	if !errors.As(err, &customErr) || customErr.Code != fiber.StatusConflict {
+		t.Fatalf("tutorMessage() error = %v, want a conflict", err)
+	}
+
+	var step models.TutorStep
+	config.DB.First(&step, session.Steps[0].ID)
+	if step.Status != models.StepPending {
+		t.Errorf("step of the ended session moved to %s", step.Status)
+	}
+}
@@ -23,6 +23,7 @@ type RegisterInput struct {
 type UserResponse struct {
 	Name  string `json:"name"`
 	Email string `json:"email"`
+	Role  string `json:"role"`
 }
 
 func Register(c *fiber.Ctx) error {
@@ -71,6 +72,7 @@ func Register(c *fiber.Ctx) error {
 		"data": UserResponse{
 			Name:  user.Name,
 			Email: user.Email,
+			Role:  user.Role,
 		},
 		"message": "User registered successfully",
 	})
@@ -113,6 +115,7 @@ func Login(c *fiber.Ctx) error {
 			"user": UserResponse{
 				Name:  user.Name,
 				Email: user.Email,
+				Role:  user.Role,
 			},
 		},
 		"message": "Login successful",
@@ -139,6 +142,7 @@ func GetUser(c *fiber.Ctx) error {
 	response := UserResponse{
 		Name:  user.Name,
 		Email: user.Email,
+		Role:  user.Role,
 	}
 
 	return c.Status(200).JSON(response)
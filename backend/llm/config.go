@@ -0,0 +1,64 @@
+package llm
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Provider names accepted in LLM_PROVIDER
+const (
+	ProviderGemini = "gemini"
+	ProviderOpenAI = "openai"
+	ProviderOllama = "ollama"
+	ProviderFake   = "fake"
+)
+
+func env(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// FromEnv builds the provider named by LLM_PROVIDER (gemini when unset) from
+// its environment variables:
+//
+//	gemini: GEMINI_API_KEY, GEMINI_MODEL, GEMINI_EMBED_MODEL
+//	openai: OPENAI_BASE_URL, OPENAI_API_KEY, OPENAI_MODEL, OPENAI_EMBED_MODEL
+//	ollama: OLLAMA_BASE_URL, OLLAMA_MODEL, OLLAMA_EMBED_MODEL
+//	fake:   no settings
+func FromEnv() (Provider, error) {
+	// Local models can take minutes on long prompts
+	httpClient := &http.Client{Timeout: 5 * time.Minute}
+
+	switch name := strings.ToLower(env("LLM_PROVIDER", ProviderGemini)); name {
+	case ProviderGemini:
+		return &Gemini{
+			APIKey:     os.Getenv("GEMINI_API_KEY"),
+			Model:      env("GEMINI_MODEL", "gemini-2.0-flash-exp"),
+			EmbedModel: env("GEMINI_EMBED_MODEL", "text-embedding-004"),
+		}, nil
+	case ProviderOpenAI:
+		return &OpenAI{
+			BaseURL:    env("OPENAI_BASE_URL", "https://api.openai.com/v1"),
+			APIKey:     os.Getenv("OPENAI_API_KEY"),
+			Model:      env("OPENAI_MODEL", "gpt-4o-mini"),
+			EmbedModel: env("OPENAI_EMBED_MODEL", "text-embedding-3-small"),
+			HTTP:       httpClient,
+		}, nil
+	case ProviderOllama:
+		return &Ollama{
+			BaseURL:    env("OLLAMA_BASE_URL", "http://localhost:11434"),
+			Model:      env("OLLAMA_MODEL", "llama3.1"),
+			EmbedModel: env("OLLAMA_EMBED_MODEL", "nomic-embed-text"),
+			HTTP:       httpClient,
+		}, nil
+	case ProviderFake:
+		return NewFake(), nil
+	default:
+		return nil, fmt.Errorf("unknown LLM_PROVIDER %q: use gemini, openai, ollama or fake", name)
+	}
+}
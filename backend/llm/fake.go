@@ -0,0 +1,124 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"math"
+	"strings"
+	"sync"
+)
+
+// Fake is a deterministic provider for tests and offline development. It
+// returns the queued Replies in order, then a reply derived from the request:
+// an echo of the last message, or JSON filled in from the schema.
+type Fake struct {
+	mu       sync.Mutex
+	Replies  []string
+	Requests []Request
+}
+
+func NewFake(replies ...string) *Fake {
+	return &Fake{Replies: replies}
+}
+
+// fakeDimensions is the length of Fake's embedding vectors
+const fakeDimensions = 16
+
+func (f *Fake) next(req Request) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.Requests = append(f.Requests, req)
+	if len(f.Replies) > 0 {
+		reply := f.Replies[0]
+		f.Replies = f.Replies[1:]
+		return reply
+	}
+
+	if req.Schema != nil {
+		out, _ := json.Marshal(fakeValue(req.Schema))
+		return string(out)
+	}
+	if len(req.Messages) == 0 {
+		return ""
+	}
+	return "Fake reply to: " + req.Messages[len(req.Messages)-1].Text
+}
+
+// fakeValue builds the smallest value that satisfies s: one array item, the
+// first enum value, and placeholders for scalars
+func fakeValue(s *Schema) interface{} {
+	switch s.Type {
+	case TypeObject:
+		obj := make(map[string]interface{})
+		for name, p := range s.Properties {
+			obj[name] = fakeValue(p)
+		}
+		return obj
+	case TypeArray:
+		if s.Items == nil {
+			return []interface{}{}
+		}
+		return []interface{}{fakeValue(s.Items)}
+	case TypeInteger, TypeNumber:
+		return 1
+	case TypeBoolean:
+		return true
+	}
+	if len(s.Enum) > 0 {
+		return s.Enum[0]
+	}
+	return "fake"
+}
+
+func (f *Fake) Generate(ctx context.Context, req Request) (string, error) {
+	return f.next(req), nil
+}
+
+// Stream sends the reply word by word. Like the real providers, it returns only
+// the text produced so far when ctx or onChunk stops it.
+func (f *Fake) Stream(ctx context.Context, req Request, onChunk func(string) error) (string, error) {
+	reply := f.next(req)
+	var full strings.Builder
+	for _, word := range strings.SplitAfter(reply, " ") {
+		if err := ctx.Err(); err != nil {
+			return full.String(), err
+		}
+		full.WriteString(word)
+		if err := onChunk(word); err != nil {
+			return full.String(), err
+		}
+	}
+	return full.String(), nil
+}
+
+// Embed hashes the words of each text into a unit vector, so texts sharing
+// words come out similar
+func (f *Fake) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, t := range texts {
+		v := make([]float32, fakeDimensions)
+		for _, w := range strings.Fields(strings.ToLower(t)) {
+			h := fnv.New32a()
+			h.Write([]byte(w))
+			v[h.Sum32()%fakeDimensions]++
+		}
+
+		var norm float64
+		for _, x := range v {
+			norm += float64(x * x)
+		}
+		if norm > 0 {
+			for j := range v {
+				v[j] /= float32(math.Sqrt(norm))
+			}
+		}
+		vectors[i] = v
+	}
+	return vectors, nil
+}
+
+func (f *Fake) CountTokens(ctx context.Context, text string) (int, error) {
+	return EstimateTokens(text), nil
+}
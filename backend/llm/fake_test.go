@@ -0,0 +1,61 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestFakeRepliesInOrder(t *testing.T) {
+	fake := NewFake("first", "second")
+	ctx := context.Background()
+
+	for _, want := range []string{"first", "second", "Fake reply to: hello"} {
+		got, err := fake.Generate(ctx, Request{Messages: []Message{{Role: RoleUser, Text: "hello"}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("Generate() = %q, want %q", got, want)
+		}
+	}
+	if len(fake.Requests) != 3 {
+		t.Errorf("recorded %d requests, want 3", len(fake.Requests))
+	}
+}
+
+func TestFakeStreamStoppedByChunk(t *testing.T) {
+	fake := NewFake("one two three")
+	gone := errors.New("client gone")
+
+	var chunks []string
+	text, err := fake.Stream(context.Background(), Request{}, func(chunk string) error {
+		chunks = append(chunks, chunk)
+		if len(chunks) == 2 {
+			return gone
+		}
+		return nil
+	})
+	if !errors.Is(err, gone) {
+		t.Fatalf("Stream() error = %v, want %v", err, gone)
+	}
+	if text != "one two " {
+		t.Errorf("Stream() = %q, want the streamed prefix %q", text, "one two ")
+	}
+}
+
+func TestFakeStreamCancelled(t *testing.T) {
+	fake := NewFake("one two three")
+	ctx, cancel := context.WithCancel(context.Background())
+
+	text, err := fake.Stream(ctx, Request{}, func(chunk string) error {
+		cancel()
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Stream() error = %v, want %v", err, context.Canceled)
+	}
+	if text != "one " {
+		t.Errorf("Stream() = %q, want %q", text, "one ")
+	}
+}
@@ -0,0 +1,231 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+)
+
+// Gemini calls Google's Gemini API
+type Gemini struct {
+	APIKey     string
+	Model      string
+	EmbedModel string
+}
+
+func (g *Gemini) client(ctx context.Context) (*genai.Client, error) {
+	if g.APIKey == "" {
+		return nil, fmt.Errorf("GEMINI_API_KEY is not set")
+	}
+	return genai.NewClient(ctx, option.WithAPIKey(g.APIKey))
+}
+
+var geminiTypes = map[string]genai.Type{
+	TypeObject:  genai.TypeObject,
+	TypeArray:   genai.TypeArray,
+	TypeString:  genai.TypeString,
+	TypeInteger: genai.TypeInteger,
+	TypeNumber:  genai.TypeNumber,
+	TypeBoolean: genai.TypeBoolean,
+}
+
+func geminiSchema(s *Schema) *genai.Schema {
+	if s == nil {
+		return nil
+	}
+
+	out := &genai.Schema{
+		Type:     geminiTypes[s.Type],
+		Enum:     s.Enum,
+		Items:    geminiSchema(s.Items),
+		Required: s.Required,
+	}
+	if len(s.Enum) > 0 {
+		out.Format = "enum"
+	}
+	if s.Properties != nil {
+		out.Properties = make(map[string]*genai.Schema)
+		for name, p := range s.Properties {
+			out.Properties[name] = geminiSchema(p)
+		}
+	}
+	return out
+}
+
+var geminiThresholds = map[string]genai.HarmBlockThreshold{
+	SafetyStrict:   genai.HarmBlockLowAndAbove,
+	SafetyStandard: genai.HarmBlockMediumAndAbove,
+	SafetyRelaxed:  genai.HarmBlockOnlyHigh,
+}
+
+var geminiHarmCategories = []genai.HarmCategory{
+	genai.HarmCategoryHarassment,
+	genai.HarmCategoryHateSpeech,
+	genai.HarmCategorySexuallyExplicit,
+	genai.HarmCategoryDangerousContent,
+}
+
+// chat prepares a chat session holding every message of req but the last,
+// which is returned as the parts to send
+func (g *Gemini) chat(client *genai.Client, req Request) (*genai.ChatSession, []genai.Part, error) {
+	if len(req.Messages) == 0 {
+		return nil, nil, fmt.Errorf("request has no messages")
+	}
+
+	model := client.GenerativeModel(modelName(req, g.Model))
+	model.SetTemperature(req.Temperature)
+	if req.TopP > 0 {
+		model.SetTopP(req.TopP)
+	}
+	if req.MaxOutputTokens > 0 {
+		model.SetMaxOutputTokens(int32(req.MaxOutputTokens))
+	}
+	if threshold, ok := geminiThresholds[req.Safety]; ok {
+		for _, category := range geminiHarmCategories {
+			model.SafetySettings = append(model.SafetySettings, &genai.SafetySetting{
+				Category:  category,
+				Threshold: threshold,
+			})
+		}
+	}
+	if req.System != "" {
+		model.SystemInstruction = &genai.Content{Parts: []genai.Part{genai.Text(req.System)}}
+	}
+	if req.Schema != nil {
+		model.ResponseMIMEType = "application/json"
+		model.ResponseSchema = geminiSchema(req.Schema)
+	}
+
+	session := model.StartChat()
+	last := len(req.Messages) - 1
+	for _, m := range req.Messages[:last] {
+		role := "user"
+		if m.Role == RoleAssistant {
+			role = "model"
+		}
+		session.History = append(session.History, &genai.Content{
+			Role:  role,
+			Parts: []genai.Part{genai.Text(m.Text)},
+		})
+	}
+
+	return session, []genai.Part{genai.Text(req.Messages[last].Text)}, nil
+}
+
+func responseText(resp *genai.GenerateContentResponse) string {
+	if resp == nil || len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+		return ""
+	}
+
+	var result string
+	for _, part := range resp.Candidates[0].Content.Parts {
+		if txt, ok := part.(genai.Text); ok {
+			result += string(txt)
+		}
+	}
+	return result
+}
+
+func (g *Gemini) Generate(ctx context.Context, req Request) (string, error) {
+	client, err := g.client(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+
+	session, parts, err := g.chat(client, req)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := session.SendMessage(ctx, parts...)
+	if err != nil {
+		return "", err
+	}
+
+	if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+		return "", ErrNoResponse
+	}
+	return responseText(resp), nil
+}
+
+func (g *Gemini) Stream(ctx context.Context, req Request, onChunk func(string) error) (string, error) {
+	client, err := g.client(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+
+	session, parts, err := g.chat(client, req)
+	if err != nil {
+		return "", err
+	}
+
+	var full string
+	iter := session.SendMessageStream(ctx, parts...)
+	for {
+		resp, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return full, err
+		}
+
+		chunk := responseText(resp)
+		if chunk == "" {
+			continue
+		}
+		full += chunk
+		if err := onChunk(chunk); err != nil {
+			return full, err
+		}
+	}
+
+	if full == "" {
+		return "", ErrNoResponse
+	}
+	return full, nil
+}
+
+func (g *Gemini) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	client, err := g.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	model := client.EmbeddingModel(g.EmbedModel)
+	batch := model.NewBatch()
+	for _, t := range texts {
+		batch.AddContent(genai.Text(t))
+	}
+
+	resp, err := model.BatchEmbedContents(ctx, batch)
+	if err != nil {
+		return nil, err
+	}
+
+	vectors := make([][]float32, len(resp.Embeddings))
+	for i, e := range resp.Embeddings {
+		vectors[i] = e.Values
+	}
+	return vectors, nil
+}
+
+func (g *Gemini) CountTokens(ctx context.Context, text string) (int, error) {
+	client, err := g.client(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer client.Close()
+
+	resp, err := client.GenerativeModel(g.Model).CountTokens(ctx, genai.Text(text))
+	if err != nil {
+		return 0, err
+	}
+	return int(resp.TotalTokens), nil
+}
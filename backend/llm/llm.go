@@ -0,0 +1,165 @@
+// Package llm talks to language models through a provider-neutral interface,
+// so the rest of the app does not depend on one vendor's SDK.
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Message roles
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+type Message struct {
+	Role string
+	Text string
+}
+
+// Request is one model call. When Schema is set the model must answer with JSON
+// matching it. Zero values of Model, TopP, MaxOutputTokens and Safety leave the
+// provider's defaults in place.
+type Request struct {
+	System          string
+	Messages        []Message
+	Model           string
+	Temperature     float32
+	TopP            float32
+	MaxOutputTokens int
+	Safety          string
+	Schema          *Schema
+}
+
+// Safety levels: how readily the model refuses or blocks harmful content.
+// Only Gemini has adjustable filters; other backends ignore the level.
+const (
+	SafetyStrict   = "strict"
+	SafetyStandard = "standard"
+	SafetyRelaxed  = "relaxed"
+)
+
+// modelName is the model req asks for, or fallback when it names none
+func modelName(req Request, fallback string) string {
+	if req.Model != "" {
+		return req.Model
+	}
+	return fallback
+}
+
+// Provider is a language model backend
+type Provider interface {
+	// Generate returns the full reply to req
+	Generate(ctx context.Context, req Request) (string, error)
+	// Stream calls onChunk with each piece of the reply as it arrives and returns
+	// the full reply. An error from onChunk stops the stream.
+	Stream(ctx context.Context, req Request, onChunk func(string) error) (string, error)
+	// Embed returns one vector per text
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+	// CountTokens returns how many tokens text takes up in the model's context
+	CountTokens(ctx context.Context, text string) (int, error)
+}
+
+// EstimateTokens approximates a token count for backends without a tokenizer
+// endpoint: about four bytes of UTF-8 per token
+func EstimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// Schema types
+const (
+	TypeObject  = "object"
+	TypeArray   = "array"
+	TypeString  = "string"
+	TypeInteger = "integer"
+	TypeNumber  = "number"
+	TypeBoolean = "boolean"
+)
+
+// Schema describes the JSON a model must return; a subset of JSON Schema that
+// every provider supports
+type Schema struct {
+	Type       string
+	Enum       []string
+	Items      *Schema
+	Properties map[string]*Schema
+	Required   []string
+}
+
+// JSONSchema renders s as a standard JSON Schema document
+func (s *Schema) JSONSchema() map[string]interface{} {
+	if s == nil {
+		return nil
+	}
+
+	out := map[string]interface{}{"type": s.Type}
+	if len(s.Enum) > 0 {
+		out["enum"] = s.Enum
+	}
+	if s.Items != nil {
+		out["items"] = s.Items.JSONSchema()
+	}
+	if s.Properties != nil {
+		props := make(map[string]interface{})
+		for name, p := range s.Properties {
+			props[name] = p.JSONSchema()
+		}
+		out["properties"] = props
+	}
+	if len(s.Required) > 0 {
+		out["required"] = s.Required
+	}
+	return out
+}
+
+// ErrNoResponse is returned when the model answers with no content
+var ErrNoResponse = errors.New("no response from model")
+
+// postJSON sends body to url and decodes the JSON reply into out, turning error
+// statuses into errors that carry the backend's message
+func postJSON(ctx context.Context, client *http.Client, url string, headers map[string]string, body, out interface{}) error {
+	resp, err := sendJSON(ctx, client, url, headers, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("invalid response from %s: %w", url, err)
+	}
+	return nil
+}
+
+// sendJSON posts body to url and returns the response when its status is 2xx
+func sendJSON(ctx context.Context, client *http.Client, url string, headers map[string]string, body interface{}) (*http.Response, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
+		return nil, fmt.Errorf("%s returned %s: %s", url, resp.Status, msg)
+	}
+	return resp, nil
+}
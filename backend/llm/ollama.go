@@ -0,0 +1,127 @@
+package llm
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Ollama calls a local Ollama server
+type Ollama struct {
+	BaseURL    string
+	Model      string
+	EmbedModel string
+	HTTP       *http.Client
+}
+
+type ollamaChunk struct {
+	Message openAIMessage `json:"message"`
+	Done    bool          `json:"done"`
+	Error   string        `json:"error"`
+}
+
+func (o *Ollama) url(path string) string {
+	return strings.TrimRight(o.BaseURL, "/") + path
+}
+
+func (o *Ollama) body(req Request, stream bool) map[string]interface{} {
+	var messages []openAIMessage
+	if req.System != "" {
+		messages = append(messages, openAIMessage{Role: "system", Content: req.System})
+	}
+	for _, m := range req.Messages {
+		messages = append(messages, openAIMessage{Role: m.Role, Content: m.Text})
+	}
+
+	options := map[string]interface{}{"temperature": req.Temperature}
+	if req.TopP > 0 {
+		options["top_p"] = req.TopP
+	}
+	if req.MaxOutputTokens > 0 {
+		options["num_predict"] = req.MaxOutputTokens
+	}
+
+	body := map[string]interface{}{
+		"model":    modelName(req, o.Model),
+		"messages": messages,
+		"stream":   stream,
+		"options":  options,
+	}
+	if req.Schema != nil {
+		body["format"] = req.Schema.JSONSchema()
+	}
+	return body
+}
+
+func (o *Ollama) Generate(ctx context.Context, req Request) (string, error) {
+	var resp ollamaChunk
+	if err := postJSON(ctx, o.HTTP, o.url("/api/chat"), nil, o.body(req, false), &resp); err != nil {
+		return "", err
+	}
+
+	if resp.Error != "" {
+		return "", fmt.Errorf("ollama: %s", resp.Error)
+	}
+	if resp.Message.Content == "" {
+		return "", ErrNoResponse
+	}
+	return resp.Message.Content, nil
+}
+
+// Stream reads the newline-delimited JSON chunks Ollama streams
+func (o *Ollama) Stream(ctx context.Context, req Request, onChunk func(string) error) (string, error) {
+	resp, err := sendJSON(ctx, o.HTTP, o.url("/api/chat"), nil, o.body(req, true))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var full strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var chunk ollamaChunk
+		if err := json.Unmarshal(scanner.Bytes(), &chunk); err != nil {
+			continue
+		}
+		if chunk.Error != "" {
+			return full.String(), fmt.Errorf("ollama: %s", chunk.Error)
+		}
+		if chunk.Message.Content != "" {
+			full.WriteString(chunk.Message.Content)
+			if err := onChunk(chunk.Message.Content); err != nil {
+				return full.String(), err
+			}
+		}
+		if chunk.Done {
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return full.String(), err
+	}
+
+	if full.Len() == 0 {
+		return "", ErrNoResponse
+	}
+	return full.String(), nil
+}
+
+func (o *Ollama) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	var resp struct {
+		Embeddings [][]float32 `json:"embeddings"`
+	}
+	body := map[string]interface{}{"model": o.EmbedModel, "input": texts}
+	if err := postJSON(ctx, o.HTTP, o.url("/api/embed"), nil, body, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Embeddings, nil
+}
+
+// CountTokens estimates, since Ollama has no tokenizer endpoint
+func (o *Ollama) CountTokens(ctx context.Context, text string) (int, error) {
+	return EstimateTokens(text), nil
+}
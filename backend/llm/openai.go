@@ -0,0 +1,159 @@
+package llm
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// OpenAI calls any server implementing the OpenAI chat completions and
+// embeddings API: OpenAI itself, Azure-style gateways, vLLM, LM Studio...
+type OpenAI struct {
+	BaseURL    string
+	APIKey     string
+	Model      string
+	EmbedModel string
+	HTTP       *http.Client
+}
+
+type openAIMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type openAIChoice struct {
+	Message openAIMessage `json:"message"`
+	Delta   openAIMessage `json:"delta"`
+}
+
+type openAIResponse struct {
+	Choices []openAIChoice `json:"choices"`
+}
+
+func (o *OpenAI) headers() map[string]string {
+	if o.APIKey == "" {
+		return nil
+	}
+	return map[string]string{"Authorization": "Bearer " + o.APIKey}
+}
+
+func (o *OpenAI) url(path string) string {
+	return strings.TrimRight(o.BaseURL, "/") + path
+}
+
+func (o *OpenAI) body(req Request, stream bool) map[string]interface{} {
+	var messages []openAIMessage
+	if req.System != "" {
+		messages = append(messages, openAIMessage{Role: "system", Content: req.System})
+	}
+	for _, m := range req.Messages {
+		messages = append(messages, openAIMessage{Role: m.Role, Content: m.Text})
+	}
+
+	body := map[string]interface{}{
+		"model":       modelName(req, o.Model),
+		"messages":    messages,
+		"temperature": req.Temperature,
+		"stream":      stream,
+	}
+	if req.TopP > 0 {
+		body["top_p"] = req.TopP
+	}
+	if req.MaxOutputTokens > 0 {
+		body["max_tokens"] = req.MaxOutputTokens
+	}
+	if req.Schema != nil {
+		body["response_format"] = map[string]interface{}{
+			"type": "json_schema",
+			"json_schema": map[string]interface{}{
+				"name":   "response",
+				"schema": req.Schema.JSONSchema(),
+			},
+		}
+	}
+	return body
+}
+
+func (o *OpenAI) Generate(ctx context.Context, req Request) (string, error) {
+	var resp openAIResponse
+	if err := postJSON(ctx, o.HTTP, o.url("/chat/completions"), o.headers(), o.body(req, false), &resp); err != nil {
+		return "", err
+	}
+
+	if len(resp.Choices) == 0 {
+		return "", ErrNoResponse
+	}
+	return resp.Choices[0].Message.Content, nil
+}
+
+// Stream reads the server-sent events of a streamed completion
+func (o *OpenAI) Stream(ctx context.Context, req Request, onChunk func(string) error) (string, error) {
+	resp, err := sendJSON(ctx, o.HTTP, o.url("/chat/completions"), o.headers(), o.body(req, true))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var full strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			break
+		}
+
+		var event openAIResponse
+		if err := json.Unmarshal([]byte(data), &event); err != nil || len(event.Choices) == 0 {
+			continue
+		}
+		chunk := event.Choices[0].Delta.Content
+		if chunk == "" {
+			continue
+		}
+		full.WriteString(chunk)
+		if err := onChunk(chunk); err != nil {
+			return full.String(), err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return full.String(), err
+	}
+
+	if full.Len() == 0 {
+		return "", ErrNoResponse
+	}
+	return full.String(), nil
+}
+
+func (o *OpenAI) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	var resp struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	body := map[string]interface{}{"model": o.EmbedModel, "input": texts}
+	if err := postJSON(ctx, o.HTTP, o.url("/embeddings"), o.headers(), body, &resp); err != nil {
+		return nil, err
+	}
+
+	vectors := make([][]float32, len(texts))
+	for _, d := range resp.Data {
+		if d.Index >= 0 && d.Index < len(vectors) {
+			vectors[d.Index] = d.Embedding
+		}
+	}
+	return vectors, nil
+}
+
+// CountTokens estimates, since the OpenAI API has no tokenizer endpoint
+func (o *OpenAI) CountTokens(ctx context.Context, text string) (int, error) {
+	return EstimateTokens(text), nil
+}
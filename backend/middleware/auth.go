@@ -5,23 +5,17 @@ import (
 	"strings"
 
 	"github.com/MadMax168/Readsum/customerrors"
+	"github.com/gofiber/contrib/websocket"
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v4"
 )
 
-//Authentication
-func AuthMiddleware(c *fiber.Ctx) error {
-	authHeader := c.Get("Authorization")
-	if authHeader  == "" {
-		return customerrors.NewUnauthorizedError("Missing authorization header")
-	}
-
+// ParseToken validates a JWT issued by GenerateToken and returns its user ID
+func ParseToken(tokenString string) (uint, error) {
 	jwtSecret := os.Getenv("JWT_SECRET")
-    if jwtSecret == "" {
-		return customerrors.NewUnauthorizedError("Server configuration error: JWT secret not set")
-    }
-
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	if jwtSecret == "" {
+		return 0, customerrors.NewUnauthorizedError("Server configuration error: JWT secret not set")
+	}
 
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
@@ -31,19 +25,59 @@ func AuthMiddleware(c *fiber.Ctx) error {
 	})
 
 	if err != nil || !token.Valid {
-		return customerrors.NewUnauthorizedError("Invalid token")
+		return 0, customerrors.NewUnauthorizedError("Invalid token")
 	}
 
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
-		return customerrors.NewUnauthorizedError("Invalid token claims")
+		return 0, customerrors.NewUnauthorizedError("Invalid token claims")
 	}
 
 	userID, ok := claims["user_id"].(float64)
 	if !ok {
-		return customerrors.NewUnauthorizedError("Invalid user ID in token")
+		return 0, customerrors.NewUnauthorizedError("Invalid user ID in token")
+	}
+
+	return uint(userID), nil
+}
+
+//Authentication
+func AuthMiddleware(c *fiber.Ctx) error {
+	authHeader := c.Get("Authorization")
+	if authHeader == "" {
+		return customerrors.NewUnauthorizedError("Missing authorization header")
+	}
+
+	userID, err := ParseToken(strings.TrimPrefix(authHeader, "Bearer "))
+	if err != nil {
+		return err
+	}
+
+	c.Locals("userID", userID)
+	return c.Next()
+}
+
+// WebSocketAuth authenticates a WebSocket upgrade with the same JWT as
+// AuthMiddleware. Browsers cannot set headers on WebSocket requests, so the
+// token may also be passed in the token query parameter.
+func WebSocketAuth(c *fiber.Ctx) error {
+	if !websocket.IsWebSocketUpgrade(c) {
+		return fiber.ErrUpgradeRequired
+	}
+
+	tokenString := strings.TrimPrefix(c.Get("Authorization"), "Bearer ")
+	if tokenString == "" {
+		tokenString = c.Query("token")
+	}
+	if tokenString == "" {
+		return customerrors.NewUnauthorizedError("Missing authorization token")
+	}
+
+	userID, err := ParseToken(tokenString)
+	if err != nil {
+		return err
 	}
 
-	c.Locals("userID", uint(userID))
+	c.Locals("userID", userID)
 	return c.Next()
-}
\ No newline at end of file
+}
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type QuizAttempt struct {
+	gorm.Model
+	Score       float64   `json:"score" gorm:"not null;default:0"`
+	MaxScore    float64   `json:"max_score" gorm:"not null;default:0"`
+	Percentage  float64   `json:"percentage" gorm:"not null;default:0"`
+	SubmittedAt time.Time `json:"submitted_at" gorm:"autoCreateTime"`
+	//ForeignKeys
+	QuizID uint `json:"quiz_id" gorm:"not null;index"`
+	Quiz   Quiz `json:"quiz,omitempty" gorm:"constraint:OnDelete:CASCADE"`
+
+	UserID uint `json:"user_id" gorm:"not null;index"`
+	User   User `json:"user,omitempty" gorm:"constraint:OnDelete:CASCADE"`
+	//Relationships
+	Answers []Answer `json:"answers,omitempty" gorm:"foreignKey:AttemptID"`
+}
+
+// Answer grading states
+const (
+	GradingGraded     = "graded"
+	GradingFailed     = "failed"
+	GradingOverridden = "overridden"
+)
+
+type CriterionScore struct {
+	Name      string  `json:"name"`
+	Points    float64 `json:"points"`
+	MaxPoints float64 `json:"max_points"`
+	Feedback  string  `json:"feedback"`
+}
+
+type CriterionScores []CriterionScore
+
+func (s CriterionScores) Value() (driver.Value, error) {
+	return json.Marshal(s)
+}
+
+func (s *CriterionScores) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*s = nil
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), s)
+	case []byte:
+		return json.Unmarshal(v, s)
+	}
+	return errors.New("failed to scan CriterionScores")
+}
+
+type Answer struct {
+	gorm.Model
+	OptionID  *uint   `json:"option_id" gorm:"index"`
+	IsCorrect bool    `json:"is_correct" gorm:"not null;default:false"`
+	Points    float64 `json:"points" gorm:"not null;default:0"`
+	MaxPoints float64 `json:"max_points" gorm:"not null;default:0"`
+	//Free response grading
+	ResponseText     string          `json:"response_text" gorm:"type:text"`
+	GradingStatus    string          `json:"grading_status" gorm:"type:varchar(20);not null;default:'graded'"`
+	CriterionScores  CriterionScores `json:"criterion_scores" gorm:"type:json"`
+	Feedback         string          `json:"feedback" gorm:"type:text"`
+	GradingRationale string          `json:"grading_rationale" gorm:"type:text"`
+	//Override; the model's grade is kept next to the reviewer's
+	OverrideNote         string          `json:"override_note" gorm:"type:text"`
+	OverriddenAt         *time.Time      `json:"overridden_at"`
+	OverriddenByID       *uint           `json:"overridden_by_id"`
+	ModelPoints          *float64        `json:"model_points"`
+	ModelIsCorrect       *bool           `json:"model_is_correct"`
+	ModelCriterionScores CriterionScores `json:"model_criterion_scores" gorm:"type:json"`
+	//ForeignKeys
+	AttemptID uint        `json:"attempt_id" gorm:"not null;index"`
+	Attempt   QuizAttempt `json:"attempt,omitempty" gorm:"constraint:OnDelete:CASCADE"`
+
+	QuestionID uint     `json:"question_id" gorm:"not null;index"`
+	Question   Question `json:"question,omitempty" gorm:"constraint:OnDelete:CASCADE"`
+}
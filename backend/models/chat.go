@@ -4,11 +4,46 @@ import (
 	"gorm.io/gorm"
 )
 
+// Chat modes; in tutor mode the assistant guides the student instead of answering
+const (
+	ChatModeStandard = "chat"
+	ChatModeTutor    = "tutor"
+)
+
+// Who owns a chat's title: auto titles follow the conversation, user titles are kept
+const (
+	TitleAuto = "auto"
+	TitleUser = "user"
+)
+
 type Chat struct {
 	gorm.Model
-	Title  string `json:"title" gorm:"not null"`
-	UserID uint   `json:"user_id" gorm:"not null;index"`
-	User   User   `json:"user,omitempty" gorm:"constraint:OnDelete:CASCADE"`
+	Title string `json:"title" gorm:"not null"`
+	Mode  string `json:"mode" gorm:"type:varchar(10);not null;default:'chat'"`
+	//Renaming
+	TitleSource string `json:"title_source" gorm:"type:varchar(10);not null;default:'user'"`
+	// TitledAtMessages is the message count when the title was last generated
+	TitledAtMessages int `json:"-" gorm:"not null;default:0"`
+	//Instructions
+	// SystemPrompt is added to every model call of the chat, after its persona's instructions
+	SystemPrompt string   `json:"system_prompt" gorm:"type:text"`
+	PersonaID    *uint    `json:"persona_id" gorm:"index"`
+	Persona      *Persona `json:"persona,omitempty" gorm:"constraint:OnDelete:SET NULL"`
+	//ModelSettings: empty values use the server defaults
+	ModelName       string   `json:"model" gorm:"type:varchar(100)"`
+	Temperature     *float32 `json:"temperature"`
+	TopP            *float32 `json:"top_p"`
+	MaxOutputTokens *int     `json:"max_output_tokens"`
+	SafetyLevel     string   `json:"safety" gorm:"type:varchar(10)"`
+	//Memory
+	// Summary condenses the conversation up to SummaryMessageID, which it replaces in replies
+	Summary          string `json:"summary" gorm:"type:text"`
+	SummaryMessageID *uint  `json:"-"`
+	//Branching
+	// LeafMessageID is the last message of the branch the chat currently shows
+	LeafMessageID *uint `json:"leaf_message_id"`
+	UserID        uint  `json:"user_id" gorm:"not null;index"`
+	User          User  `json:"user,omitempty" gorm:"constraint:OnDelete:CASCADE"`
 	//Relationships
 	Documents []Document `json:"documents,omitempty" gorm:"foreignKey:ChatID"`
 	Messages  []Message  `json:"messages,omitempty" gorm:"foreignKey:ChatID"`
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type Deck struct {
+	gorm.Model
+	Title string `json:"title" gorm:"not null"`
+	//ForeignKeys
+	UserID uint `json:"user_id" gorm:"not null;index"`
+	User   User `json:"user,omitempty" gorm:"constraint:OnDelete:CASCADE"`
+
+	ChatID *uint `json:"chat_id" gorm:"index"`
+	Chat   *Chat `json:"chat,omitempty" gorm:"constraint:OnDelete:SET NULL"`
+
+	DocumentID *uint     `json:"document_id" gorm:"index"`
+	Document   *Document `json:"document,omitempty" gorm:"constraint:OnDelete:SET NULL"`
+	//Relationships
+	Cards []Card `json:"cards,omitempty" gorm:"foreignKey:DeckID"`
+}
+
+// Card kinds
+const (
+	CardBasic = "basic"
+	CardCloze = "cloze"
+)
+
+type Card struct {
+	gorm.Model
+	Kind  string `json:"kind" gorm:"type:varchar(10);not null;default:'basic'"`
+	Front string `json:"front" gorm:"type:text;not null"`
+	Back  string `json:"back" gorm:"type:text;not null"`
+	//Cloze siblings share a NoteKey and ClozeText, one card per ClozeIndex
+	ClozeText  string `json:"cloze_text" gorm:"type:text"`
+	ClozeIndex int    `json:"cloze_index"`
+	NoteKey    string `json:"note_key" gorm:"index"`
+	//Scheduling (SM-2)
+	EaseFactor     float64    `json:"ease_factor" gorm:"not null;default:2.5"`
+	Interval       int        `json:"interval" gorm:"not null;default:0"`
+	Repetitions    int        `json:"repetitions" gorm:"not null;default:0"`
+	DueAt          time.Time  `json:"due_at" gorm:"not null;index"`
+	LastReviewedAt *time.Time `json:"last_reviewed_at"`
+	//ForeignKeys
+	DeckID uint `json:"deck_id" gorm:"not null;index"`
+	Deck   Deck `json:"deck,omitempty" gorm:"constraint:OnDelete:CASCADE"`
+	//Relationships
+	Reviews []CardReview `json:"reviews,omitempty" gorm:"foreignKey:CardID"`
+}
+
+type CardReview struct {
+	gorm.Model
+	Grade      int       `json:"grade" gorm:"not null"`
+	EaseFactor float64   `json:"ease_factor" gorm:"not null"`
+	Interval   int       `json:"interval" gorm:"not null"`
+	ReviewedAt time.Time `json:"reviewed_at" gorm:"not null;index"`
+	//ForeignKeys
+	CardID uint `json:"card_id" gorm:"not null;index"`
+	Card   Card `json:"card,omitempty" gorm:"constraint:OnDelete:CASCADE"`
+
+	UserID uint `json:"user_id" gorm:"not null;index"`
+	User   User `json:"user,omitempty" gorm:"constraint:OnDelete:CASCADE"`
+}
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Exam session states; an in-progress exam past its deadline is expired
+const (
+	ExamInProgress = "in_progress"
+	ExamSubmitted  = "submitted"
+	ExamExpired    = "expired"
+)
+
+type Exam struct {
+	gorm.Model
+	Title       string     `json:"title" gorm:"not null"`
+	Status      string     `json:"status" gorm:"type:varchar(20);not null;default:'in_progress';index"`
+	TimeLimit   int        `json:"time_limit" gorm:"not null"` // minutes
+	StartedAt   time.Time  `json:"started_at" gorm:"not null"`
+	ExpiresAt   time.Time  `json:"expires_at" gorm:"not null;index"`
+	SubmittedAt *time.Time `json:"submitted_at"`
+	Score       float64    `json:"score" gorm:"not null;default:0"`
+	MaxScore    float64    `json:"max_score" gorm:"not null;default:0"`
+	Percentage  float64    `json:"percentage" gorm:"not null;default:0"`
+	//ForeignKeys
+	UserID uint `json:"user_id" gorm:"not null;index"`
+	User   User `json:"user,omitempty" gorm:"constraint:OnDelete:CASCADE"`
+
+	ChatID uint `json:"chat_id" gorm:"not null;index"`
+	Chat   Chat `json:"chat,omitempty" gorm:"constraint:OnDelete:CASCADE"`
+	//Relationships
+	Questions []ExamQuestion `json:"questions,omitempty" gorm:"foreignKey:ExamID"`
+}
+
+// ExamQuestion is a bank question drawn into an exam, with the student's answer
+type ExamQuestion struct {
+	gorm.Model
+	Position    int       `json:"position" gorm:"not null"`
+	OptionOrder UintArray `json:"option_order" gorm:"type:json"`
+	//Answer
+	OptionID     *uint      `json:"option_id"`
+	ResponseText string     `json:"response_text" gorm:"type:text"`
+	AnsweredAt   *time.Time `json:"answered_at"`
+	//Grading
+	IsCorrect       bool            `json:"is_correct" gorm:"not null;default:false"`
+	Points          float64         `json:"points" gorm:"not null;default:0"`
+	MaxPoints       float64         `json:"max_points" gorm:"not null;default:0"`
+	GradingStatus   string          `json:"grading_status" gorm:"type:varchar(20)"`
+	CriterionScores CriterionScores `json:"criterion_scores" gorm:"type:json"`
+	Feedback        string          `json:"feedback" gorm:"type:text"`
+	//ForeignKeys
+	ExamID uint `json:"exam_id" gorm:"not null;index"`
+	Exam   Exam `json:"exam,omitempty" gorm:"constraint:OnDelete:CASCADE"`
+
+	QuestionID uint     `json:"question_id" gorm:"not null;index"`
+	Question   Question `json:"question,omitempty" gorm:"constraint:OnDelete:CASCADE"`
+}
@@ -27,7 +27,17 @@ type Message struct {
 	Text               string    `json:"text" gorm:"type:text;not null"`
 	Role               string    `json:"role" gorm:"type:varchar(20);not null"`
 	RelatedDocumentIDs UintArray `json:"related_document_idx" gorm:"type:json"`
+	// Incomplete marks an assistant reply cut off when the client disconnected mid-stream
+	Incomplete bool `json:"incomplete" gorm:"not null;default:false"`
+	// Stale marks a message written before an earlier message it follows was edited
+	Stale bool `json:"stale" gorm:"not null;default:false"`
 	//ForeignKeys
-	ChatID uint `json:"chat_id" gorm:"not null;index"`
-	Chat   Chat `json:"chat,omitempty" gorm:"constraint:OnDelete:CASCADE"`
+	// ParentID is the message this one follows; messages sharing a parent are
+	// alternative branches of the conversation. Nil for the first message.
+	ParentID *uint `json:"parent_id" gorm:"index"`
+	ChatID   uint  `json:"chat_id" gorm:"not null;index"`
+	Chat     Chat  `json:"chat,omitempty" gorm:"constraint:OnDelete:CASCADE"`
+
+	TutorSessionID *uint         `json:"tutor_session_id" gorm:"index"`
+	TutorSession   *TutorSession `json:"tutor_session,omitempty" gorm:"constraint:OnDelete:SET NULL"`
 }
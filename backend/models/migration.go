@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+// Migration records a one-off data migration that has been applied, so it is
+// not run again on the next start
+type Migration struct {
+	Name      string    `json:"name" gorm:"primaryKey"`
+	AppliedAt time.Time `json:"applied_at" gorm:"not null"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import "gorm.io/gorm"
+
+type MindMap struct {
+	gorm.Model
+	Title string `json:"title" gorm:"not null"`
+	//ForeignKeys
+	UserID uint `json:"user_id" gorm:"not null;index"`
+	User   User `json:"user,omitempty" gorm:"constraint:OnDelete:CASCADE"`
+
+	ChatID uint `json:"chat_id" gorm:"not null;index"`
+	Chat   Chat `json:"chat,omitempty" gorm:"constraint:OnDelete:CASCADE"`
+
+	DocumentID *uint     `json:"document_id" gorm:"index"`
+	Document   *Document `json:"document,omitempty" gorm:"constraint:OnDelete:SET NULL"`
+	//Relationships
+	Nodes []MindMapNode `json:"nodes,omitempty" gorm:"foreignKey:MindMapID"`
+}
+
+// MindMapNode is one concept of a mind map; the root node has no parent
+type MindMapNode struct {
+	gorm.Model
+	Label    string `json:"label" gorm:"not null"`
+	Note     string `json:"note" gorm:"type:text"`
+	Position int    `json:"position" gorm:"not null;default:0"`
+	//ForeignKeys
+	MindMapID uint    `json:"mind_map_id" gorm:"not null;index"`
+	MindMap   MindMap `json:"mind_map,omitempty" gorm:"constraint:OnDelete:CASCADE"`
+
+	ParentID *uint        `json:"parent_id" gorm:"index"`
+	Parent   *MindMapNode `json:"parent,omitempty" gorm:"constraint:OnDelete:CASCADE"`
+}
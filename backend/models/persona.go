@@ -0,0 +1,14 @@
+package models
+
+import "gorm.io/gorm"
+
+// Persona is a reusable assistant voice, such as a strict exam coach, that a
+// user can apply to any of their chats
+type Persona struct {
+	gorm.Model
+	Name         string `json:"name" gorm:"not null"`
+	Instructions string `json:"instructions" gorm:"type:text;not null"`
+	//ForeignKeys
+	UserID uint `json:"user_id" gorm:"not null;index"`
+	User   User `json:"user,omitempty" gorm:"constraint:OnDelete:CASCADE"`
+}
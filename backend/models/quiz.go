@@ -0,0 +1,102 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// Question types
+const (
+	QuestionMultipleChoice = "multiple_choice"
+	QuestionShortAnswer    = "short_answer"
+	QuestionEssay          = "essay"
+)
+
+// Question verification states
+const (
+	VerificationVerified   = "verified"
+	VerificationFlagged    = "flagged"
+	VerificationUnverified = "unverified"
+)
+
+type RubricCriterion struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	MaxPoints   float64 `json:"max_points"`
+}
+
+type Rubric []RubricCriterion
+
+func (r Rubric) Value() (driver.Value, error) {
+	return json.Marshal(r)
+}
+
+func (r *Rubric) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*r = nil
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), r)
+	case []byte:
+		return json.Unmarshal(v, r)
+	}
+	return errors.New("failed to scan Rubric")
+}
+
+// MaxPoints is the total score available under the rubric
+func (r Rubric) MaxPoints() float64 {
+	var total float64
+	for _, c := range r {
+		total += c.MaxPoints
+	}
+	return total
+}
+
+type Quiz struct {
+	gorm.Model
+	Title string `json:"title" gorm:"not null"`
+	//ForeignKeys
+	UserID uint `json:"user_id" gorm:"not null;index"`
+	User   User `json:"user,omitempty" gorm:"constraint:OnDelete:CASCADE"`
+
+	ChatID uint `json:"chat_id" gorm:"not null;index"`
+	Chat   Chat `json:"chat,omitempty" gorm:"constraint:OnDelete:CASCADE"`
+	//Relationships
+	Questions []Question `json:"questions,omitempty" gorm:"foreignKey:QuizID"`
+}
+
+type Question struct {
+	gorm.Model
+	Type        string `json:"type" gorm:"type:varchar(20);not null;default:'multiple_choice'"`
+	Prompt      string `json:"prompt" gorm:"type:text;not null"`
+	Explanation string `json:"explanation" gorm:"type:text"`
+	Position    int    `json:"position" gorm:"not null"`
+	Concept     string `json:"concept" gorm:"index"`
+	Difficulty  string `json:"difficulty" gorm:"type:varchar(10);not null;default:'medium'"`
+	//Free response
+	ExpectedAnswer string `json:"expected_answer" gorm:"type:text"`
+	Rubric         Rubric `json:"rubric" gorm:"type:json"`
+	//Verification
+	SourcePassage    string `json:"source_passage" gorm:"type:text"`
+	Verification     string `json:"verification" gorm:"type:varchar(12);not null;default:'unverified'"`
+	VerificationNote string `json:"verification_note" gorm:"type:text"`
+	//ForeignKeys
+	QuizID uint `json:"quiz_id" gorm:"not null;index"`
+	Quiz   Quiz `json:"quiz,omitempty" gorm:"constraint:OnDelete:CASCADE"`
+	//Relationships
+	Options []Option `json:"options,omitempty" gorm:"foreignKey:QuestionID"`
+}
+
+type Option struct {
+	gorm.Model
+	Text      string `json:"text" gorm:"type:text;not null"`
+	IsCorrect bool   `json:"is_correct" gorm:"not null;default:false"`
+	Position  int    `json:"position" gorm:"not null"`
+	//ForeignKeys
+	QuestionID uint     `json:"question_id" gorm:"not null;index"`
+	Question   Question `json:"question,omitempty" gorm:"constraint:OnDelete:CASCADE"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Study log activities
+const (
+	ActivityReading    = "reading"
+	ActivityChat       = "chat"
+	ActivityQuiz       = "quiz"
+	ActivityFlashcards = "flashcards"
+	ActivityExam       = "exam"
+	ActivityOther      = "other"
+)
+
+// StudyLog is a stretch of study time reported by the client
+type StudyLog struct {
+	gorm.Model
+	Activity        string    `json:"activity" gorm:"type:varchar(20);not null;default:'other'"`
+	DurationSeconds int       `json:"duration_seconds" gorm:"not null"`
+	StartedAt       time.Time `json:"started_at" gorm:"not null;index"`
+	//ForeignKeys
+	UserID uint `json:"user_id" gorm:"not null;index"`
+	User   User `json:"user,omitempty" gorm:"constraint:OnDelete:CASCADE"`
+
+	ChatID *uint `json:"chat_id" gorm:"index"`
+	Chat   *Chat `json:"chat,omitempty" gorm:"constraint:OnDelete:SET NULL"`
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type StudyPlan struct {
+	gorm.Model
+	Title        string    `json:"title" gorm:"not null"`
+	ExamDate     time.Time `json:"exam_date" gorm:"type:date;not null"`
+	DailyMinutes int       `json:"daily_minutes" gorm:"not null"`
+	// FeedToken authenticates the public calendar feed URL
+	FeedToken string `json:"-" gorm:"type:varchar(64);not null;uniqueIndex"`
+	//ForeignKeys
+	UserID uint `json:"user_id" gorm:"not null;index"`
+	User   User `json:"user,omitempty" gorm:"constraint:OnDelete:CASCADE"`
+
+	ChatID uint `json:"chat_id" gorm:"not null;index"`
+	Chat   Chat `json:"chat,omitempty" gorm:"constraint:OnDelete:CASCADE"`
+	//Relationships
+	Items []StudyPlanItem `json:"items,omitempty" gorm:"foreignKey:StudyPlanID"`
+}
+
+type StudyPlanItem struct {
+	gorm.Model
+	Date        time.Time  `json:"date" gorm:"type:date;not null;index"`
+	Kind        string     `json:"kind" gorm:"type:varchar(20);not null"`
+	Title       string     `json:"title" gorm:"not null"`
+	Description string     `json:"description" gorm:"type:text"`
+	Minutes     int        `json:"minutes" gorm:"not null;default:0"`
+	Concept     string     `json:"concept"`
+	Position    int        `json:"position" gorm:"not null"`
+	CompletedAt *time.Time `json:"completed_at"`
+	//ForeignKeys
+	StudyPlanID uint      `json:"study_plan_id" gorm:"not null;index"`
+	StudyPlan   StudyPlan `json:"study_plan,omitempty" gorm:"constraint:OnDelete:CASCADE"`
+
+	DocumentID *uint     `json:"document_id" gorm:"index"`
+	Document   *Document `json:"document,omitempty" gorm:"constraint:OnDelete:SET NULL"`
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Tutor session states
+const (
+	TutorActive    = "active"
+	TutorCompleted = "completed"
+)
+
+// Tutor step states; a step is attempted once the student has tried it
+const (
+	StepPending   = "pending"
+	StepAttempted = "attempted"
+	StepSolved    = "solved"
+)
+
+// TutorSession is one problem worked through in a tutor-mode chat
+type TutorSession struct {
+	gorm.Model
+	Problem string     `json:"problem" gorm:"type:text;not null"`
+	Goal    string     `json:"goal" gorm:"type:text"`
+	Status  string     `json:"status" gorm:"type:varchar(12);not null;default:'active';index"`
+	Summary string     `json:"summary" gorm:"type:text"`
+	EndedAt *time.Time `json:"ended_at"`
+	//ForeignKeys
+	UserID uint `json:"user_id" gorm:"not null;index"`
+	User   User `json:"user,omitempty" gorm:"constraint:OnDelete:CASCADE"`
+
+	ChatID uint `json:"chat_id" gorm:"not null;index"`
+	Chat   Chat `json:"chat,omitempty" gorm:"constraint:OnDelete:CASCADE"`
+	//Relationships
+	Steps []TutorStep `json:"steps,omitempty" gorm:"foreignKey:TutorSessionID"`
+}
+
+// TutorStep is a sub-step of the problem the student has to work out
+type TutorStep struct {
+	gorm.Model
+	Position    int        `json:"position" gorm:"not null"`
+	Description string     `json:"description" gorm:"type:text;not null"`
+	Answer      string     `json:"answer" gorm:"type:text"`
+	Status      string     `json:"status" gorm:"type:varchar(12);not null;default:'pending'"`
+	Attempts    int        `json:"attempts" gorm:"not null;default:0"`
+	SolvedAt    *time.Time `json:"solved_at"`
+	//ForeignKeys
+	TutorSessionID uint         `json:"tutor_session_id" gorm:"not null;index"`
+	TutorSession   TutorSession `json:"tutor_session,omitempty" gorm:"constraint:OnDelete:CASCADE"`
+}
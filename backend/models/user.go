@@ -2,11 +2,19 @@ package models
 
 import "gorm.io/gorm"
 
+// User roles; reviewers may override the grades of any user's answers. The role
+// is granted directly in the database.
+const (
+	RoleStudent  = "student"
+	RoleReviewer = "reviewer"
+)
+
 type User struct {
 	gorm.Model
 	Name         string `json:"name" gorm:"not null"`
 	Email        string `json:"email" gorm:"uniqueIndex;not null"`
 	PasswordHash string `json:"-" gorm:"not null"`
+	Role         string `json:"role" gorm:"type:varchar(20);not null;default:'student'"`
 	//Relationships
 	Chat []Chat     `json:"chats,omitempty" gorm:"foreignKey:UserID"`
 	Docs []Document `json:"documents,omitempty" gorm:"foreignKey:UserID"`
@@ -0,0 +1,195 @@
+// Package realtime fans out chat events to connected WebSocket clients and
+// keeps a short history so reconnecting clients can catch up.
+package realtime
+
+import (
+	"sync"
+)
+
+// Event is a frame sent to a client. Events published to a chat carry a
+// sequence number; replies to one client's request do not.
+type Event struct {
+	Seq    uint64      `json:"seq,omitempty"`
+	Type   string      `json:"type"`
+	ChatID uint        `json:"chat_id,omitempty"`
+	Ref    string      `json:"ref,omitempty"`
+	Data   interface{} `json:"data,omitempty"`
+}
+
+// clientBuffer is how many events may wait for a slow client before it is dropped
+const clientBuffer = 64
+
+// Client is one connection. Its events are read from Out by a single writer.
+type Client struct {
+	UserID uint
+	Out    chan Event
+
+	mu     sync.Mutex
+	closed bool
+	chats  map[uint]bool
+}
+
+// Send queues e for the client. It reports false when the client is closed or
+// too far behind to keep up.
+func (c *Client) Send(e Event) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return false
+	}
+	select {
+	case c.Out <- e:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close stops the client's writer; safe to call more than once
+func (c *Client) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.closed {
+		c.closed = true
+		close(c.Out)
+	}
+}
+
+// historySize is how many recent events are kept for resuming clients
+const historySize = 1000
+
+type Hub struct {
+	mu      sync.RWMutex
+	seq     uint64
+	chats   map[uint]map[*Client]bool
+	history []Event
+}
+
+func NewHub() *Hub {
+	return &Hub{chats: make(map[uint]map[*Client]bool)}
+}
+
+// Default is the hub shared by the whole server
+var Default = NewHub()
+
+func (h *Hub) Register(userID uint) *Client {
+	return &Client{
+		UserID: userID,
+		Out:    make(chan Event, clientBuffer),
+		chats:  make(map[uint]bool),
+	}
+}
+
+// Unregister removes the client from every chat and closes it
+func (h *Hub) Unregister(c *Client) {
+	h.mu.Lock()
+	c.mu.Lock()
+	for chatID := range c.chats {
+		delete(h.chats[chatID], c)
+		if len(h.chats[chatID]) == 0 {
+			delete(h.chats, chatID)
+		}
+	}
+	c.chats = make(map[uint]bool)
+	c.mu.Unlock()
+	h.mu.Unlock()
+
+	c.Close()
+}
+
+// Subscribe delivers the chat's events to the client. The caller checks that
+// the client's user may see the chat.
+func (h *Hub) Subscribe(c *Client, chatID uint) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.chats[chatID] == nil {
+		h.chats[chatID] = make(map[*Client]bool)
+	}
+	h.chats[chatID][c] = true
+
+	c.mu.Lock()
+	c.chats[chatID] = true
+	c.mu.Unlock()
+}
+
+func (h *Hub) Unsubscribe(c *Client, chatID uint) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.chats[chatID], c)
+	if len(h.chats[chatID]) == 0 {
+		delete(h.chats, chatID)
+	}
+
+	c.mu.Lock()
+	delete(c.chats, chatID)
+	c.mu.Unlock()
+}
+
+// Subscribed reports whether the client receives the chat's events
+func (c *Client) Subscribed(chatID uint) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.chats[chatID]
+}
+
+// Seq is the sequence number of the latest event
+func (h *Hub) Seq() uint64 {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.seq
+}
+
+// Publish numbers the event, records it and sends it to the chat's subscribers.
+// Subscribers that cannot keep up are closed; they resume after reconnecting.
+func (h *Hub) Publish(chatID uint, eventType string, data interface{}) Event {
+	h.mu.Lock()
+	h.seq++
+	e := Event{Seq: h.seq, Type: eventType, ChatID: chatID, Data: data}
+	h.history = append(h.history, e)
+	if len(h.history) > historySize {
+		h.history = h.history[len(h.history)-historySize:]
+	}
+
+	var slow []*Client
+	for c := range h.chats[chatID] {
+		if !c.Send(e) {
+			slow = append(slow, c)
+		}
+	}
+	h.mu.Unlock()
+
+	for _, c := range slow {
+		c.Close()
+	}
+	return e
+}
+
+// Since returns the events of chats published after seq. It reports false when
+// some of them are no longer kept, or seq is from before a server restart, in
+// which case the client has to reload over the REST API.
+func (h *Hub) Since(seq uint64, chats map[uint]bool) ([]Event, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if seq > h.seq {
+		return nil, false
+	}
+	if seq == h.seq {
+		return nil, true
+	}
+	if len(h.history) == 0 || h.history[0].Seq > seq+1 {
+		return nil, false
+	}
+
+	var events []Event
+	for _, e := range h.history {
+		if e.Seq > seq && chats[e.ChatID] {
+			events = append(events, e)
+		}
+	}
+	return events, true
+}
@@ -0,0 +1,89 @@
+package realtime
+
+import "testing"
+
+func seqs(events []Event) []uint64 {
+	var s []uint64
+	for _, e := range events {
+		s = append(s, e.Seq)
+	}
+	return s
+}
+
+func TestHubSince(t *testing.T) {
+	h := NewHub()
+	for _, chatID := range []uint{1, 2, 1, 3, 1} {
+		h.Publish(chatID, "message.created", nil)
+	}
+
+	tests := []struct {
+		name  string
+		seq   uint64
+		chats map[uint]bool
+		want  []uint64
+		ok    bool
+	}{
+		{"from the start", 0, map[uint]bool{1: true}, []uint64{1, 3, 5}, true},
+		{"several chats", 2, map[uint]bool{1: true, 3: true}, []uint64{3, 4, 5}, true},
+		{"nothing subscribed", 0, nil, nil, true},
+		{"up to date", 5, map[uint]bool{1: true}, nil, true},
+		{"from before a restart", 6, map[uint]bool{1: true}, nil, false},
+	}
+	for _, tt := range tests {
+		events, ok := h.Since(tt.seq, tt.chats)
+		got := seqs(events)
+		if ok != tt.ok || len(got) != len(tt.want) {
+			t.Errorf("%s: Since(%d) = %v, %v; want %v, %v", tt.name, tt.seq, got, ok, tt.want, tt.ok)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: Since(%d) = %v, want %v", tt.name, tt.seq, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestHubSinceAfterHistoryTrimmed(t *testing.T) {
+	h := NewHub()
+	for i := 0; i < historySize+10; i++ {
+		h.Publish(1, "message.created", nil)
+	}
+	chats := map[uint]bool{1: true}
+
+	if _, ok := h.Since(5, chats); ok {
+		t.Error("resumed from an event that is no longer kept")
+	}
+	// The oldest kept event is number 11, so resuming after 10 still works
+	events, ok := h.Since(10, chats)
+	if !ok || len(events) != historySize || events[0].Seq != 11 {
+		t.Errorf("Since(10) = %d events, %v; want all %d kept", len(events), ok, historySize)
+	}
+}
+
+func TestPublishClosesSlowClient(t *testing.T) {
+	h := NewHub()
+	fast, slow := h.Register(1), h.Register(2)
+	h.Subscribe(fast, 1)
+	h.Subscribe(slow, 1)
+
+	for i := 0; i < clientBuffer+1; i++ {
+		h.Publish(1, "message.created", nil)
+		<-fast.Out
+	}
+
+	if !fast.Send(Event{Type: "ping"}) {
+		t.Error("a client that keeps up was closed")
+	}
+	n := 0
+	for range slow.Out {
+		n++
+	}
+	if n != clientBuffer {
+		t.Errorf("slow client got %d events before being closed, want %d", n, clientBuffer)
+	}
+	if slow.Send(Event{Type: "ping"}) {
+		t.Error("sent to a closed client")
+	}
+}
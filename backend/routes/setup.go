@@ -4,10 +4,11 @@ import (
 	"github.com/MadMax168/Readsum/handlers"
 	"github.com/MadMax168/Readsum/middleware"
 
+	"github.com/gofiber/contrib/websocket"
 	"github.com/gofiber/fiber/v2"
 )
 
-func SetAllRoutes(app *fiber.App) {
+func SetAllRoutes(app *fiber.App, h *handlers.Handler) {
 	app.Post("/register", handlers.Register)
 	app.Post("/login", handlers.Login)
 
@@ -19,19 +20,121 @@ func SetAllRoutes(app *fiber.App) {
 
 	users.Get("/me", handlers.GetUser)
 	users.Patch("/me/password", handlers.UpdPass)
+	users.Get("/me/quiz-attempts", handlers.GetUserAttempts)
+	users.Get("/me/analytics", handlers.GetUserAnalytics)
+	users.Post("/me/study-logs", handlers.LogStudy)
+
+	// Live chat transport: one WebSocket carries every chat the client subscribes to
+	v1.Get("/ws", middleware.WebSocketAuth, websocket.New(h.ChatSocket))
+
+	// Persona Routes: reusable assistant voices applied to chats
+	personas := v1.Group("/personas", middleware.AuthMiddleware)
+	personas.Get("/", handlers.GetPersonas)
+	personas.Post("/", handlers.CreatePersona)
+	personas.Patch("/:personaID", handlers.UpdPersona)
+	personas.Delete("/:personaID", handlers.DelPersona)
 
 	// Chat Routes
 	chats := v1.Group("/chats", middleware.AuthMiddleware)
 	chats.Get("/", handlers.GetChat)
 	chats.Post("/", handlers.Create)
-	chats.Patch("/:chatID", handlers.UpdChat)
+	chats.Patch("/:chatID", h.UpdChat)
 	chats.Delete("/:chatID", handlers.DelChat)
+	chats.Get("/:chatID/analytics", middleware.ChatIDMiddleware, handlers.GetChatAnalytics)
+	chats.Put("/:chatID/model-settings", middleware.ChatIDMiddleware, handlers.UpdModelSettings)
+
+	// Models and setting ranges chats may choose from
+	v1.Get("/model-limits", middleware.AuthMiddleware, handlers.GetModelLimits)
 
 	// Message Routes (Nested under chat)
 	// Add ChatIDMiddleware to extract chatID from URL
 	messages := chats.Group("/:chatID/messages", middleware.ChatIDMiddleware)
 	messages.Get("/", handlers.GetMessage)
-	messages.Post("/", handlers.PostMessage)
-	messages.Patch("/:messageID", handlers.UpdMessage)
+	messages.Post("/", h.PostMessage)
+	messages.Post("/stream", h.StreamMessage)
+	messages.Patch("/:messageID", h.UpdMessage)
 	messages.Delete("/:messageID", handlers.DelMessage)
+	messages.Post("/:messageID/regenerate", h.RegenerateMessage)
+	messages.Post("/:messageID/branches", h.BranchMessage)
+	messages.Post("/:messageID/activate", handlers.SwitchBranch)
+
+	// Tutor Session Routes (Nested under chat)
+	tutor := chats.Group("/:chatID/tutor-sessions", middleware.ChatIDMiddleware)
+	tutor.Get("/", handlers.GetTutorSessions)
+	tutor.Get("/:sessionID", handlers.GetTutorSession)
+	tutor.Post("/:sessionID/end", h.EndTutorSession)
+
+	// Quiz Routes (Nested under chat)
+	quizzes := chats.Group("/:chatID/quizzes", middleware.ChatIDMiddleware)
+	quizzes.Get("/", handlers.GetQuizzes)
+	quizzes.Post("/", h.CreateQuiz)
+	quizzes.Post("/adaptive", h.CreateAdaptiveQuiz)
+	quizzes.Get("/:quizID", handlers.GetQuiz)
+	quizzes.Delete("/:quizID", handlers.DelQuiz)
+	quizzes.Get("/:quizID/attempts", handlers.GetQuizAttempts)
+	quizzes.Post("/:quizID/attempts", h.SubmitAttempt)
+	quizzes.Get("/:quizID/attempts/:attemptID", handlers.GetQuizAttempt)
+	quizzes.Patch("/:quizID/attempts/:attemptID/answers/:answerID", handlers.OverrideAnswer)
+
+	// Flashcard Routes
+	chatDecks := chats.Group("/:chatID/decks", middleware.ChatIDMiddleware)
+	chatDecks.Get("/", handlers.GetChatDecks)
+	chatDecks.Post("/", h.CreateDeck)
+	chats.Post("/:chatID/documents/:documentID/cloze", middleware.ChatIDMiddleware, h.CreateClozeCards)
+
+	// Study Guide Routes (Nested under chat)
+	guides := chats.Group("/:chatID/study-guides", middleware.ChatIDMiddleware)
+	guides.Get("/", handlers.GetStudyGuides)
+	guides.Post("/", h.CreateStudyGuide)
+	guides.Get("/:guideID", handlers.GetStudyGuide)
+	guides.Delete("/:guideID", handlers.DelStudyGuide)
+	guides.Get("/:guideID/export", handlers.ExportStudyGuide)
+
+	// Exam Routes (Nested under chat)
+	exams := chats.Group("/:chatID/exams", middleware.ChatIDMiddleware)
+	exams.Get("/", handlers.GetExams)
+	exams.Post("/", handlers.CreateExam)
+	exams.Get("/:examID", handlers.GetExam)
+	exams.Delete("/:examID", handlers.DelExam)
+	exams.Put("/:examID/answers", handlers.SaveExamAnswers)
+	exams.Post("/:examID/submit", h.SubmitExam)
+
+	// Mind Map Routes (Nested under chat)
+	mindMaps := chats.Group("/:chatID/mind-maps", middleware.ChatIDMiddleware)
+	mindMaps.Get("/", handlers.GetMindMaps)
+	mindMaps.Post("/", h.CreateMindMap)
+	mindMaps.Get("/:mapID", handlers.GetMindMap)
+	mindMaps.Delete("/:mapID", handlers.DelMindMap)
+	mindMaps.Get("/:mapID/export", handlers.ExportMindMap)
+	mindMaps.Post("/:mapID/nodes", handlers.AddMindMapNode)
+	mindMaps.Patch("/:mapID/nodes/:nodeID", handlers.UpdMindMapNode)
+	mindMaps.Delete("/:mapID/nodes/:nodeID", handlers.DelMindMapNode)
+
+	// Study Plan Routes (Nested under chat)
+	plans := chats.Group("/:chatID/study-plans", middleware.ChatIDMiddleware)
+	plans.Get("/", handlers.GetStudyPlans)
+	plans.Post("/", handlers.CreateStudyPlan)
+	plans.Get("/:planID", handlers.GetStudyPlan)
+	plans.Delete("/:planID", handlers.DelStudyPlan)
+	plans.Get("/:planID/export", handlers.ExportStudyPlan)
+	plans.Post("/:planID/feed-token", handlers.RotateStudyPlanFeed)
+	plans.Patch("/:planID/items/:itemID", handlers.UpdStudyPlanItem)
+
+	// Calendar subscription feed; the token in the URL authenticates it
+	v1.Get("/study-plans/feed/:token", handlers.StudyPlanFeed)
+
+	// CSV / TSV / Quizlet Import Routes
+	imports := v1.Group("/imports", middleware.AuthMiddleware)
+	imports.Post("/preview", handlers.PreviewImport)
+	imports.Post("/", handlers.ImportTabular)
+
+	decks := v1.Group("/decks", middleware.AuthMiddleware)
+	decks.Get("/", handlers.GetDecks)
+	decks.Get("/due", handlers.GetDueCards)
+	decks.Post("/import", handlers.ImportDeck)
+	decks.Get("/:deckID", handlers.GetDeck)
+	decks.Delete("/:deckID", handlers.DelDeck)
+	decks.Get("/:deckID/due", handlers.GetDueCards)
+	decks.Get("/:deckID/export", handlers.ExportDeck)
+	decks.Post("/:deckID/cards/:cardID/review", handlers.ReviewCard)
 }
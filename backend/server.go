@@ -5,8 +5,10 @@ import (
 	"os"
 
 	"github.com/MadMax168/Readsum/config"
+	"github.com/MadMax168/Readsum/handlers"
 	"github.com/MadMax168/Readsum/models"
 	"github.com/MadMax168/Readsum/routes"
+	"github.com/MadMax168/Readsum/services"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/joho/godotenv"
@@ -22,15 +24,54 @@ func main() {
 
 	config.ConnectDB()
 
+	provider, err := config.ConnectLLM()
+	if err != nil {
+		log.Fatal(err)
+	}
+	h := handlers.New(services.NewAI(provider))
+
 	config.DB.AutoMigrate(
+		&models.Migration{},
 		&models.User{},
+		&models.Persona{},
 		&models.Chat{},
 		&models.Message{},
 		&models.Document{},
 		&models.Relationship{},
+		&models.Quiz{},
+		&models.Question{},
+		&models.Option{},
+		&models.QuizAttempt{},
+		&models.Answer{},
+		&models.Deck{},
+		&models.Card{},
+		&models.CardReview{},
+		&models.StudyGuide{},
+		&models.MindMap{},
+		&models.MindMapNode{},
+		&models.Exam{},
+		&models.ExamQuestion{},
+		&models.StudyLog{},
+		&models.StudyPlan{},
+		&models.StudyPlanItem{},
+		&models.TutorSession{},
+		&models.TutorStep{},
 	)
 
-	app := fiber.New()
+	// Chats from before branching get their messages linked into a single branch
+	if err := config.RunOnce(config.DB, "link_message_trees", handlers.LinkMessageTrees); err != nil {
+		log.Println("Failed to link chat messages: " + err.Error())
+	}
+
+	// Push saved messages and documents to WebSocket subscribers
+	handlers.RegisterRealtimeCallbacks(config.DB)
+
+	// Grade exams whose time ran out without being submitted
+	go h.GradeExpiredExams()
+
+	app := fiber.New(fiber.Config{
+		BodyLimit: 32 * 1024 * 1024, // Allow uploads such as Anki packages
+	})
 
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     "http://localhost:3000",
@@ -39,7 +80,7 @@ func main() {
 		AllowCredentials: true,
 	}))
 
-	routes.SetAllRoutes(app)
+	routes.SetAllRoutes(app, h)
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"math"
+	"sort"
+)
+
+// ConceptAccuracy is a student's track record on one concept
+type ConceptAccuracy struct {
+	Concept   string  `json:"concept"`
+	Answered  int     `json:"answered"`
+	Points    float64 `json:"points"`
+	MaxPoints float64 `json:"max_points"`
+}
+
+// Accuracy is the share of available points earned, between 0 and 1
+func (c ConceptAccuracy) Accuracy() float64 {
+	if c.MaxPoints == 0 {
+		return 0
+	}
+	return c.Points / c.MaxPoints
+}
+
+const (
+	weakAccuracy     = 0.5
+	masteredAccuracy = 0.8
+	// A concept needs this many answers before it can count as mastered
+	masteredMinAnswers = 3
+)
+
+// PlanAdaptiveQuiz spreads count questions over the concepts a student has already
+// met: weak concepts get more and easier questions, mastered ones fewer and harder
+// questions, and a share of the quiz is kept for concepts not tested yet.
+func PlanAdaptiveQuiz(stats []ConceptAccuracy, count int) QuizPlan {
+	plan := QuizPlan{}
+	for _, s := range stats {
+		plan.KnownConcepts = append(plan.KnownConcepts, s.Concept)
+	}
+
+	if len(stats) == 0 || count < 1 {
+		plan.NewConcepts = count
+		return plan
+	}
+
+	// Keep about a fifth of the quiz for new material once there is room for it
+	if count >= 3 {
+		plan.NewConcepts = int(math.Max(1, math.Round(float64(count)*0.2)))
+	}
+	remaining := count - plan.NewConcepts
+
+	type candidate struct {
+		focus  QuizFocus
+		weight float64
+		score  float64
+	}
+
+	var candidates []candidate
+	for _, s := range stats {
+		acc := s.Accuracy()
+		c := candidate{focus: QuizFocus{Concept: s.Concept}, score: acc}
+
+		switch {
+		case acc < weakAccuracy:
+			c.weight = 3
+			c.focus.Difficulty = DifficultyEasy
+			if acc >= weakAccuracy/2 {
+				c.focus.Difficulty = DifficultyMedium
+			}
+			c.focus.Reason = "weak"
+		case acc >= masteredAccuracy && s.Answered >= masteredMinAnswers:
+			c.weight = 1
+			c.focus.Difficulty = DifficultyHard
+			c.focus.Reason = "mastered"
+		default:
+			c.weight = 2
+			c.focus.Difficulty = DifficultyMedium
+			c.focus.Reason = "developing"
+		}
+		candidates = append(candidates, c)
+	}
+
+	// Weakest concepts first so they win ties when questions run out
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].score < candidates[j].score
+	})
+
+	var totalWeight float64
+	for _, c := range candidates {
+		totalWeight += c.weight
+	}
+
+	// Largest remainder apportionment of the remaining questions by weight
+	type share struct {
+		index     int
+		remainder float64
+	}
+	var shares []share
+	assigned := 0
+	for i := range candidates {
+		exact := float64(remaining) * candidates[i].weight / totalWeight
+		candidates[i].focus.Count = int(exact)
+		assigned += candidates[i].focus.Count
+		shares = append(shares, share{i, exact - float64(candidates[i].focus.Count)})
+	}
+	sort.SliceStable(shares, func(i, j int) bool {
+		return shares[i].remainder > shares[j].remainder
+	})
+	for i := 0; assigned < remaining && i < len(shares); i++ {
+		candidates[shares[i].index].focus.Count++
+		assigned++
+	}
+
+	for _, c := range candidates {
+		if c.focus.Count > 0 {
+			plan.Focus = append(plan.Focus, c.focus)
+		}
+	}
+
+	return plan
+}
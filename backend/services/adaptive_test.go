@@ -0,0 +1,87 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPlanAdaptiveQuiz(t *testing.T) {
+	tests := []struct {
+		name      string
+		stats     []ConceptAccuracy
+		count     int
+		wantFocus []QuizFocus
+		wantNew   int
+	}{
+		{
+			name:    "nothing answered yet",
+			count:   5,
+			wantNew: 5,
+		},
+		{
+			name: "weak, developing and mastered concepts",
+			stats: []ConceptAccuracy{
+				{Concept: "genes", Answered: 5, Points: 9, MaxPoints: 10},
+				{Concept: "cells", Answered: 4, Points: 1, MaxPoints: 10},
+				{Concept: "energy", Answered: 4, Points: 6, MaxPoints: 10},
+			},
+			count: 10,
+			wantFocus: []QuizFocus{
+				{Concept: "cells", Difficulty: DifficultyEasy, Count: 4, Reason: "weak"},
+				{Concept: "energy", Difficulty: DifficultyMedium, Count: 3, Reason: "developing"},
+				{Concept: "genes", Difficulty: DifficultyHard, Count: 1, Reason: "mastered"},
+			},
+			wantNew: 2,
+		},
+		{
+			name:  "too few answers to count as mastered",
+			stats: []ConceptAccuracy{{Concept: "genes", Answered: 2, Points: 2, MaxPoints: 2}},
+			count: 2,
+			wantFocus: []QuizFocus{
+				{Concept: "genes", Difficulty: DifficultyMedium, Count: 2, Reason: "developing"},
+			},
+		},
+		{
+			name: "weakest concept wins the only question",
+			stats: []ConceptAccuracy{
+				{Concept: "genes", Answered: 3, Points: 3, MaxPoints: 3},
+				{Concept: "cells", Answered: 10, Points: 3, MaxPoints: 10},
+			},
+			count: 1,
+			wantFocus: []QuizFocus{
+				{Concept: "cells", Difficulty: DifficultyMedium, Count: 1, Reason: "weak"},
+			},
+		},
+		{
+			name:  "no questions",
+			stats: []ConceptAccuracy{{Concept: "cells", Answered: 1, Points: 0, MaxPoints: 1}},
+			count: 0,
+		},
+	}
+	for _, tt := range tests {
+		plan := PlanAdaptiveQuiz(tt.stats, tt.count)
+		if !reflect.DeepEqual(plan.Focus, tt.wantFocus) || plan.NewConcepts != tt.wantNew {
+			t.Errorf("%s: focus %+v with %d new, want %+v with %d new", tt.name, plan.Focus, plan.NewConcepts, tt.wantFocus, tt.wantNew)
+		}
+		if len(plan.KnownConcepts) != len(tt.stats) {
+			t.Errorf("%s: known concepts %v, want every concept answered", tt.name, plan.KnownConcepts)
+		}
+
+		total := plan.NewConcepts
+		for _, f := range plan.Focus {
+			total += f.Count
+		}
+		if total != tt.count {
+			t.Errorf("%s: planned %d questions, want %d", tt.name, total, tt.count)
+		}
+	}
+}
+
+func TestConceptAccuracy(t *testing.T) {
+	if got := (ConceptAccuracy{Points: 3, MaxPoints: 4}).Accuracy(); got != 0.75 {
+		t.Errorf("Accuracy() = %v, want 0.75", got)
+	}
+	if got := (ConceptAccuracy{}).Accuracy(); got != 0 {
+		t.Errorf("Accuracy() of an unanswered concept = %v, want 0", got)
+	}
+}
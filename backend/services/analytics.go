@@ -0,0 +1,200 @@
+package services
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Sources of mastery evidence
+const (
+	SourceQuiz       = "quiz"
+	SourceExam       = "exam"
+	SourceFlashcards = "flashcards"
+)
+
+// MasteryEvent is one graded piece of evidence about a concept: an answered
+// question or a flashcard review
+type MasteryEvent struct {
+	Concept   string
+	Source    string
+	Points    float64
+	MaxPoints float64
+	At        time.Time
+}
+
+// StudySession is time spent studying, reported by the client or derived from exams
+type StudySession struct {
+	Start   time.Time
+	Seconds int
+}
+
+type ConceptMastery struct {
+	Concept       string
+	Mastery       float64
+	Accuracy      float64
+	Attempts      int
+	Sources       []string
+	Level         string
+	LastPracticed time.Time
+}
+
+// Mastery levels
+const (
+	LevelWeak      = "weak"
+	LevelLearning  = "learning"
+	LevelMastered  = "mastered"
+	masteryHalfAge = 30 * 24 * time.Hour
+	// Evidence needed before the score gets close to the weighted accuracy
+	masteryPrior = 2.0
+)
+
+// ComputeMastery scores each concept between 0 and 1. Evidence is weighted by
+// age (half weight after 30 days) and the weighted accuracy is shrunk towards
+// zero while there is little of it, so one lucky answer is not mastery.
+func ComputeMastery(events []MasteryEvent, now time.Time) []ConceptMastery {
+	type acc struct {
+		mastery          ConceptMastery
+		weight           float64
+		points, possible float64
+		sources          map[string]bool
+	}
+
+	byConcept := make(map[string]*acc)
+	for _, e := range events {
+		if e.Concept == "" || e.MaxPoints <= 0 {
+			continue
+		}
+
+		a, ok := byConcept[e.Concept]
+		if !ok {
+			a = &acc{mastery: ConceptMastery{Concept: e.Concept}, sources: make(map[string]bool)}
+			byConcept[e.Concept] = a
+		}
+
+		age := now.Sub(e.At)
+		if age < 0 {
+			age = 0
+		}
+		w := math.Pow(0.5, float64(age)/float64(masteryHalfAge))
+
+		a.weight += w
+		a.points += w * e.Points
+		a.possible += w * e.MaxPoints
+		a.mastery.Attempts++
+		a.sources[e.Source] = true
+		if e.At.After(a.mastery.LastPracticed) {
+			a.mastery.LastPracticed = e.At
+		}
+	}
+
+	var result []ConceptMastery
+	for _, a := range byConcept {
+		m := a.mastery
+		m.Accuracy = round2(a.points / a.possible)
+		m.Mastery = round2(a.points / a.possible * a.weight / (a.weight + masteryPrior))
+
+		switch {
+		case m.Mastery >= masteredAccuracy:
+			m.Level = LevelMastered
+		case m.Mastery >= weakAccuracy:
+			m.Level = LevelLearning
+		default:
+			m.Level = LevelWeak
+		}
+
+		for s := range a.sources {
+			m.Sources = append(m.Sources, s)
+		}
+		sort.Strings(m.Sources)
+		result = append(result, m)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Concept < result[j].Concept
+	})
+
+	return result
+}
+
+// WeakestConcepts returns up to limit concepts with the lowest mastery
+func WeakestConcepts(concepts []ConceptMastery, limit int) []ConceptMastery {
+	weakest := append([]ConceptMastery(nil), concepts...)
+	sort.SliceStable(weakest, func(i, j int) bool {
+		return weakest[i].Mastery < weakest[j].Mastery
+	})
+	if len(weakest) > limit {
+		weakest = weakest[:limit]
+	}
+	return weakest
+}
+
+type DailyActivity struct {
+	Date              time.Time
+	QuestionsAnswered int
+	Points            float64
+	MaxPoints         float64
+	CardsReviewed     int
+	CardsRecalled     int
+	StudySeconds      int
+}
+
+// Accuracy is the share of question points earned that day, between 0 and 1
+func (d DailyActivity) Accuracy() float64 {
+	if d.MaxPoints == 0 {
+		return 0
+	}
+	return round2(d.Points / d.MaxPoints)
+}
+
+// DailyTimeSeries buckets events and study sessions into days ending today,
+// in loc, so the dashboard can chart them without gaps
+func DailyTimeSeries(events []MasteryEvent, sessions []StudySession, days int, now time.Time, loc *time.Location) []DailyActivity {
+	today := startOfDay(now.In(loc))
+	first := today.AddDate(0, 0, -(days - 1))
+
+	series := make([]DailyActivity, days)
+	// Index days by calendar date rather than hours so DST changes do not shift buckets
+	index := make(map[string]int, days)
+	for i := range series {
+		series[i].Date = first.AddDate(0, 0, i)
+		index[series[i].Date.Format("2006-01-02")] = i
+	}
+
+	bucket := func(t time.Time) *DailyActivity {
+		i, ok := index[t.In(loc).Format("2006-01-02")]
+		if !ok {
+			return nil
+		}
+		return &series[i]
+	}
+
+	for _, e := range events {
+		d := bucket(e.At)
+		if d == nil {
+			continue
+		}
+		if e.Source == SourceFlashcards {
+			d.CardsReviewed++
+			if e.Points > 0 {
+				d.CardsRecalled++
+			}
+			continue
+		}
+		d.QuestionsAnswered++
+		d.Points += e.Points
+		d.MaxPoints += e.MaxPoints
+	}
+
+	for _, s := range sessions {
+		if d := bucket(s.Start); d != nil {
+			d.StudySeconds += s.Seconds
+		}
+	}
+
+	return series
+}
+
+func round2(f float64) float64 {
+	return math.Round(f*100) / 100
+}
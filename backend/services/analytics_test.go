@@ -0,0 +1,112 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestComputeMastery(t *testing.T) {
+	now := time.Date(2026, 3, 20, 12, 0, 0, 0, time.UTC)
+	monthAgo := now.Add(-masteryHalfAge)
+
+	var events []MasteryEvent
+	for i := 0; i < 8; i++ {
+		source := SourceQuiz
+		if i%2 == 1 {
+			source = SourceFlashcards
+		}
+		events = append(events, MasteryEvent{Concept: "leaves", Source: source, Points: 1, MaxPoints: 1, At: now.Add(-time.Hour)})
+	}
+	events = append(events,
+		MasteryEvent{Concept: "light", Source: SourceExam, Points: 2, MaxPoints: 2, At: now},
+		MasteryEvent{Concept: "light", Source: SourceExam, Points: 0, MaxPoints: 2, At: now},
+		MasteryEvent{Concept: "light", Source: SourceExam, Points: 2, MaxPoints: 2, At: now},
+		MasteryEvent{Concept: "light", Source: SourceQuiz, Points: 2, MaxPoints: 2, At: now.Add(time.Hour)},
+		MasteryEvent{Concept: "oxygen", Source: SourceQuiz, Points: 1, MaxPoints: 1, At: monthAgo},
+		MasteryEvent{Concept: "oxygen", Source: SourceQuiz, Points: 0, MaxPoints: 1, At: now},
+		MasteryEvent{Concept: "water", Source: SourceQuiz, Points: 1, MaxPoints: 1, At: now},
+		// Events without a concept or a score are ignored
+		MasteryEvent{Concept: "", Source: SourceQuiz, Points: 1, MaxPoints: 1, At: now},
+		MasteryEvent{Concept: "water", Source: SourceQuiz, Points: 0, MaxPoints: 0, At: now},
+	)
+
+	tests := []struct {
+		concept           string
+		mastery, accuracy float64
+		attempts          int
+		sources           []string
+		level             string
+		last              time.Time
+	}{
+		{"leaves", 0.8, 1, 8, []string{SourceFlashcards, SourceQuiz}, LevelMastered, now.Add(-time.Hour)},
+		// Six points of eight, with four answers of weight one (the future one counts as now)
+		{"light", 0.5, 0.75, 4, []string{SourceExam, SourceQuiz}, LevelLearning, now.Add(time.Hour)},
+		// The month-old correct answer counts half as much as today's wrong one
+		{"oxygen", 0.14, 0.33, 2, []string{SourceQuiz}, LevelWeak, now},
+		// One right answer is not enough evidence
+		{"water", 0.33, 1, 1, []string{SourceQuiz}, LevelWeak, now},
+	}
+
+	got := ComputeMastery(events, now)
+	if len(got) != len(tests) {
+		t.Fatalf("got %d concepts, want %d", len(got), len(tests))
+	}
+	for i, tt := range tests {
+		m := got[i]
+		if m.Concept != tt.concept || m.Mastery != tt.mastery || m.Accuracy != tt.accuracy || m.Attempts != tt.attempts ||
+			!reflect.DeepEqual(m.Sources, tt.sources) || m.Level != tt.level || !m.LastPracticed.Equal(tt.last) {
+			t.Errorf("concept %d = %+v, want %s with mastery %v, accuracy %v, %d attempts, sources %v, level %s, last %v",
+				i, m, tt.concept, tt.mastery, tt.accuracy, tt.attempts, tt.sources, tt.level, tt.last)
+		}
+	}
+}
+
+func TestDailyTimeSeries(t *testing.T) {
+	// Clocks in Berlin go forward on 29 March 2026, so that day is 23 hours long
+	loc, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 3, 30, 0, 30, 0, 0, loc)
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2026, 3, day, hour, min, 0, 0, loc)
+	}
+
+	events := []MasteryEvent{
+		{Source: SourceQuiz, Points: 1, MaxPoints: 2, At: at(30, 0, 10)},
+		{Source: SourceExam, Points: 3, MaxPoints: 3, At: at(29, 23, 50)},
+		{Source: SourceFlashcards, Points: 4, MaxPoints: 5, At: at(29, 1, 0)},
+		{Source: SourceFlashcards, Points: 0, MaxPoints: 5, At: at(29, 4, 0)},
+		{Source: SourceQuiz, Points: 1, MaxPoints: 1, At: at(28, 0, 0)},
+		// Before the first day and after now
+		{Source: SourceQuiz, Points: 1, MaxPoints: 1, At: at(27, 23, 59)},
+		{Source: SourceQuiz, Points: 1, MaxPoints: 1, At: at(31, 0, 0)},
+	}
+	sessions := []StudySession{
+		// Reported in UTC, which is still the 29th; Berlin is already on the 30th
+		{Start: time.Date(2026, 3, 29, 22, 30, 0, 0, time.UTC), Seconds: 600},
+		{Start: at(29, 12, 0), Seconds: 300},
+		{Start: at(29, 13, 0), Seconds: 120},
+	}
+
+	got := DailyTimeSeries(events, sessions, 3, now, loc)
+	want := []DailyActivity{
+		{Date: at(28, 0, 0), QuestionsAnswered: 1, Points: 1, MaxPoints: 1},
+		{Date: at(29, 0, 0), QuestionsAnswered: 1, Points: 3, MaxPoints: 3, CardsReviewed: 2, CardsRecalled: 1, StudySeconds: 420},
+		{Date: at(30, 0, 0), QuestionsAnswered: 1, Points: 1, MaxPoints: 2, StudySeconds: 600},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DailyTimeSeries() =\n%+v\nwant\n%+v", got, want)
+	}
+	if a := got[2].Accuracy(); a != 0.5 {
+		t.Errorf("accuracy of the last day = %v, want 0.5", a)
+	}
+	if a := got[0].Accuracy(); a != 1 {
+		t.Errorf("accuracy of the first day = %v, want 1", a)
+	}
+	if a := (DailyActivity{}).Accuracy(); a != 0 {
+		t.Errorf("accuracy of an empty day = %v, want 0", a)
+	}
+}
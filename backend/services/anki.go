@@ -0,0 +1,664 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// AnkiReview is one entry of a card's review log
+type AnkiReview struct {
+	Grade      int // SM-2 grade 0-5
+	Interval   int
+	EaseFactor float64
+	ReviewedAt time.Time
+}
+
+// AnkiCard is a flashcard with its scheduling state, independent of the database models
+type AnkiCard struct {
+	Front       string
+	Back        string
+	IsNew       bool
+	EaseFactor  float64
+	Interval    int
+	Repetitions int
+	DueAt       time.Time
+	Reviews     []AnkiReview
+	// Cloze cards of one note share a NoteKey and ClozeText
+	ClozeText  string
+	ClozeIndex int
+	NoteKey    string
+}
+
+type AnkiDeck struct {
+	Name  string
+	Cards []AnkiCard
+}
+
+// Anki 2.1 legacy collection schema (version 11), which every Anki client can import
+const ankiSchema = `
+CREATE TABLE col (
+	id integer primary key, crt integer not null, mod integer not null, scm integer not null,
+	ver integer not null, dty integer not null, usn integer not null, ls integer not null,
+	conf text not null, models text not null, decks text not null, dconf text not null, tags text not null
+);
+CREATE TABLE notes (
+	id integer primary key, guid text not null, mid integer not null, mod integer not null,
+	usn integer not null, tags text not null, flds text not null, sfld integer not null,
+	csum integer not null, flags integer not null, data text not null
+);
+CREATE TABLE cards (
+	id integer primary key, nid integer not null, did integer not null, ord integer not null,
+	mod integer not null, usn integer not null, type integer not null, queue integer not null,
+	due integer not null, ivl integer not null, factor integer not null, reps integer not null,
+	lapses integer not null, left integer not null, odue integer not null, odid integer not null,
+	flags integer not null, data text not null
+);
+CREATE TABLE revlog (
+	id integer primary key, cid integer not null, usn integer not null, ease integer not null,
+	ivl integer not null, lastIvl integer not null, factor integer not null, time integer not null,
+	type integer not null
+);
+CREATE TABLE graves (usn integer not null, oid integer not null, type integer not null);
+CREATE INDEX ix_notes_usn on notes (usn);
+CREATE INDEX ix_cards_usn on cards (usn);
+CREATE INDEX ix_revlog_usn on revlog (usn);
+CREATE INDEX ix_cards_nid on cards (nid);
+CREATE INDEX ix_cards_sched on cards (did, queue, due);
+CREATE INDEX ix_revlog_cid on revlog (cid);
+CREATE INDEX ix_notes_csum on notes (csum);
+`
+
+// Anki card types and queues
+const (
+	ankiTypeNew    = 0
+	ankiTypeLearn  = 1
+	ankiTypeReview = 2
+	ankiTypeRelrn  = 3
+)
+
+// Anki note type kinds
+const (
+	ankiModelStandard = 0
+	ankiModelCloze    = 1
+)
+
+func ankiField(name string, ord int) map[string]interface{} {
+	return map[string]interface{}{
+		"name": name, "ord": ord, "sticky": false, "rtl": false,
+		"font": "Arial", "size": 20, "media": []string{},
+	}
+}
+
+const (
+	ankiLatexPre  = "\\documentclass[12pt]{article}\n\\special{papersize=3in,5in}\n\\usepackage{amssymb,amsmath}\n\\pagestyle{empty}\n\\begin{document}\n"
+	ankiLatexPost = "\\end{document}"
+	ankiCSS       = ".card { font-family: arial; font-size: 20px; text-align: center; color: black; background-color: white; }\n.cloze { font-weight: bold; color: blue; }"
+)
+
+func ankiBasicModel(id, deckID, now int64) map[string]interface{} {
+	field := ankiField
+
+	return map[string]interface{}{
+		"id":    id,
+		"name":  "ReadSum Basic",
+		"type":  ankiModelStandard,
+		"mod":   now,
+		"usn":   -1,
+		"sortf": 0,
+		"did":   deckID,
+		"tmpls": []map[string]interface{}{{
+			"name": "Card 1", "ord": 0,
+			"qfmt": "{{Front}}", "afmt": "{{FrontSide}}<hr id=answer>{{Back}}",
+			"did": nil, "bqfmt": "", "bafmt": "",
+		}},
+		"flds":      []map[string]interface{}{field("Front", 0), field("Back", 1)},
+		"css":       ankiCSS,
+		"latexPre":  ankiLatexPre,
+		"latexPost": ankiLatexPost,
+		"tags":      []string{},
+		"vers":      []string{},
+		"req":       []interface{}{[]interface{}{0, "all", []int{0}}},
+	}
+}
+
+func ankiClozeModel(id, deckID, now int64) map[string]interface{} {
+	return map[string]interface{}{
+		"id":    id,
+		"name":  "ReadSum Cloze",
+		"type":  ankiModelCloze,
+		"mod":   now,
+		"usn":   -1,
+		"sortf": 0,
+		"did":   deckID,
+		"tmpls": []map[string]interface{}{{
+			"name": "Cloze", "ord": 0,
+			"qfmt": "{{cloze:Text}}", "afmt": "{{cloze:Text}}<br>{{Back Extra}}",
+			"did": nil, "bqfmt": "", "bafmt": "",
+		}},
+		"flds":      []map[string]interface{}{ankiField("Text", 0), ankiField("Back Extra", 1)},
+		"css":       ankiCSS,
+		"latexPre":  ankiLatexPre,
+		"latexPost": ankiLatexPost,
+		"tags":      []string{},
+		"vers":      []string{},
+	}
+}
+
+func ankiDeck(id int64, name string, now int64) map[string]interface{} {
+	return map[string]interface{}{
+		"id": id, "name": name, "mod": now, "usn": -1, "desc": "", "dyn": 0, "conf": 1,
+		"collapsed": false, "extendNew": 10, "extendRev": 50,
+		"newToday": []int{0, 0}, "revToday": []int{0, 0}, "lrnToday": []int{0, 0}, "timeToday": []int{0, 0},
+	}
+}
+
+var ankiDeckConf = map[string]interface{}{
+	"1": map[string]interface{}{
+		"id": 1, "name": "Default", "mod": 0, "usn": 0, "maxTaken": 60, "autoplay": true,
+		"timer": 0, "replayq": true, "dyn": false,
+		"new": map[string]interface{}{
+			"delays": []int{1, 10}, "ints": []int{1, 4, 7}, "initialFactor": 2500,
+			"order": 1, "perDay": 20, "bury": true, "separate": true,
+		},
+		"rev": map[string]interface{}{
+			"perDay": 200, "ease4": 1.3, "fuzz": 0.05, "minSpace": 1,
+			"ivlFct": 1, "maxIvl": 36500, "bury": true,
+		},
+		"lapse": map[string]interface{}{
+			"delays": []int{10}, "mult": 0, "minInt": 1, "leechFails": 8, "leechAction": 0,
+		},
+	},
+}
+
+var ankiColConf = map[string]interface{}{
+	"nextPos": 1, "estTimes": true, "activeDecks": []int{1}, "sortType": "noteFld",
+	"timeLim": 0, "sortBackwards": false, "addToCur": true, "curDeck": 1,
+	"newSpread": 0, "dueCounts": true, "curModel": nil, "collapseTime": 1200,
+}
+
+// ankiChecksum is the first 8 hex digits of the SHA1 of the stripped sort field
+func ankiChecksum(field string) int64 {
+	sum := sha1.Sum([]byte(stripHTML(field)))
+	v, _ := strconv.ParseInt(hex.EncodeToString(sum[:])[:8], 16, 64)
+	return v
+}
+
+// ankiGUID derives a stable note GUID from its id
+func ankiGUID(id int64) string {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(id))
+	sum := sha1.Sum(b)
+	return hex.EncodeToString(sum[:5])
+}
+
+// gradeToAnkiEase maps an SM-2 grade (0-5) to Anki's answer buttons (1-4)
+func gradeToAnkiEase(grade int) int {
+	switch {
+	case grade < 3:
+		return 1
+	case grade == 3:
+		return 2
+	case grade == 4:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// ankiEaseToGrade maps Anki's answer buttons (1-4) back to an SM-2 grade
+func ankiEaseToGrade(ease int) int {
+	switch ease {
+	case 1:
+		return 1
+	case 2:
+		return 3
+	case 3:
+		return 4
+	default:
+		return 5
+	}
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// ExportApkg writes deck as an Anki package (.apkg) to w
+func ExportApkg(deck AnkiDeck, w io.Writer) error {
+	dir, err := os.MkdirTemp("", "readsum-apkg-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "collection.anki2")
+	if err := writeAnkiCollection(path, deck); err != nil {
+		return err
+	}
+
+	collection, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	zw := zip.NewWriter(w)
+	f, err := zw.Create("collection.anki2")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(collection); err != nil {
+		return err
+	}
+
+	// ReadSum cards are text only, so the media map is empty
+	f, err = zw.Create("media")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write([]byte("{}")); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+func writeAnkiCollection(path string, deck AnkiDeck) error {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(ankiSchema); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	nowMs := now.UnixMilli()
+	nowSec := now.Unix()
+	crt := startOfDay(now)
+
+	// Anki ids are millisecond timestamps; keep deck, model, notes and cards apart
+	deckID := nowMs
+	modelID := nowMs + 1
+	clozeModelID := nowMs + 2
+	nextID := nowMs + 3
+
+	models, _ := json.Marshal(map[string]interface{}{
+		strconv.FormatInt(modelID, 10):      ankiBasicModel(modelID, deckID, nowSec),
+		strconv.FormatInt(clozeModelID, 10): ankiClozeModel(clozeModelID, deckID, nowSec),
+	})
+	decks, _ := json.Marshal(map[string]interface{}{
+		"1":                           ankiDeck(1, "Default", nowSec),
+		strconv.FormatInt(deckID, 10): ankiDeck(deckID, deck.Name, nowSec),
+	})
+	dconf, _ := json.Marshal(ankiDeckConf)
+	conf, _ := json.Marshal(ankiColConf)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`INSERT INTO col VALUES (1, ?, ?, ?, 11, 0, 0, 0, ?, ?, ?, ?, '{}')`,
+		crt.Unix(), nowMs, nowMs, string(conf), string(models), string(decks), string(dconf)); err != nil {
+		return err
+	}
+
+	usedRevIDs := make(map[int64]bool)
+	clozeNotes := make(map[string]int64)
+	for i, card := range deck.Cards {
+		// Cloze siblings become cards of a single cloze note
+		noteID, shared := clozeNotes[card.NoteKey]
+		if !shared || card.ClozeText == "" {
+			noteID = nextID
+			nextID++
+
+			mid, flds, sfld := modelID, "", ""
+			if card.ClozeText != "" {
+				text := toAnkiField(card.ClozeText)
+				mid, flds, sfld = clozeModelID, text+"\x1f", text
+				clozeNotes[card.NoteKey] = noteID
+			} else {
+				front, back := toAnkiField(card.Front), toAnkiField(card.Back)
+				flds, sfld = front+"\x1f"+back, front
+			}
+
+			if _, err := tx.Exec(`INSERT INTO notes VALUES (?, ?, ?, ?, -1, '', ?, ?, ?, 0, '')`,
+				noteID, ankiGUID(noteID), mid, nowSec,
+				flds, stripHTML(sfld), ankiChecksum(sfld)); err != nil {
+				return err
+			}
+		}
+
+		cardID := nextID
+		nextID++
+
+		ord := 0
+		if card.ClozeText != "" && card.ClozeIndex > 0 {
+			ord = card.ClozeIndex - 1
+		}
+
+		cardType, queue, due := ankiTypeNew, ankiTypeNew, int64(i+1)
+		factor := int(card.EaseFactor * 1000)
+		if !card.IsNew {
+			cardType, queue = ankiTypeReview, ankiTypeReview
+			due = int64(startOfDay(card.DueAt).Sub(crt).Hours() / 24)
+		} else {
+			factor = 0
+		}
+
+		if _, err := tx.Exec(`INSERT INTO cards VALUES (?, ?, ?, ?, ?, -1, ?, ?, ?, ?, ?, ?, 0, 0, 0, 0, 0, '')`,
+			cardID, noteID, deckID, ord, nowSec, cardType, queue, due,
+			card.Interval, factor, card.Repetitions); err != nil {
+			return err
+		}
+
+		lastIvl := 0
+		for _, r := range card.Reviews {
+			// Revlog ids are review timestamps in milliseconds and must be unique
+			revID := r.ReviewedAt.UnixMilli()
+			for usedRevIDs[revID] {
+				revID++
+			}
+			usedRevIDs[revID] = true
+
+			if _, err := tx.Exec(`INSERT INTO revlog VALUES (?, ?, -1, ?, ?, ?, ?, 0, 1)`,
+				revID, cardID, gradeToAnkiEase(r.Grade), r.Interval, lastIvl, int(r.EaseFactor*1000)); err != nil {
+				return err
+			}
+			lastIvl = r.Interval
+		}
+	}
+
+	return tx.Commit()
+}
+
+// AnkiImportError is a problem with the uploaded package itself. Its message is
+// meant for the user; Err, if any, is the underlying cause.
+type AnkiImportError struct {
+	Message string
+	Err     error
+}
+
+func (e *AnkiImportError) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *AnkiImportError) Unwrap() error {
+	return e.Err
+}
+
+// ImportApkg reads the decks and cards of an Anki package. Problems with the
+// package are returned as *AnkiImportError; any other error is a server failure.
+func ImportApkg(data []byte) ([]AnkiDeck, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, &AnkiImportError{Message: "Not a valid .apkg file", Err: err}
+	}
+
+	files := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	// Prefer the newer schema when the package carries both
+	collection := files["collection.anki21"]
+	if collection == nil {
+		collection = files["collection.anki2"]
+	}
+	if collection == nil {
+		if files["collection.anki21b"] != nil {
+			return nil, &AnkiImportError{Message: "This .apkg uses the latest Anki format; export it with \"Support older Anki versions\" enabled"}
+		}
+		return nil, &AnkiImportError{Message: "The .apkg does not contain an Anki collection"}
+	}
+
+	dir, err := os.MkdirTemp("", "readsum-apkg-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "collection.anki2")
+	if err := extractZipFile(collection, path); err != nil {
+		return nil, err
+	}
+
+	return readAnkiCollection(path)
+}
+
+// maxAnkiCollectionSize bounds the unpacked collection, so a small upload can
+// not expand into an arbitrarily large file
+const maxAnkiCollectionSize = 512 << 20
+
+var ErrAnkiTooLarge = &AnkiImportError{Message: "The Anki collection is too large to import"}
+
+// extractZipFile unpacks f to path, refusing anything over maxAnkiCollectionSize.
+// The declared size is checked first, but the copy is limited as well since the
+// header can lie.
+func extractZipFile(f *zip.File, path string) error {
+	if f.UncompressedSize64 > maxAnkiCollectionSize {
+		return ErrAnkiTooLarge
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	n, err := io.Copy(out, io.LimitReader(rc, maxAnkiCollectionSize+1))
+	if err != nil {
+		return err
+	}
+	if n > maxAnkiCollectionSize {
+		return ErrAnkiTooLarge
+	}
+	return nil
+}
+
+func readAnkiCollection(path string) ([]AnkiDeck, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var crtSec int64
+	var decksJSON, modelsJSON string
+	if err := db.QueryRow(`SELECT crt, decks, models FROM col`).Scan(&crtSec, &decksJSON, &modelsJSON); err != nil {
+		return nil, &AnkiImportError{Message: "The .apkg contains an invalid Anki collection", Err: err}
+	}
+	crt := time.Unix(crtSec, 0)
+
+	var rawModels map[string]struct {
+		Type int `json:"type"`
+	}
+	if err := json.Unmarshal([]byte(modelsJSON), &rawModels); err != nil {
+		return nil, &AnkiImportError{Message: "The .apkg contains invalid Anki note types", Err: err}
+	}
+
+	var rawDecks map[string]struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal([]byte(decksJSON), &rawDecks); err != nil {
+		return nil, &AnkiImportError{Message: "The .apkg contains an invalid Anki deck list", Err: err}
+	}
+
+	reviews, err := readAnkiRevlog(db)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`SELECT c.id, c.did, c.ord, c.type, c.due, c.ivl, c.factor, c.reps, n.flds, n.mid, n.guid
+		FROM cards c JOIN notes n ON n.id = c.nid ORDER BY c.did, c.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var decks []AnkiDeck
+	index := make(map[int64]int)
+	now := time.Now()
+
+	for rows.Next() {
+		var id, did, due, mid int64
+		var ord, cardType, ivl, factor, reps int
+		var flds, guid string
+		if err := rows.Scan(&id, &did, &ord, &cardType, &due, &ivl, &factor, &reps, &flds, &mid, &guid); err != nil {
+			return nil, err
+		}
+
+		fields := strings.Split(flds, "\x1f")
+		var front, back, clozeText string
+		if rawModels[strconv.FormatInt(mid, 10)].Type == ankiModelCloze {
+			clozeText = stripHTML(fields[0])
+			front, back = RenderCloze(clozeText, ord+1)
+			if len(fields) > 1 {
+				if extra := stripHTML(fields[1]); extra != "" {
+					back += "\n" + extra
+				}
+			}
+		} else {
+			front = stripHTML(fields[0])
+			if len(fields) > 1 {
+				back = stripHTML(strings.Join(fields[1:], "\n"))
+			}
+			// The second template of "Basic (and reversed card)" asks the other way round
+			if ord == 1 && len(fields) > 1 {
+				front, back = stripHTML(fields[1]), stripHTML(fields[0])
+			}
+		}
+		if front == "" || back == "" {
+			continue
+		}
+
+		card := AnkiCard{
+			Front:       front,
+			Back:        back,
+			IsNew:       cardType == ankiTypeNew,
+			EaseFactor:  DefaultEaseFactor,
+			Interval:    ivl,
+			Repetitions: reps,
+			DueAt:       now,
+			Reviews:     reviews[id],
+		}
+		if clozeText != "" {
+			card.ClozeText = clozeText
+			card.ClozeIndex = ord + 1
+			card.NoteKey = guid
+		}
+		if factor > 0 {
+			card.EaseFactor = float64(factor) / 1000
+		}
+
+		switch cardType {
+		case ankiTypeReview:
+			// Review cards are due a number of days after the collection was created
+			card.DueAt = crt.AddDate(0, 0, int(due))
+		case ankiTypeLearn, ankiTypeRelrn:
+			// Learning cards are due at a unix timestamp
+			if due > 1_000_000_000 {
+				card.DueAt = time.Unix(due, 0)
+			}
+		}
+		if card.Interval < 0 {
+			// Negative intervals are learning steps in seconds
+			card.Interval = 0
+		}
+
+		i, ok := index[did]
+		if !ok {
+			name := rawDecks[strconv.FormatInt(did, 10)].Name
+			if name == "" {
+				name = "Imported deck"
+			}
+			decks = append(decks, AnkiDeck{Name: name})
+			i = len(decks) - 1
+			index[did] = i
+		}
+		decks[i].Cards = append(decks[i].Cards, card)
+	}
+
+	return decks, rows.Err()
+}
+
+func readAnkiRevlog(db *sql.DB) (map[int64][]AnkiReview, error) {
+	rows, err := db.Query(`SELECT id, cid, ease, ivl, factor FROM revlog ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reviews := make(map[int64][]AnkiReview)
+	for rows.Next() {
+		var id, cid int64
+		var ease, ivl, factor int
+		if err := rows.Scan(&id, &cid, &ease, &ivl, &factor); err != nil {
+			return nil, err
+		}
+		if ease < 1 {
+			// Manual rescheduling entries carry no answer
+			continue
+		}
+		if ivl < 0 {
+			ivl = 0
+		}
+
+		review := AnkiReview{
+			Grade:      ankiEaseToGrade(ease),
+			Interval:   ivl,
+			EaseFactor: DefaultEaseFactor,
+			ReviewedAt: time.UnixMilli(id),
+		}
+		if factor > 0 {
+			review.EaseFactor = float64(factor) / 1000
+		}
+		reviews[cid] = append(reviews[cid], review)
+	}
+
+	return reviews, rows.Err()
+}
+
+var (
+	htmlBreak = regexp.MustCompile(`(?i)<br\s*/?>|</div>|</p>`)
+	htmlTag   = regexp.MustCompile(`<[^>]*>`)
+)
+
+// toAnkiField turns plain text into an Anki (HTML) field
+func toAnkiField(s string) string {
+	return strings.ReplaceAll(html.EscapeString(s), "\n", "<br>")
+}
+
+// stripHTML turns an Anki field into plain text
+func stripHTML(s string) string {
+	s = htmlBreak.ReplaceAllString(s, "\n")
+	s = htmlTag.ReplaceAllString(s, "")
+	return strings.TrimSpace(html.UnescapeString(s))
+}
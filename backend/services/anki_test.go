@@ -0,0 +1,174 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func exportAndImport(t *testing.T, deck AnkiDeck) AnkiDeck {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := ExportApkg(deck, &buf); err != nil {
+		t.Fatal(err)
+	}
+	decks, err := ImportApkg(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decks) != 1 {
+		t.Fatalf("imported %d decks, want 1", len(decks))
+	}
+	return decks[0]
+}
+
+func TestAnkiRoundTrip(t *testing.T) {
+	due := time.Now().AddDate(0, 0, 10)
+	reviewed := time.UnixMilli(time.Now().AddDate(0, 0, -3).UnixMilli())
+	deck := AnkiDeck{Name: "Biology", Cards: []AnkiCard{
+		{Front: "Where do plants make food?", Back: "In the leaves", IsNew: true},
+		{Front: "Is 1 < 2 & 3 > 2?", Back: "Yes\nboth hold", EaseFactor: 2.3, Interval: 10, Repetitions: 3, DueAt: due,
+			Reviews: []AnkiReview{
+				{Grade: 4, Interval: 6, EaseFactor: 2.5, ReviewedAt: reviewed},
+				{Grade: 2, Interval: 1, EaseFactor: 2.3, ReviewedAt: reviewed},
+			}},
+	}}
+
+	imported := exportAndImport(t, deck)
+	if imported.Name != "Biology" || len(imported.Cards) != 2 {
+		t.Fatalf("imported deck %q with %d cards, want Biology with 2", imported.Name, len(imported.Cards))
+	}
+
+	card := imported.Cards[0]
+	if card.Front != "Where do plants make food?" || card.Back != "In the leaves" || !card.IsNew {
+		t.Errorf("new card came back as %+v", card)
+	}
+
+	card = imported.Cards[1]
+	if card.Front != "Is 1 < 2 & 3 > 2?" || card.Back != "Yes\nboth hold" {
+		t.Errorf("fields came back as %q / %q, want the special characters and line break kept", card.Front, card.Back)
+	}
+	if card.IsNew || card.EaseFactor != 2.3 || card.Interval != 10 || card.Repetitions != 3 {
+		t.Errorf("schedule came back as ease %v, interval %d, repetitions %d", card.EaseFactor, card.Interval, card.Repetitions)
+	}
+	if !card.DueAt.Equal(startOfDay(due)) {
+		t.Errorf("due %v, want %v", card.DueAt, startOfDay(due))
+	}
+	if len(card.Reviews) != 2 {
+		t.Fatalf("imported %d reviews, want 2", len(card.Reviews))
+	}
+	// Anki has four answer buttons, so failed grades all come back as 1
+	if r := card.Reviews[0]; r.Grade != 4 || r.Interval != 6 || r.EaseFactor != 2.5 || !r.ReviewedAt.Equal(reviewed) {
+		t.Errorf("first review came back as %+v", r)
+	}
+	if r := card.Reviews[1]; r.Grade != 1 || r.Interval != 1 {
+		t.Errorf("second review came back as %+v", r)
+	}
+}
+
+func TestAnkiGradeMapping(t *testing.T) {
+	tests := []struct {
+		grade, ease, back int
+	}{
+		{0, 1, 1},
+		{1, 1, 1},
+		{2, 1, 1},
+		{3, 2, 3},
+		{4, 3, 4},
+		{5, 4, 5},
+	}
+	for _, tt := range tests {
+		ease := gradeToAnkiEase(tt.grade)
+		if ease != tt.ease {
+			t.Errorf("gradeToAnkiEase(%d) = %d, want %d", tt.grade, ease, tt.ease)
+		}
+		if back := ankiEaseToGrade(ease); back != tt.back {
+			t.Errorf("ankiEaseToGrade(%d) = %d, want %d", ease, back, tt.back)
+		}
+	}
+}
+
+// zipOf builds a zip archive of placeholder files. "huge" adds a collection
+// whose header declares more than maxAnkiCollectionSize, without storing it.
+func zipOf(t *testing.T, names ...string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range names {
+		if name == "huge" {
+			w, err := zw.CreateRaw(&zip.FileHeader{
+				Name:               "collection.anki2",
+				Method:             zip.Store,
+				CompressedSize64:   1,
+				UncompressedSize64: maxAnkiCollectionSize + 1,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.Write([]byte{0})
+			continue
+		}
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte("not a database"))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestImportApkgRejectsBadPackages(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"not a zip", []byte("hello")},
+		{"no collection", zipOf(t, "media")},
+		{"latest format only", zipOf(t, "collection.anki21b", "media")},
+		{"not a collection", zipOf(t, "collection.anki2")},
+		{"too large", zipOf(t, "huge")},
+	}
+	for _, tt := range tests {
+		_, err := ImportApkg(tt.data)
+		var importErr *AnkiImportError
+		if !errors.As(err, &importErr) {
+			t.Errorf("%s: ImportApkg() error = %v, want an AnkiImportError", tt.name, err)
+		}
+	}
+
+	if _, err := ImportApkg(zipOf(t, "huge")); !errors.Is(err, ErrAnkiTooLarge) {
+		t.Errorf("oversized collection: error = %v, want ErrAnkiTooLarge", err)
+	}
+}
+
+func TestAnkiClozeRoundTrip(t *testing.T) {
+	text := "It turns {{c1::light}} into {{c2::chemical energy}}."
+	deck := AnkiDeck{Name: "Biology", Cards: []AnkiCard{
+		{IsNew: true, ClozeText: text, ClozeIndex: 1, NoteKey: "note"},
+		{IsNew: true, ClozeText: text, ClozeIndex: 2, NoteKey: "note"},
+	}}
+	for i := range deck.Cards {
+		deck.Cards[i].Front, deck.Cards[i].Back = RenderCloze(text, deck.Cards[i].ClozeIndex)
+	}
+
+	imported := exportAndImport(t, deck)
+	if len(imported.Cards) != 2 {
+		t.Fatalf("imported %d cards, want 2", len(imported.Cards))
+	}
+	for i, card := range imported.Cards {
+		want := deck.Cards[i]
+		if card.ClozeText != text || card.ClozeIndex != want.ClozeIndex || card.Front != want.Front || card.Back != want.Back {
+			t.Errorf("card %d came back as %+v", i, card)
+		}
+	}
+	if imported.Cards[0].NoteKey == "" || imported.Cards[0].NoteKey != imported.Cards[1].NoteKey {
+		t.Errorf("note keys %q and %q, want the siblings to share one note", imported.Cards[0].NoteKey, imported.Cards[1].NoteKey)
+	}
+}
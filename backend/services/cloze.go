@@ -0,0 +1,205 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/MadMax168/Readsum/llm"
+)
+
+type GeneratedDeletion struct {
+	Term  string `json:"term"`
+	Hint  string `json:"hint"`
+	Group int    `json:"group"`
+}
+
+type GeneratedCloze struct {
+	Sentence  string              `json:"sentence"`
+	Deletions []GeneratedDeletion `json:"deletions"`
+}
+
+var clozeSchema = &llm.Schema{
+	Type: llm.TypeObject,
+	Properties: map[string]*llm.Schema{
+		"sentences": {
+			Type: llm.TypeArray,
+			Items: &llm.Schema{
+				Type: llm.TypeObject,
+				Properties: map[string]*llm.Schema{
+					"sentence": {Type: llm.TypeString},
+					"deletions": {
+						Type: llm.TypeArray,
+						Items: &llm.Schema{
+							Type: llm.TypeObject,
+							Properties: map[string]*llm.Schema{
+								"term":  {Type: llm.TypeString},
+								"hint":  {Type: llm.TypeString},
+								"group": {Type: llm.TypeInteger},
+							},
+							Required: []string{"term", "group"},
+						},
+					},
+				},
+				Required: []string{"sentence", "deletions"},
+			},
+		},
+	},
+	Required: []string{"sentences"},
+}
+
+// GenerateClozes asks the model for up to count key sentences of source with the
+// terms worth hiding. Terms sharing a group are hidden together on the same card.
+func (ai *AI) GenerateClozes(system, source string, count int) ([]GeneratedCloze, error) {
+	prompt := fmt.Sprintf(`You are a teacher making cloze-deletion flashcards.
+Pick up to %d key sentences from the material below: definitions, formulas, dates,
+names and facts a student should memorise. Copy each sentence exactly as written.
+For each sentence list 1 to 3 terms to hide. Every term must be copied exactly from the sentence.
+Give terms that must be recalled together the same group number (1, 2, 3...);
+each group becomes its own card. Add a short hint only when the term would be ambiguous.
+
+Material:
+%s`, count, source)
+
+	var out struct {
+		Sentences []GeneratedCloze `json:"sentences"`
+	}
+	if err := ai.GenerateJSON(system, prompt, clozeSchema, &out); err != nil {
+		return nil, err
+	}
+
+	return out.Sentences, nil
+}
+
+var spaces = regexp.MustCompile(`\s+`)
+
+func normalizeSpace(s string) string {
+	return strings.TrimSpace(spaces.ReplaceAllString(s, " "))
+}
+
+// BuildClozeText checks a generated cloze against the source and turns it into
+// Anki cloze markup ("{{c1::term}}"). It fails when the sentence is not in the
+// source, a term is not in the sentence, or two terms overlap.
+func BuildClozeText(source string, cloze GeneratedCloze) (string, error) {
+	sentence := normalizeSpace(cloze.Sentence)
+	if sentence == "" {
+		return "", fmt.Errorf("sentence is empty")
+	}
+	if !strings.Contains(normalizeSpace(source), sentence) {
+		return "", fmt.Errorf("sentence %q does not appear in the source", sentence)
+	}
+	if len(cloze.Deletions) == 0 {
+		return "", fmt.Errorf("sentence %q has no deletions", sentence)
+	}
+
+	type span struct {
+		start, end int
+		deletion   GeneratedDeletion
+	}
+
+	var spans []span
+	for _, d := range cloze.Deletions {
+		term := normalizeSpace(d.Term)
+		if term == "" {
+			return "", fmt.Errorf("sentence %q has an empty term", sentence)
+		}
+
+		// Hide the first occurrence that is not already taken by another term
+		from := 0
+		found := false
+		for !found {
+			i := strings.Index(sentence[from:], term)
+			if i < 0 {
+				break
+			}
+			start := from + i
+			end := start + len(term)
+
+			overlaps := false
+			for _, s := range spans {
+				if start < s.end && s.start < end {
+					overlaps = true
+				}
+			}
+			if !overlaps {
+				d.Term = term
+				spans = append(spans, span{start, end, d})
+				found = true
+			}
+			from = start + 1
+		}
+		if !found {
+			return "", fmt.Errorf("term %q does not appear in sentence %q", term, sentence)
+		}
+	}
+
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+
+	// Renumber the groups 1..n in order of first appearance
+	groups := make(map[int]int)
+	var b strings.Builder
+	last := 0
+	for _, s := range spans {
+		n, ok := groups[s.deletion.Group]
+		if !ok {
+			n = len(groups) + 1
+			groups[s.deletion.Group] = n
+		}
+
+		b.WriteString(sentence[last:s.start])
+		fmt.Fprintf(&b, "{{c%d::%s", n, s.deletion.Term)
+		if hint := normalizeSpace(s.deletion.Hint); hint != "" {
+			b.WriteString("::" + hint)
+		}
+		b.WriteString("}}")
+		last = s.end
+	}
+	b.WriteString(sentence[last:])
+
+	return b.String(), nil
+}
+
+var clozeMarkup = regexp.MustCompile(`\{\{c(\d+)::(.*?)(?:::(.*?))?\}\}`)
+
+// ClozeIndexes lists the card numbers present in cloze markup, in ascending order
+func ClozeIndexes(text string) []int {
+	seen := make(map[int]bool)
+	var indexes []int
+	for _, m := range clozeMarkup.FindAllStringSubmatch(text, -1) {
+		n, err := strconv.Atoi(m[1])
+		if err != nil || seen[n] {
+			continue
+		}
+		seen[n] = true
+		indexes = append(indexes, n)
+	}
+	sort.Ints(indexes)
+	return indexes
+}
+
+// RenderCloze builds the question and answer sides of card index of a cloze text.
+// The deletions of that card are hidden (showing their hint if any); all others are shown.
+func RenderCloze(text string, index int) (string, string) {
+	front := clozeMarkup.ReplaceAllStringFunc(text, func(m string) string {
+		parts := clozeMarkup.FindStringSubmatch(m)
+		if parts[1] != strconv.Itoa(index) {
+			return parts[2]
+		}
+		if parts[3] != "" {
+			return "[" + parts[3] + "]"
+		}
+		return "[...]"
+	})
+
+	back := clozeMarkup.ReplaceAllStringFunc(text, func(m string) string {
+		parts := clozeMarkup.FindStringSubmatch(m)
+		if parts[1] != strconv.Itoa(index) {
+			return parts[2]
+		}
+		return "[" + parts[2] + "]"
+	})
+
+	return front, back
+}
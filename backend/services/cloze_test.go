@@ -0,0 +1,104 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+const clozeSource = "Photosynthesis happens in the   chloroplasts.\nIt turns light into chemical energy, and light drives it."
+
+func TestBuildClozeText(t *testing.T) {
+	tests := []struct {
+		name    string
+		cloze   GeneratedCloze
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "one deletion with spacing normalised",
+			cloze: GeneratedCloze{Sentence: "Photosynthesis happens in the chloroplasts.",
+				Deletions: []GeneratedDeletion{{Term: "chloroplasts", Group: 1}}},
+			want: "Photosynthesis happens in the {{c1::chloroplasts}}.",
+		},
+		{
+			name: "groups renumbered in order of appearance, with hints",
+			cloze: GeneratedCloze{Sentence: "It turns light into chemical energy, and light drives it.",
+				Deletions: []GeneratedDeletion{{Term: "chemical energy", Group: 5}, {Term: "light", Group: 2, Hint: "what"}}},
+			want: "It turns {{c1::light::what}} into {{c2::chemical energy}}, and light drives it.",
+		},
+		{
+			name: "a repeated term takes the next free occurrence",
+			cloze: GeneratedCloze{Sentence: "It turns light into chemical energy, and light drives it.",
+				Deletions: []GeneratedDeletion{{Term: "light", Group: 1}, {Term: "light", Group: 1}}},
+			want: "It turns {{c1::light}} into chemical energy, and {{c1::light}} drives it.",
+		},
+		{
+			name: "sentence not in the source",
+			cloze: GeneratedCloze{Sentence: "Plants are green.",
+				Deletions: []GeneratedDeletion{{Term: "green", Group: 1}}},
+			wantErr: true,
+		},
+		{
+			name:    "no deletions",
+			cloze:   GeneratedCloze{Sentence: "Photosynthesis happens in the chloroplasts."},
+			wantErr: true,
+		},
+		{
+			name: "term not in the sentence",
+			cloze: GeneratedCloze{Sentence: "Photosynthesis happens in the chloroplasts.",
+				Deletions: []GeneratedDeletion{{Term: "mitochondria", Group: 1}}},
+			wantErr: true,
+		},
+		{
+			name: "overlapping terms",
+			cloze: GeneratedCloze{Sentence: "Photosynthesis happens in the chloroplasts.",
+				Deletions: []GeneratedDeletion{{Term: "the chloroplasts", Group: 1}, {Term: "chloroplasts", Group: 2}}},
+			wantErr: true,
+		},
+		{
+			name:    "empty sentence",
+			cloze:   GeneratedCloze{Sentence: "  ", Deletions: []GeneratedDeletion{{Term: "x", Group: 1}}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		got, err := BuildClozeText(clozeSource, tt.cloze)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("%s: BuildClozeText() = %q, %v; want %q, error %v", tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestClozeIndexes(t *testing.T) {
+	tests := []struct {
+		text string
+		want []int
+	}{
+		{"{{c2::a}} {{c1::b::hint}} {{c2::c}}", []int{1, 2}},
+		{"no deletions", nil},
+		{"{{c3::a}}", []int{3}},
+	}
+	for _, tt := range tests {
+		if got := ClozeIndexes(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ClozeIndexes(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestRenderCloze(t *testing.T) {
+	text := "It turns {{c1::light::what}} into {{c2::chemical energy}}, and {{c1::light}} drives it."
+	tests := []struct {
+		index       int
+		front, back string
+	}{
+		{1, "It turns [what] into chemical energy, and [...] drives it.", "It turns [light] into chemical energy, and [light] drives it."},
+		{2, "It turns light into [...], and light drives it.", "It turns light into [chemical energy], and light drives it."},
+		{3, "It turns light into chemical energy, and light drives it.", "It turns light into chemical energy, and light drives it."},
+	}
+	for _, tt := range tests {
+		front, back := RenderCloze(text, tt.index)
+		if front != tt.front || back != tt.back {
+			t.Errorf("RenderCloze(%d) = %q / %q, want %q / %q", tt.index, front, back, tt.front, tt.back)
+		}
+	}
+}
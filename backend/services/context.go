@@ -0,0 +1,70 @@
+package services
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/MadMax168/Readsum/llm"
+)
+
+// defaultContextTokens is the chat history budget when CHAT_CONTEXT_TOKENS is unset
+const defaultContextTokens = 8000
+
+// ContextBudget is how many tokens of chat history are sent with each message,
+// from CHAT_CONTEXT_TOKENS
+func ContextBudget() int {
+	if n, err := strconv.Atoi(os.Getenv("CHAT_CONTEXT_TOKENS")); err == nil && n > 0 {
+		return n
+	}
+	return defaultContextTokens
+}
+
+// defaultSummaryInterval is the summary interval when CHAT_SUMMARY_EVERY is unset
+const defaultSummaryInterval = 20
+
+// SummaryInterval is how many messages are folded into a chat's running
+// summary at a time, from CHAT_SUMMARY_EVERY. At least that many recent
+// messages are always sent as they are.
+func SummaryInterval() int {
+	if n, err := strconv.Atoi(os.Getenv("CHAT_SUMMARY_EVERY")); err == nil && n > 0 {
+		return n
+	}
+	return defaultSummaryInterval
+}
+
+// TrimContext keeps the most recent messages of history that fit in budget
+// tokens, evicting the oldest first. The latest message is always kept, even
+// when it alone is over budget. Consecutive messages of the same role are
+// merged and leading assistant messages dropped, since chat APIs expect the
+// turns to alternate starting with the user.
+func TrimContext(history []llm.Message, budget int) []llm.Message {
+	var merged []llm.Message
+	for _, m := range history {
+		text := strings.TrimSpace(m.Text)
+		if text == "" {
+			continue
+		}
+		if n := len(merged); n > 0 && merged[n-1].Role == m.Role {
+			merged[n-1].Text += "\n\n" + text
+			continue
+		}
+		merged = append(merged, llm.Message{Role: m.Role, Text: text})
+	}
+
+	start, used := len(merged), 0
+	for start > 0 {
+		cost := llm.EstimateTokens(merged[start-1].Text)
+		if start < len(merged) && used+cost > budget {
+			break
+		}
+		used += cost
+		start--
+	}
+
+	kept := merged[start:]
+	for len(kept) > 0 && kept[0].Role != llm.RoleUser {
+		kept = kept[1:]
+	}
+	return kept
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/MadMax168/Readsum/llm"
+)
+
+func user(text string) llm.Message      { return llm.Message{Role: llm.RoleUser, Text: text} }
+func assistant(text string) llm.Message { return llm.Message{Role: llm.RoleAssistant, Text: text} }
+
+func TestTrimContext(t *testing.T) {
+	// Each eight-letter message is estimated at two tokens
+	tests := []struct {
+		name    string
+		history []llm.Message
+		budget  int
+		want    []llm.Message
+	}{
+		{
+			name:    "everything fits",
+			history: []llm.Message{user("question"), assistant("answered"), user("followup")},
+			budget:  6,
+			want:    []llm.Message{user("question"), assistant("answered"), user("followup")},
+		},
+		{
+			name:    "oldest evicted first",
+			history: []llm.Message{user("question"), assistant("answered"), user("followup"), assistant("answered"), user("thirdone")},
+			budget:  6,
+			want:    []llm.Message{user("followup"), assistant("answered"), user("thirdone")},
+		},
+		{
+			name:    "leading reply dropped after trimming",
+			history: []llm.Message{user("question"), assistant("answered"), user("followup")},
+			budget:  4,
+			want:    []llm.Message{user("followup")},
+		},
+		{
+			name:    "latest message kept over budget",
+			history: []llm.Message{user("question"), assistant("answered"), user(strings.Repeat("x", 100))},
+			budget:  4,
+			want:    []llm.Message{user(strings.Repeat("x", 100))},
+		},
+		{
+			name:    "same roles merged and blanks skipped",
+			history: []llm.Message{assistant("greeting"), user(" question "), user("  "), user("followup"), assistant("answered")},
+			budget:  100,
+			want:    []llm.Message{user("question\n\nfollowup"), assistant("answered")},
+		},
+		{
+			name:    "turns merged across a blank reply",
+			history: []llm.Message{user("question"), assistant(""), user("followup")},
+			budget:  100,
+			want:    []llm.Message{user("question\n\nfollowup")},
+		},
+		{
+			name:    "empty history",
+			history: nil,
+			budget:  100,
+			want:    nil,
+		},
+	}
+	for _, tt := range tests {
+		got := TrimContext(tt.history, tt.budget)
+		if len(got) == 0 && len(tt.want) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: TrimContext() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestContextBudget(t *testing.T) {
+	tests := []struct {
+		env  string
+		want int
+	}{
+		{"", defaultContextTokens},
+		{"2000", 2000},
+		{"-5", defaultContextTokens},
+		{"lots", defaultContextTokens},
+	}
+	for _, tt := range tests {
+		t.Setenv("CHAT_CONTEXT_TOKENS", tt.env)
+		if got := ContextBudget(); got != tt.want {
+			t.Errorf("ContextBudget() with %q = %d, want %d", tt.env, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/MadMax168/Readsum/llm"
+)
+
+type GeneratedCard struct {
+	Front string `json:"front"`
+	Back  string `json:"back"`
+}
+
+type GeneratedDeck struct {
+	Title string          `json:"title"`
+	Cards []GeneratedCard `json:"cards"`
+}
+
+var deckSchema = &llm.Schema{
+	Type: llm.TypeObject,
+	Properties: map[string]*llm.Schema{
+		"title": {Type: llm.TypeString},
+		"cards": {
+			Type: llm.TypeArray,
+			Items: &llm.Schema{
+				Type: llm.TypeObject,
+				Properties: map[string]*llm.Schema{
+					"front": {Type: llm.TypeString},
+					"back":  {Type: llm.TypeString},
+				},
+				Required: []string{"front", "back"},
+			},
+		},
+	},
+	Required: []string{"title", "cards"},
+}
+
+// GenerateFlashcards builds count front/back flashcards from source
+func (ai *AI) GenerateFlashcards(system, source string, count int) (*GeneratedDeck, error) {
+	prompt := fmt.Sprintf(`You are a teacher writing flashcards for spaced repetition.
+Write exactly %d flashcards based only on the material below.
+The front asks one specific question or names one term; the back answers it briefly.
+Write the cards in the same language as the material.
+
+Material:
+%s`, count, source)
+
+	var deck GeneratedDeck
+	if err := ai.GenerateJSON(system, prompt, deckSchema, &deck); err != nil {
+		return nil, err
+	}
+
+	return &deck, nil
+}
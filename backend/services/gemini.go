@@ -1,52 +0,0 @@
-package services
-
-import (
-	"context"
-	"fmt"
-	"os"
-
-	"github.com/google/generative-ai-go/genai"
-	"google.golang.org/api/option"
-)
-
-// GenerateContent send message to Gemini and feedback the answer
-func GenerateContent(prompt string) (string, error) {
-	ctx := context.Background()
-	apiKey := os.Getenv("GEMINI_API_KEY")
-	modelName := os.Getenv("GEMINI_MODEL")
-
-	if apiKey == "" {
-		return "", fmt.Errorf("GEMINI_API_KEY is not set")
-	}
-	if modelName == "" {
-		modelName = "gemini-2.0-flash-exp" // Default model
-	}
-
-	client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
-	if err != nil {
-		return "", err
-	}
-	defer client.Close()
-
-	model := client.GenerativeModel(modelName)
-	model.SetTemperature(0.7) // Set for creativity (0.0 - 1.0)
-
-	resp, err := model.GenerateContent(ctx, genai.Text(prompt))
-	if err != nil {
-		return "", err
-	}
-
-	if len(resp.Candidates) == 0 {
-		return "", fmt.Errorf("no response from model")
-	}
-
-	// extract message from first part
-	var result string
-	for _, part := range resp.Candidates[0].Content.Parts {
-		if txt, ok := part.(genai.Text); ok {
-			result += string(txt)
-		}
-	}
-
-	return result, nil
-}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/MadMax168/Readsum/llm"
+)
+
+// AI makes every model call of the app through the provider it is given, such
+// as the one configured by llm.FromEnv, or llm.NewFake in tests
+type AI struct {
+	provider llm.Provider
+}
+
+func NewAI(provider llm.Provider) *AI {
+	return &AI{provider: provider}
+}
+
+// GenerateContent sends prompt to the configured model and returns the answer.
+// system carries the chat's instructions, such as its persona; it may be empty.
+func (ai *AI) GenerateContent(system, prompt string) (string, error) {
+	return ai.GenerateChatContent(ModelSettings{}, system, prompt)
+}
+
+// GenerateChatContent is GenerateContent with a chat's settings applied
+func (ai *AI) GenerateChatContent(settings ModelSettings, system, prompt string) (string, error) {
+	req := llm.Request{
+		System:      system,
+		Messages:    []llm.Message{{Role: llm.RoleUser, Text: prompt}},
+		Temperature: 0.7, // Set for creativity (0.0 - 1.0)
+	}
+	settings.apply(&req)
+	return ai.provider.Generate(context.Background(), req)
+}
+
+// GenerateReply continues a conversation with the chat's settings: history ends
+// with the user's new message and is trimmed to what the context budget leaves
+// after system
+func (ai *AI) GenerateReply(settings ModelSettings, system string, history []llm.Message) (string, error) {
+	return ai.provider.Generate(context.Background(), replyRequest(settings, system, history))
+}
+
+// StreamReply is GenerateReply delivered piece by piece to onChunk. It returns
+// the text produced so far along with any error, including one from onChunk.
+func (ai *AI) StreamReply(ctx context.Context, settings ModelSettings, system string, history []llm.Message, onChunk func(string) error) (string, error) {
+	return ai.provider.Stream(ctx, replyRequest(settings, system, history), onChunk)
+}
+
+// replyBudget is the context budget left for the conversation once the system
+// instructions are sent, keeping at least a quarter of it for the history
+func replyBudget(system string) int {
+	budget := ContextBudget()
+	return max(budget-llm.EstimateTokens(system), budget/4)
+}
+
+// GenerateJSON asks the model for a response matching schema and decodes it into
+// out. system is passed on as in GenerateContent.
+func (ai *AI) GenerateJSON(system, prompt string, schema *llm.Schema, out interface{}) error {
+	return ai.GenerateChatJSON(ModelSettings{}, system, prompt, schema, out)
+}
+
+// GenerateChatJSON is GenerateJSON with a chat's settings applied
+func (ai *AI) GenerateChatJSON(settings ModelSettings, system, prompt string, schema *llm.Schema, out interface{}) error {
+	req := llm.Request{
+		System:      system,
+		Messages:    []llm.Message{{Role: llm.RoleUser, Text: prompt}},
+		Temperature: 0.4, // Keep structured output close to the source
+		Schema:      schema,
+	}
+	settings.apply(&req)
+
+	raw, err := ai.provider.Generate(context.Background(), req)
+	if err != nil {
+		return err
+	}
+
+	// Some OpenAI-compatible servers wrap JSON in a Markdown code fence
+	raw = strings.TrimSpace(raw)
+	if strings.HasPrefix(raw, "```") {
+		raw = strings.TrimPrefix(raw, "```json")
+		raw = strings.TrimPrefix(raw, "```")
+		raw = strings.TrimSuffix(raw, "```")
+	}
+
+	if err := json.Unmarshal([]byte(raw), out); err != nil {
+		return fmt.Errorf("invalid JSON from model: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,41 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SummarizeConversation folds transcript, the messages that follow the part of
+// the conversation summary already covers, into an updated summary. The summary
+// is the chat's long-term memory, so it keeps what later answers must stay
+// consistent with rather than a retelling of the conversation.
+func (ai *AI) SummarizeConversation(summary, transcript string) (string, error) {
+	if summary == "" {
+		summary = "(nothing yet)"
+	}
+
+	prompt := fmt.Sprintf(`You maintain the long-term memory of a conversation between a student and a study assistant.
+Update the summary below with the new messages. Keep, as short bullet points:
+- facts, definitions and explanations the assistant gave that the student relied on
+- decisions, conventions and notation agreed on (e.g. units, naming, the method to use)
+- the student's goals, preferences, strengths and recurring mistakes
+- questions that are still open
+Drop small talk and anything superseded by a later message. Stay under 400 words.
+Write in the same language as the conversation. Reply with the updated summary only.
+
+Current summary:
+%s
+
+New messages:
+%s`, summary, transcript)
+
+	updated, err := ai.GenerateContent("", prompt)
+	if err != nil {
+		return "", err
+	}
+	updated = strings.TrimSpace(updated)
+	if updated == "" {
+		return "", fmt.Errorf("model returned an empty summary")
+	}
+	return updated, nil
+}
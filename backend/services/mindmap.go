@@ -0,0 +1,153 @@
+package services
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/MadMax168/Readsum/llm"
+)
+
+// MindMapTree is a mind map node with its children, as generated and as rendered
+type MindMapTree struct {
+	ID       uint          `json:"id,omitempty"`
+	Label    string        `json:"label"`
+	Note     string        `json:"note,omitempty"`
+	Children []MindMapTree `json:"children,omitempty"`
+}
+
+// mindMapDepth is how many levels below the root the model may produce
+const mindMapDepth = 3
+
+// mindMapNodeSchema builds a node schema nesting depth levels of children;
+// response schemas cannot be recursive
+func mindMapNodeSchema(depth int) *llm.Schema {
+	schema := &llm.Schema{
+		Type: llm.TypeObject,
+		Properties: map[string]*llm.Schema{
+			"label": {Type: llm.TypeString},
+			"note":  {Type: llm.TypeString},
+		},
+		Required: []string{"label"},
+	}
+	if depth > 0 {
+		schema.Properties["children"] = &llm.Schema{Type: llm.TypeArray, Items: mindMapNodeSchema(depth - 1)}
+	}
+	return schema
+}
+
+var mindMapSchema = mindMapNodeSchema(mindMapDepth)
+
+// GenerateMindMap builds a concept hierarchy of source rooted at its main topic
+func (ai *AI) GenerateMindMap(system, source string) (*MindMapTree, error) {
+	prompt := fmt.Sprintf(`You are a teacher drawing a mind map for a student.
+Build a concept hierarchy of the material below, at most %d levels below the root.
+The root is the main topic. Its children are the main themes (3 to 7),
+each broken down into sub-concepts and then key facts.
+Labels are short noun phrases of a few words; put any explanation in the optional note.
+Use only the material below and write in the same language as the material.
+
+Material:
+%s`, mindMapDepth, source)
+
+	var tree MindMapTree
+	if err := ai.GenerateJSON(system, prompt, mindMapSchema, &tree); err != nil {
+		return nil, err
+	}
+
+	tree = pruneMindMap(tree)
+	if tree.Label == "" {
+		return nil, fmt.Errorf("mind map has no root topic")
+	}
+
+	return &tree, nil
+}
+
+// pruneMindMap trims labels and drops nodes without one
+func pruneMindMap(node MindMapTree) MindMapTree {
+	node.Label = strings.TrimSpace(node.Label)
+	node.Note = strings.TrimSpace(node.Note)
+
+	var children []MindMapTree
+	for _, child := range node.Children {
+		child = pruneMindMap(child)
+		if child.Label != "" {
+			children = append(children, child)
+		}
+	}
+	node.Children = children
+
+	return node
+}
+
+type opmlOutline struct {
+	Text     string        `xml:"text,attr"`
+	Note     string        `xml:"_note,attr,omitempty"`
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+type opmlDocument struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    struct {
+		Title       string `xml:"title"`
+		DateCreated string `xml:"dateCreated"`
+	} `xml:"head"`
+	Body struct {
+		Outlines []opmlOutline `xml:"outline"`
+	} `xml:"body"`
+}
+
+func toOPMLOutline(node MindMapTree) opmlOutline {
+	outline := opmlOutline{Text: node.Label, Note: node.Note}
+	for _, child := range node.Children {
+		outline.Outlines = append(outline.Outlines, toOPMLOutline(child))
+	}
+	return outline
+}
+
+// RenderOPML writes the mind map as an OPML 2.0 outline; notes use the
+// _note attribute understood by outliners such as OmniOutliner and Workflowy
+func RenderOPML(title string, root MindMapTree, w io.Writer) error {
+	doc := opmlDocument{Version: "2.0"}
+	doc.Head.Title = title
+	doc.Head.DateCreated = time.Now().UTC().Format(time.RFC1123Z)
+	doc.Body.Outlines = []opmlOutline{toOPMLOutline(root)}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return enc.Encode(doc)
+}
+
+// mermaidText makes a label safe inside a quoted Mermaid node
+var mermaidText = strings.NewReplacer(`"`, "'", "\n", " ", "\r", " ", "`", "'")
+
+// RenderMermaid writes the mind map in Mermaid mindmap syntax
+func RenderMermaid(root MindMapTree) string {
+	var b strings.Builder
+	b.WriteString("mindmap\n")
+
+	id := 0
+	var walk func(node MindMapTree, depth int)
+	walk = func(node MindMapTree, depth int) {
+		indent := strings.Repeat("  ", depth+1)
+		label := mermaidText.Replace(node.Label)
+		if depth == 0 {
+			fmt.Fprintf(&b, "%sroot((\"%s\"))\n", indent, label)
+		} else {
+			id++
+			fmt.Fprintf(&b, "%sn%d[\"%s\"]\n", indent, id, label)
+		}
+		for _, child := range node.Children {
+			walk(child, depth+1)
+		}
+	}
+	walk(root, 0)
+
+	return b.String()
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"bytes"
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var photosynthesisMap = MindMapTree{Label: "Photosynthesis", Children: []MindMapTree{
+	{Label: "Inputs", Children: []MindMapTree{
+		{Label: "Light", Note: "Absorbed by \"chlorophyll\""},
+		{Label: "Water & CO2"},
+	}},
+	{Label: "Outputs", Note: "What the\nplant makes"},
+}}
+
+func TestRenderOPML(t *testing.T) {
+	var buf bytes.Buffer
+	if err := RenderOPML("Plants <basics>", photosynthesisMap, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), xml.Header) {
+		t.Errorf("output does not start with the XML header")
+	}
+
+	var doc opmlDocument
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("output is not valid XML: %v", err)
+	}
+	if doc.Version != "2.0" || doc.Head.Title != "Plants <basics>" || doc.Head.DateCreated == "" {
+		t.Errorf("head = %+v, version %q", doc.Head, doc.Version)
+	}
+	want := []opmlOutline{toOPMLOutline(photosynthesisMap)}
+	if !reflect.DeepEqual(doc.Body.Outlines, want) {
+		t.Errorf("outlines = %+v, want %+v", doc.Body.Outlines, want)
+	}
+	if light := doc.Body.Outlines[0].Outlines[0].Outlines[0]; light.Note != `Absorbed by "chlorophyll"` {
+		t.Errorf("note came back as %q", light.Note)
+	}
+}
+
+func TestRenderMermaid(t *testing.T) {
+	tests := []struct {
+		name string
+		root MindMapTree
+		want string
+	}{
+		{
+			name: "root only",
+			root: MindMapTree{Label: "Plants"},
+			want: "mindmap\n  root((\"Plants\"))\n",
+		},
+		{
+			name: "nested nodes numbered depth first",
+			root: photosynthesisMap,
+			want: "mindmap\n" +
+				"  root((\"Photosynthesis\"))\n" +
+				"    n1[\"Inputs\"]\n" +
+				"      n2[\"Light\"]\n" +
+				"      n3[\"Water & CO2\"]\n" +
+				"    n4[\"Outputs\"]\n",
+		},
+		{
+			name: "quotes, backticks and line breaks escaped",
+			root: MindMapTree{Label: "The \"green\"\nfactory", Children: []MindMapTree{{Label: "`code`\r\nhere"}}},
+			want: "mindmap\n  root((\"The 'green' factory\"))\n    n1[\"'code'  here\"]\n",
+		},
+	}
+	for _, tt := range tests {
+		if got := RenderMermaid(tt.root); got != tt.want {
+			t.Errorf("%s: RenderMermaid() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
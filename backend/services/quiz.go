@@ -0,0 +1,338 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/MadMax168/Readsum/llm"
+)
+
+type GeneratedOption struct {
+	Text      string `json:"text"`
+	IsCorrect bool   `json:"is_correct"`
+}
+
+type GeneratedQuestion struct {
+	Prompt      string            `json:"prompt"`
+	Explanation string            `json:"explanation"`
+	Concept     string            `json:"concept"`
+	Difficulty  string            `json:"difficulty"`
+	Options     []GeneratedOption `json:"options"`
+}
+
+type GeneratedQuiz struct {
+	Title     string              `json:"title"`
+	Questions []GeneratedQuestion `json:"questions"`
+}
+
+// Question difficulty levels
+const (
+	DifficultyEasy   = "easy"
+	DifficultyMedium = "medium"
+	DifficultyHard   = "hard"
+)
+
+var difficultySchema = &llm.Schema{
+	Type: llm.TypeString,
+	Enum: []string{DifficultyEasy, DifficultyMedium, DifficultyHard},
+}
+
+// QuizFocus asks for count questions of a difficulty on one concept
+type QuizFocus struct {
+	Concept    string `json:"concept"`
+	Difficulty string `json:"difficulty"`
+	Count      int    `json:"count"`
+	Reason     string `json:"reason"`
+}
+
+// QuizPlan steers generation towards the concepts a student needs to practise
+type QuizPlan struct {
+	KnownConcepts []string    `json:"known_concepts,omitempty"`
+	Focus         []QuizFocus `json:"focus"`
+	NewConcepts   int         `json:"new_concepts"`
+}
+
+// planInstructions turns a plan into prompt instructions about concepts and difficulty
+func planInstructions(plan *QuizPlan) string {
+	var b strings.Builder
+	b.WriteString("Label every question with the concept it tests (a short noun phrase) and its difficulty (easy, medium or hard).\n")
+
+	if plan == nil {
+		return b.String()
+	}
+
+	if len(plan.KnownConcepts) > 0 {
+		b.WriteString("When a question tests one of these concepts, use exactly this concept name: ")
+		b.WriteString(strings.Join(plan.KnownConcepts, "; "))
+		b.WriteString("\n")
+	}
+
+	if len(plan.Focus) > 0 {
+		b.WriteString("Distribute the questions as follows:\n")
+		for _, f := range plan.Focus {
+			fmt.Fprintf(&b, "- %d %s question(s) on %q\n", f.Count, f.Difficulty, f.Concept)
+		}
+		if plan.NewConcepts > 0 {
+			fmt.Fprintf(&b, "- %d medium question(s) on concepts from the material not listed above\n", plan.NewConcepts)
+		}
+	}
+
+	return b.String()
+}
+
+var quizSchema = &llm.Schema{
+	Type: llm.TypeObject,
+	Properties: map[string]*llm.Schema{
+		"title": {Type: llm.TypeString},
+		"questions": {
+			Type: llm.TypeArray,
+			Items: &llm.Schema{
+				Type: llm.TypeObject,
+				Properties: map[string]*llm.Schema{
+					"prompt":      {Type: llm.TypeString},
+					"explanation": {Type: llm.TypeString},
+					"concept":     {Type: llm.TypeString},
+					"difficulty":  difficultySchema,
+					"options": {
+						Type: llm.TypeArray,
+						Items: &llm.Schema{
+							Type: llm.TypeObject,
+							Properties: map[string]*llm.Schema{
+								"text":       {Type: llm.TypeString},
+								"is_correct": {Type: llm.TypeBoolean},
+							},
+							Required: []string{"text", "is_correct"},
+						},
+					},
+				},
+				Required: []string{"prompt", "explanation", "concept", "difficulty", "options"},
+			},
+		},
+	},
+	Required: []string{"title", "questions"},
+}
+
+// GenerateQuiz builds a multiple-choice quiz with count questions from source,
+// following plan when one is given
+func (ai *AI) GenerateQuiz(system, source string, count int, plan *QuizPlan) (*GeneratedQuiz, error) {
+	prompt := fmt.Sprintf(`You are a teacher writing a multiple-choice quiz.
+Write exactly %d questions based only on the material below.
+Each question must have 4 options and exactly one correct option.
+Give a short explanation of why the correct option is right.
+%sWrite the quiz in the same language as the material.
+
+Material:
+%s`, count, planInstructions(plan), source)
+
+	var quiz GeneratedQuiz
+	if err := ai.GenerateJSON(system, prompt, quizSchema, &quiz); err != nil {
+		return nil, err
+	}
+
+	return &quiz, nil
+}
+
+// ValidateQuestion checks that a generated question is usable as multiple choice
+func ValidateQuestion(q GeneratedQuestion) error {
+	if strings.TrimSpace(q.Prompt) == "" {
+		return fmt.Errorf("question prompt is empty")
+	}
+	if len(q.Options) < 2 {
+		return fmt.Errorf("question %q has fewer than 2 options", q.Prompt)
+	}
+
+	correct := 0
+	for _, o := range q.Options {
+		if strings.TrimSpace(o.Text) == "" {
+			return fmt.Errorf("question %q has an empty option", q.Prompt)
+		}
+		if o.IsCorrect {
+			correct++
+		}
+	}
+	if correct != 1 {
+		return fmt.Errorf("question %q has %d correct options, want exactly 1", q.Prompt, correct)
+	}
+
+	return nil
+}
+
+type GeneratedCriterion struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	MaxPoints   float64 `json:"max_points"`
+}
+
+type GeneratedFreeResponse struct {
+	Prompt         string               `json:"prompt"`
+	ExpectedAnswer string               `json:"expected_answer"`
+	Concept        string               `json:"concept"`
+	Difficulty     string               `json:"difficulty"`
+	Rubric         []GeneratedCriterion `json:"rubric"`
+}
+
+type GeneratedFreeResponseQuiz struct {
+	Title     string                  `json:"title"`
+	Questions []GeneratedFreeResponse `json:"questions"`
+}
+
+var criterionSchema = &llm.Schema{
+	Type: llm.TypeObject,
+	Properties: map[string]*llm.Schema{
+		"name":        {Type: llm.TypeString},
+		"description": {Type: llm.TypeString},
+		"max_points":  {Type: llm.TypeNumber},
+	},
+	Required: []string{"name", "description", "max_points"},
+}
+
+var freeResponseSchema = &llm.Schema{
+	Type: llm.TypeObject,
+	Properties: map[string]*llm.Schema{
+		"title": {Type: llm.TypeString},
+		"questions": {
+			Type: llm.TypeArray,
+			Items: &llm.Schema{
+				Type: llm.TypeObject,
+				Properties: map[string]*llm.Schema{
+					"prompt":          {Type: llm.TypeString},
+					"expected_answer": {Type: llm.TypeString},
+					"concept":         {Type: llm.TypeString},
+					"difficulty":      difficultySchema,
+					"rubric":          {Type: llm.TypeArray, Items: criterionSchema},
+				},
+				Required: []string{"prompt", "expected_answer", "concept", "difficulty", "rubric"},
+			},
+		},
+	},
+	Required: []string{"title", "questions"},
+}
+
+// GenerateFreeResponse builds count short-answer or essay questions with model answers and rubrics
+func (ai *AI) GenerateFreeResponse(system, source string, count int, essay bool, plan *QuizPlan) (*GeneratedFreeResponseQuiz, error) {
+	kind := "short-answer questions that can be answered in one to three sentences"
+	criteria := "2 to 3"
+	if essay {
+		kind = "essay questions that require explaining and connecting several ideas"
+		criteria = "3 to 5"
+	}
+
+	prompt := fmt.Sprintf(`You are a teacher writing an exam.
+Write exactly %d %s, based only on the material below.
+For each question give the expected answer and a grading rubric of %s criteria.
+Each criterion has a name, a description of what earns the points, and max_points (1 to 5).
+%sWrite everything in the same language as the material.
+
+Material:
+%s`, count, kind, criteria, planInstructions(plan), source)
+
+	var quiz GeneratedFreeResponseQuiz
+	if err := ai.GenerateJSON(system, prompt, freeResponseSchema, &quiz); err != nil {
+		return nil, err
+	}
+
+	return &quiz, nil
+}
+
+// ValidateFreeResponse checks that a generated free-response question can be graded
+func ValidateFreeResponse(q GeneratedFreeResponse) error {
+	if strings.TrimSpace(q.Prompt) == "" {
+		return fmt.Errorf("question prompt is empty")
+	}
+	if strings.TrimSpace(q.ExpectedAnswer) == "" {
+		return fmt.Errorf("question %q has no expected answer", q.Prompt)
+	}
+	if len(q.Rubric) == 0 {
+		return fmt.Errorf("question %q has no rubric", q.Prompt)
+	}
+	for _, c := range q.Rubric {
+		if strings.TrimSpace(c.Name) == "" || c.MaxPoints <= 0 {
+			return fmt.Errorf("question %q has an invalid rubric criterion", q.Prompt)
+		}
+	}
+
+	return nil
+}
+
+type GradedCriterion struct {
+	Name     string  `json:"name"`
+	Points   float64 `json:"points"`
+	Feedback string  `json:"feedback"`
+}
+
+type FreeResponseGrade struct {
+	Criteria  []GradedCriterion `json:"criteria"`
+	Feedback  string            `json:"feedback"`
+	Rationale string            `json:"rationale"`
+}
+
+var gradeSchema = &llm.Schema{
+	Type: llm.TypeObject,
+	Properties: map[string]*llm.Schema{
+		"criteria": {
+			Type: llm.TypeArray,
+			Items: &llm.Schema{
+				Type: llm.TypeObject,
+				Properties: map[string]*llm.Schema{
+					"name":     {Type: llm.TypeString},
+					"points":   {Type: llm.TypeNumber},
+					"feedback": {Type: llm.TypeString},
+				},
+				Required: []string{"name", "points", "feedback"},
+			},
+		},
+		"feedback":  {Type: llm.TypeString},
+		"rationale": {Type: llm.TypeString},
+	},
+	Required: []string{"criteria", "feedback", "rationale"},
+}
+
+// GradeFreeResponse scores a student's answer against the rubric, criterion by criterion.
+// Points are clamped to each criterion's maximum and criteria the model skipped score zero.
+// The chat's persona is left out so every answer is marked the same way.
+func (ai *AI) GradeFreeResponse(question, expected string, rubric []GeneratedCriterion, response string) (*FreeResponseGrade, error) {
+	var b strings.Builder
+	for _, c := range rubric {
+		fmt.Fprintf(&b, "- %s (max %.1f points): %s\n", c.Name, c.MaxPoints, c.Description)
+	}
+
+	prompt := fmt.Sprintf(`You are a fair and strict teacher grading a student's answer.
+Score the answer against each rubric criterion, using the exact criterion names.
+Give short feedback per criterion, overall feedback addressed to the student,
+and a rationale for the teacher explaining how the scores were decided.
+Only judge the content; ignore spelling mistakes unless they change the meaning.
+Write the feedback in the same language as the question.
+
+Question:
+%s
+
+Expected answer:
+%s
+
+Rubric:
+%s
+Student answer:
+%s`, question, expected, b.String(), response)
+
+	var grade FreeResponseGrade
+	if err := ai.GenerateJSON("", prompt, gradeSchema, &grade); err != nil {
+		return nil, err
+	}
+
+	scored := make(map[string]GradedCriterion)
+	for _, g := range grade.Criteria {
+		scored[strings.ToLower(strings.TrimSpace(g.Name))] = g
+	}
+
+	var result []GradedCriterion
+	for _, c := range rubric {
+		g := scored[strings.ToLower(strings.TrimSpace(c.Name))]
+		g.Name = c.Name
+		g.Points = math.Max(0, math.Min(g.Points, c.MaxPoints))
+		result = append(result, g)
+	}
+	grade.Criteria = result
+
+	return &grade, nil
+}
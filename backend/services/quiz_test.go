@@ -0,0 +1,113 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/MadMax168/Readsum/llm"
+)
+
+func TestGenerateQuizReadsModelReply(t *testing.T) {
+	fake := llm.NewFake(`{
+		"title": "Plants",
+		"questions": [
+			{"prompt": "Where does photosynthesis happen?", "explanation": "In the leaves", "concept": "photosynthesis", "difficulty": "easy",
+			 "options": [{"text": "Leaves", "is_correct": true}, {"text": "Roots", "is_correct": false}]},
+			{"prompt": "Which gas do plants take in?", "explanation": "", "concept": "photosynthesis", "difficulty": "easy",
+			 "options": [{"text": "Oxygen", "is_correct": false}, {"text": "Nitrogen", "is_correct": false}]}
+		]
+	}`)
+	ai := NewAI(fake)
+
+	quiz, err := ai.GenerateQuiz("", "Plants make food in their leaves.", 2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quiz.Title != "Plants" {
+		t.Errorf("title = %q, want Plants", quiz.Title)
+	}
+
+	valid := 0
+	for _, q := range quiz.Questions {
+		if ValidateQuestion(q) == nil {
+			valid++
+		}
+	}
+	if valid != 1 {
+		t.Errorf("%d valid questions, want 1: the second has no correct option", valid)
+	}
+}
+
+func TestValidateQuestion(t *testing.T) {
+	tests := []struct {
+		name    string
+		q       GeneratedQuestion
+		wantErr bool
+	}{
+		{"valid", GeneratedQuestion{Prompt: "Q", Options: []GeneratedOption{{Text: "a", IsCorrect: true}, {Text: "b"}}}, false},
+		{"empty prompt", GeneratedQuestion{Prompt: " ", Options: []GeneratedOption{{Text: "a", IsCorrect: true}, {Text: "b"}}}, true},
+		{"one option", GeneratedQuestion{Prompt: "Q", Options: []GeneratedOption{{Text: "a", IsCorrect: true}}}, true},
+		{"empty option", GeneratedQuestion{Prompt: "Q", Options: []GeneratedOption{{Text: "a", IsCorrect: true}, {Text: ""}}}, true},
+		{"no correct option", GeneratedQuestion{Prompt: "Q", Options: []GeneratedOption{{Text: "a"}, {Text: "b"}}}, true},
+		{"two correct options", GeneratedQuestion{Prompt: "Q", Options: []GeneratedOption{{Text: "a", IsCorrect: true}, {Text: "b", IsCorrect: true}}}, true},
+	}
+	for _, tt := range tests {
+		if err := ValidateQuestion(tt.q); (err != nil) != tt.wantErr {
+			t.Errorf("%s: ValidateQuestion() error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestGradeFreeResponseClampsPoints(t *testing.T) {
+	fake := llm.NewFake(`{
+		"criteria": [
+			{"name": "accuracy", "points": 5, "feedback": "Correct"},
+			{"name": "Unknown", "points": 3, "feedback": "Not in the rubric"}
+		],
+		"feedback": "Good answer",
+		"rationale": "Accurate but says nothing about light"
+	}`)
+	ai := NewAI(fake)
+
+	rubric := []GeneratedCriterion{
+		{Name: "Accuracy", Description: "States the process correctly", MaxPoints: 2},
+		{Name: "Light", Description: "Mentions sunlight", MaxPoints: 1},
+	}
+	grade, err := ai.GradeFreeResponse("How do plants make food?", "By photosynthesis, using sunlight", rubric, "Photosynthesis")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(grade.Criteria) != 2 {
+		t.Fatalf("got %d criteria, want one per rubric criterion", len(grade.Criteria))
+	}
+	if c := grade.Criteria[0]; c.Name != "Accuracy" || c.Points != 2 {
+		t.Errorf("first criterion = %q with %v points, want Accuracy clamped to 2", c.Name, c.Points)
+	}
+	if c := grade.Criteria[1]; c.Name != "Light" || c.Points != 0 {
+		t.Errorf("second criterion = %q with %v points, want Light with 0", c.Name, c.Points)
+	}
+	if grade.Feedback != "Good answer" {
+		t.Errorf("feedback = %q", grade.Feedback)
+	}
+}
+
+func TestValidateFreeResponse(t *testing.T) {
+	rubric := []GeneratedCriterion{{Name: "Process", Description: "Names photosynthesis", MaxPoints: 2}}
+	tests := []struct {
+		name    string
+		q       GeneratedFreeResponse
+		wantErr bool
+	}{
+		{"valid", GeneratedFreeResponse{Prompt: "Q", ExpectedAnswer: "A", Rubric: rubric}, false},
+		{"empty prompt", GeneratedFreeResponse{Prompt: "", ExpectedAnswer: "A", Rubric: rubric}, true},
+		{"no expected answer", GeneratedFreeResponse{Prompt: "Q", ExpectedAnswer: " ", Rubric: rubric}, true},
+		{"no rubric", GeneratedFreeResponse{Prompt: "Q", ExpectedAnswer: "A"}, true},
+		{"unnamed criterion", GeneratedFreeResponse{Prompt: "Q", ExpectedAnswer: "A", Rubric: []GeneratedCriterion{{MaxPoints: 1}}}, true},
+		{"criterion without points", GeneratedFreeResponse{Prompt: "Q", ExpectedAnswer: "A", Rubric: []GeneratedCriterion{{Name: "Process"}}}, true},
+	}
+	for _, tt := range tests {
+		if err := ValidateFreeResponse(tt.q); (err != nil) != tt.wantErr {
+			t.Errorf("%s: ValidateFreeResponse() error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/MadMax168/Readsum/llm"
+)
+
+// ModelSettings tune the replies of one chat. Empty fields fall back to the
+// server defaults.
+type ModelSettings struct {
+	Model       string
+	Temperature *float32
+	TopP        *float32
+	// MaxOutputTokens limits conversational replies only
+	MaxOutputTokens *int
+	Safety          string
+}
+
+// ModelLimits are the settings a chat may choose from, with the values used
+// when it chooses none
+type ModelLimits struct {
+	// Models chats may switch to; empty means only the server's model
+	AllowedModels      []string `json:"allowed_models"`
+	MinTemperature     float32  `json:"min_temperature"`
+	MaxTemperature     float32  `json:"max_temperature"`
+	DefaultTemperature float32  `json:"default_temperature"`
+	MaxOutputTokens    int      `json:"max_output_tokens"`
+	SafetyLevels       []string `json:"safety_levels"`
+}
+
+const (
+	defaultReplyTemperature = 0.7
+	maxTemperature          = 2
+	defaultMaxOutputTokens  = 8192
+)
+
+// CurrentModelLimits reads the limits from LLM_ALLOWED_MODELS (comma-separated)
+// and LLM_MAX_OUTPUT_TOKENS
+func CurrentModelLimits() ModelLimits {
+	limits := ModelLimits{
+		MinTemperature:     0,
+		MaxTemperature:     maxTemperature,
+		DefaultTemperature: defaultReplyTemperature,
+		MaxOutputTokens:    defaultMaxOutputTokens,
+		SafetyLevels:       []string{llm.SafetyStrict, llm.SafetyStandard, llm.SafetyRelaxed},
+	}
+	for _, m := range strings.Split(os.Getenv("LLM_ALLOWED_MODELS"), ",") {
+		if m = strings.TrimSpace(m); m != "" {
+			limits.AllowedModels = append(limits.AllowedModels, m)
+		}
+	}
+	if n, err := strconv.Atoi(os.Getenv("LLM_MAX_OUTPUT_TOKENS")); err == nil && n > 0 {
+		limits.MaxOutputTokens = n
+	}
+	return limits
+}
+
+// ValidateModelSettings checks s against the server's limits
+func ValidateModelSettings(s ModelSettings) error {
+	limits := CurrentModelLimits()
+
+	if s.Model != "" {
+		allowed := false
+		for _, m := range limits.AllowedModels {
+			if m == s.Model {
+				allowed = true
+			}
+		}
+		if !allowed {
+			if len(limits.AllowedModels) == 0 {
+				return fmt.Errorf("this server does not allow choosing a model")
+			}
+			return fmt.Errorf("model must be one of: %s", strings.Join(limits.AllowedModels, ", "))
+		}
+	}
+	if s.Temperature != nil && (*s.Temperature < limits.MinTemperature || *s.Temperature > limits.MaxTemperature) {
+		return fmt.Errorf("temperature must be between %g and %g", limits.MinTemperature, limits.MaxTemperature)
+	}
+	if s.TopP != nil && (*s.TopP <= 0 || *s.TopP > 1) {
+		return fmt.Errorf("top_p must be greater than 0 and at most 1")
+	}
+	if s.MaxOutputTokens != nil && (*s.MaxOutputTokens < 1 || *s.MaxOutputTokens > limits.MaxOutputTokens) {
+		return fmt.Errorf("max_output_tokens must be between 1 and %d", limits.MaxOutputTokens)
+	}
+	if s.Safety != "" && s.Safety != llm.SafetyStrict && s.Safety != llm.SafetyStandard && s.Safety != llm.SafetyRelaxed {
+		return fmt.Errorf("safety must be 'strict', 'standard' or 'relaxed'")
+	}
+	return nil
+}
+
+// apply overrides the fields of req that s sets, except MaxOutputTokens: a
+// limit chosen for chat replies would cut structured answers short, so only
+// replyRequest applies it
+func (s ModelSettings) apply(req *llm.Request) {
+	req.Model = s.Model
+	req.Safety = s.Safety
+	if s.Temperature != nil {
+		req.Temperature = *s.Temperature
+	}
+	if s.TopP != nil {
+		req.TopP = *s.TopP
+	}
+}
+
+// replyRequest builds the model call for a chat reply with s applied
+func replyRequest(s ModelSettings, system string, history []llm.Message) llm.Request {
+	req := llm.Request{
+		System:      system,
+		Messages:    TrimContext(history, replyBudget(system)),
+		Temperature: defaultReplyTemperature,
+	}
+	s.apply(&req)
+	if s.MaxOutputTokens != nil {
+		req.MaxOutputTokens = *s.MaxOutputTokens
+	}
+	return req
+}
@@ -0,0 +1,37 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/MadMax168/Readsum/llm"
+)
+
+func TestReplyLimitOnlyAppliesToReplies(t *testing.T) {
+	fake := llm.NewFake("Leaves", `{"answer": "leaves"}`, "Photosynthesis")
+	ai := NewAI(fake)
+
+	tokens := 16
+	settings := ModelSettings{MaxOutputTokens: &tokens}
+	history := []llm.Message{{Role: llm.RoleUser, Text: "Where do plants make food?"}}
+
+	if _, err := ai.GenerateReply(settings, "", history); err != nil {
+		t.Fatal(err)
+	}
+	var out struct {
+		Answer string `json:"answer"`
+	}
+	schema := &llm.Schema{Type: llm.TypeObject, Properties: map[string]*llm.Schema{"answer": {Type: llm.TypeString}}}
+	if err := ai.GenerateChatJSON(settings, "", "Where do plants make food?", schema, &out); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ai.GenerateChatContent(settings, "", "Name the process."); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []int{tokens, 0, 0}
+	for i, req := range fake.Requests {
+		if req.MaxOutputTokens != want[i] {
+			t.Errorf("call %d: max tokens %d, want %d", i, req.MaxOutputTokens, want[i])
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package services
+
+import "math"
+
+const (
+	DefaultEaseFactor = 2.5
+	minEaseFactor     = 1.3
+)
+
+// ScheduleSM2 applies the SuperMemo-2 algorithm to a review graded 0-5.
+// It returns the new ease factor, interval in days and repetition count.
+func ScheduleSM2(ease float64, interval, repetitions, grade int) (float64, int, int) {
+	if ease < minEaseFactor {
+		ease = DefaultEaseFactor
+	}
+
+	// Failed recall restarts the repetitions without touching the ease factor
+	if grade < 3 {
+		return ease, 1, 0
+	}
+
+	switch repetitions {
+	case 0:
+		interval = 1
+	case 1:
+		interval = 6
+	default:
+		interval = int(math.Round(float64(interval) * ease))
+	}
+	repetitions++
+
+	q := float64(5 - grade)
+	ease += 0.1 - q*(0.08+q*0.02)
+	if ease < minEaseFactor {
+		ease = minEaseFactor
+	}
+
+	return ease, interval, repetitions
+}
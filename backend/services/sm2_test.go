@@ -0,0 +1,32 @@
+package services
+
+import (
+	"math"
+	"testing"
+)
+
+func TestScheduleSM2(t *testing.T) {
+	tests := []struct {
+		name                         string
+		ease                         float64
+		interval, repetitions, grade int
+		wantEase                     float64
+		wantInterval, wantReps       int
+	}{
+		{"first review", 2.5, 0, 0, 4, 2.5, 1, 1},
+		{"second review", 2.5, 1, 1, 5, 2.6, 6, 2},
+		{"later review grows by ease", 2.5, 6, 2, 4, 2.5, 15, 3},
+		{"hard recall lowers ease", 2.5, 6, 2, 3, 2.36, 15, 3},
+		{"failed recall restarts", 2.36, 15, 3, 2, 2.36, 1, 0},
+		{"blackout restarts", 2.5, 20, 5, 0, 2.5, 1, 0},
+		{"ease stays above the minimum", 1.3, 10, 4, 3, 1.3, 13, 5},
+		{"unset ease uses the default", 0, 0, 0, 5, 2.6, 1, 1},
+	}
+	for _, tt := range tests {
+		ease, interval, reps := ScheduleSM2(tt.ease, tt.interval, tt.repetitions, tt.grade)
+		if math.Abs(ease-tt.wantEase) > 1e-9 || interval != tt.wantInterval || reps != tt.wantReps {
+			t.Errorf("%s: ScheduleSM2(%v, %d, %d, %d) = (%v, %d, %d), want (%v, %d, %d)", tt.name,
+				tt.ease, tt.interval, tt.repetitions, tt.grade, ease, interval, reps, tt.wantEase, tt.wantInterval, tt.wantReps)
+		}
+	}
+}
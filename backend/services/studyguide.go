@@ -0,0 +1,313 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/MadMax168/Readsum/llm"
+	"github.com/go-pdf/fpdf"
+	"golang.org/x/text/encoding/charmap"
+)
+
+type GuideConcept struct {
+	Name        string `json:"name"`
+	Explanation string `json:"explanation"`
+}
+
+type GuideDefinition struct {
+	Term       string `json:"term"`
+	Definition string `json:"definition"`
+}
+
+type GuideExample struct {
+	Title    string `json:"title"`
+	Problem  string `json:"problem"`
+	Solution string `json:"solution"`
+}
+
+type GuidePractice struct {
+	Question string `json:"question"`
+	Answer   string `json:"answer"`
+}
+
+type StudyGuide struct {
+	Title             string            `json:"title"`
+	Overview          string            `json:"overview"`
+	KeyConcepts       []GuideConcept    `json:"key_concepts"`
+	Definitions       []GuideDefinition `json:"definitions"`
+	WorkedExamples    []GuideExample    `json:"worked_examples"`
+	PracticeQuestions []GuidePractice   `json:"practice_questions"`
+}
+
+func stringFields(names ...string) (map[string]*llm.Schema, []string) {
+	props := make(map[string]*llm.Schema)
+	for _, n := range names {
+		props[n] = &llm.Schema{Type: llm.TypeString}
+	}
+	return props, names
+}
+
+func objectList(names ...string) *llm.Schema {
+	props, required := stringFields(names...)
+	return &llm.Schema{
+		Type:  llm.TypeArray,
+		Items: &llm.Schema{Type: llm.TypeObject, Properties: props, Required: required},
+	}
+}
+
+var studyGuideSchema = &llm.Schema{
+	Type: llm.TypeObject,
+	Properties: map[string]*llm.Schema{
+		"title":              {Type: llm.TypeString},
+		"overview":           {Type: llm.TypeString},
+		"key_concepts":       objectList("name", "explanation"),
+		"definitions":        objectList("term", "definition"),
+		"worked_examples":    objectList("title", "problem", "solution"),
+		"practice_questions": objectList("question", "answer"),
+	},
+	Required: []string{"title", "overview", "key_concepts", "definitions", "worked_examples", "practice_questions"},
+}
+
+// GenerateStudyGuide builds a structured study guide from a chat's documents and conversation
+func (ai *AI) GenerateStudyGuide(system, documents, conversation string) (*StudyGuide, error) {
+	prompt := `You are a teacher writing a study guide for a student.
+Using only the material below, write:
+- a short overview of the topic
+- the key concepts, each with a clear explanation
+- definitions of the important terms
+- worked examples that show a problem and its step-by-step solution
+- practice questions with their answers
+Write the guide in the same language as the material.
+`
+	if documents != "" {
+		prompt += "\nDocuments:\n" + documents + "\n"
+	}
+	if conversation != "" {
+		prompt += "\nConversation with the student:\n" + conversation + "\n"
+	}
+
+	var guide StudyGuide
+	if err := ai.GenerateJSON(system, prompt, studyGuideSchema, &guide); err != nil {
+		return nil, err
+	}
+
+	return &guide, nil
+}
+
+// RenderMarkdown writes the study guide as Markdown
+func RenderMarkdown(g StudyGuide) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# %s\n\n", g.Title)
+	if g.Overview != "" {
+		fmt.Fprintf(&b, "%s\n\n", g.Overview)
+	}
+
+	if len(g.KeyConcepts) > 0 {
+		b.WriteString("## Key Concepts\n\n")
+		for _, c := range g.KeyConcepts {
+			fmt.Fprintf(&b, "### %s\n\n%s\n\n", c.Name, c.Explanation)
+		}
+	}
+
+	if len(g.Definitions) > 0 {
+		b.WriteString("## Definitions\n\n")
+		for _, d := range g.Definitions {
+			fmt.Fprintf(&b, "- **%s**: %s\n", d.Term, d.Definition)
+		}
+		b.WriteString("\n")
+	}
+
+	if len(g.WorkedExamples) > 0 {
+		b.WriteString("## Worked Examples\n\n")
+		for i, e := range g.WorkedExamples {
+			fmt.Fprintf(&b, "### Example %d: %s\n\n**Problem:** %s\n\n**Solution:** %s\n\n", i+1, e.Title, e.Problem, e.Solution)
+		}
+	}
+
+	if len(g.PracticeQuestions) > 0 {
+		b.WriteString("## Practice Questions\n\n")
+		for i, p := range g.PracticeQuestions {
+			fmt.Fprintf(&b, "%d. %s\n", i+1, p.Question)
+		}
+		b.WriteString("\n### Answers\n\n")
+		for i, p := range g.PracticeQuestions {
+			fmt.Fprintf(&b, "%d. %s\n", i+1, p.Answer)
+		}
+	}
+
+	return b.String()
+}
+
+var studyGuideHTML = template.Must(template.New("guide").Funcs(template.FuncMap{
+	"inc": func(i int) int { return i + 1 },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Tahoma, sans-serif; max-width: 48rem; margin: 2rem auto; padding: 0 1rem; line-height: 1.6; color: #1a1a1a; }
+h1 { border-bottom: 2px solid #ddd; padding-bottom: .3rem; }
+h2 { margin-top: 2rem; color: #333; }
+dt { font-weight: bold; }
+dd { margin: 0 0 .8rem 1rem; }
+.example { background: #f6f8fa; border-radius: 6px; padding: .5rem 1rem; margin-bottom: 1rem; }
+details { margin-bottom: .6rem; }
+summary { cursor: pointer; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{if .Overview}}<p>{{.Overview}}</p>{{end}}
+{{if .KeyConcepts}}<h2>Key Concepts</h2>
+{{range .KeyConcepts}}<h3>{{.Name}}</h3>
+<p>{{.Explanation}}</p>
+{{end}}{{end}}
+{{if .Definitions}}<h2>Definitions</h2>
+<dl>
+{{range .Definitions}}<dt>{{.Term}}</dt><dd>{{.Definition}}</dd>
+{{end}}</dl>{{end}}
+{{if .WorkedExamples}}<h2>Worked Examples</h2>
+{{range $i, $e := .WorkedExamples}}<div class="example">
+<h3>Example {{inc $i}}: {{$e.Title}}</h3>
+<p><strong>Problem:</strong> {{$e.Problem}}</p>
+<p><strong>Solution:</strong> {{$e.Solution}}</p>
+</div>
+{{end}}{{end}}
+{{if .PracticeQuestions}}<h2>Practice Questions</h2>
+<ol>
+{{range .PracticeQuestions}}<li><details><summary>{{.Question}}</summary><p>{{.Answer}}</p></details></li>
+{{end}}</ol>{{end}}
+</body>
+</html>
+`))
+
+// RenderHTML writes the study guide as a standalone HTML page
+func RenderHTML(g StudyGuide, w io.Writer) error {
+	return studyGuideHTML.Execute(w, g)
+}
+
+// ErrPDFFontRequired means the guide has text, such as Thai, that the built-in
+// PDF fonts cannot show and no font is configured
+var ErrPDFFontRequired = errors.New("study guide text needs a font set in PDF_FONT_PATH")
+
+// coreFontText reports whether the built-in PDF fonts, which use the
+// Windows-1252 code page, can show all of g
+func coreFontText(g StudyGuide) bool {
+	texts := []string{g.Title, g.Overview}
+	for _, c := range g.KeyConcepts {
+		texts = append(texts, c.Name, c.Explanation)
+	}
+	for _, d := range g.Definitions {
+		texts = append(texts, d.Term, d.Definition)
+	}
+	for _, e := range g.WorkedExamples {
+		texts = append(texts, e.Title, e.Problem, e.Solution)
+	}
+	for _, p := range g.PracticeQuestions {
+		texts = append(texts, p.Question, p.Answer)
+	}
+
+	for _, text := range texts {
+		for _, r := range text {
+			if _, ok := charmap.Windows1252.EncodeRune(r); !ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// RenderPDF writes the study guide as a PDF. The built-in PDF fonts only cover
+// Latin text, so set PDF_FONT_PATH to a TTF font for other scripts such as Thai;
+// without one, such guides fail with ErrPDFFontRequired instead of garbled text.
+func RenderPDF(g StudyGuide, w io.Writer) error {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(20, 20, 20)
+	pdf.SetAutoPageBreak(true, 20)
+
+	fontPath := os.Getenv("PDF_FONT_PATH")
+	if fontPath == "" && !coreFontText(g) {
+		return ErrPDFFontRequired
+	}
+
+	family := "Helvetica"
+	translate := pdf.UnicodeTranslatorFromDescriptor("")
+	if fontPath != "" {
+		font, err := os.ReadFile(fontPath)
+		if err != nil {
+			return fmt.Errorf("failed to read PDF font: %w", err)
+		}
+		family = "GuideFont"
+		pdf.AddUTF8FontFromBytes(family, "", font)
+		pdf.AddUTF8FontFromBytes(family, "B", font)
+		translate = func(s string) string { return s }
+	}
+
+	heading := func(text string, size float64) {
+		pdf.SetFont(family, "B", size)
+		pdf.MultiCell(0, size*0.5, translate(text), "", "L", false)
+		pdf.Ln(2)
+	}
+	paragraph := func(text string) {
+		pdf.SetFont(family, "", 11)
+		pdf.MultiCell(0, 5.5, translate(text), "", "L", false)
+		pdf.Ln(3)
+	}
+
+	pdf.AddPage()
+	heading(g.Title, 20)
+	if g.Overview != "" {
+		paragraph(g.Overview)
+	}
+
+	if len(g.KeyConcepts) > 0 {
+		heading("Key Concepts", 15)
+		for _, c := range g.KeyConcepts {
+			heading(c.Name, 12)
+			paragraph(c.Explanation)
+		}
+	}
+
+	if len(g.Definitions) > 0 {
+		heading("Definitions", 15)
+		for _, d := range g.Definitions {
+			heading(d.Term, 11)
+			paragraph(d.Definition)
+		}
+	}
+
+	if len(g.WorkedExamples) > 0 {
+		heading("Worked Examples", 15)
+		for i, e := range g.WorkedExamples {
+			heading(fmt.Sprintf("Example %d: %s", i+1, e.Title), 12)
+			paragraph("Problem: " + e.Problem)
+			paragraph("Solution: " + e.Solution)
+		}
+	}
+
+	if len(g.PracticeQuestions) > 0 {
+		heading("Practice Questions", 15)
+		for i, p := range g.PracticeQuestions {
+			paragraph(fmt.Sprintf("%d. %s", i+1, p.Question))
+		}
+		heading("Answers", 13)
+		for i, p := range g.PracticeQuestions {
+			paragraph(fmt.Sprintf("%d. %s", i+1, p.Answer))
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return err
+	}
+
+	_, err := buf.WriteTo(w)
+	return err
+}
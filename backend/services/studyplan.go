@@ -0,0 +1,332 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Study plan item kinds
+const (
+	PlanReading      = "reading"
+	PlanReview       = "review"
+	PlanQuiz         = "quiz"
+	PlanPracticeExam = "practice_exam"
+	PlanExam         = "exam"
+)
+
+const (
+	// Careful study reading is slower than skimming
+	readingWordsPerMinute = 150
+	minReadingMinutes     = 10
+	// Share of each day's time given to reading while documents remain
+	readingShare       = 0.7
+	reviewMinutes      = 15
+	quizMinutes        = 20
+	maxPracticeMinutes = 60
+	// Every quizEvery-th day has a quiz on the material read so far
+	quizEvery = 3
+)
+
+// Days after finishing a document on which its flashcards are reviewed
+var reviewOffsets = []int{1, 3, 7}
+
+type PlanDocument struct {
+	ID    uint
+	Title string
+	Words int
+}
+
+// PlanInput describes what to plan for. Dates are calendar days at midnight UTC.
+type PlanInput struct {
+	Start        time.Time
+	ExamDate     time.Time
+	DailyMinutes int
+	Documents    []PlanDocument
+	Concepts     []ConceptMastery
+}
+
+type PlanItem struct {
+	Date        time.Time
+	Kind        string
+	Title       string
+	Description string
+	Minutes     int
+	DocumentID  *uint
+	Concept     string
+}
+
+// CalendarDay returns the calendar date of t as midnight UTC
+func CalendarDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+type readingChunk struct {
+	doc     PlanDocument
+	day     int
+	minutes int
+}
+
+// BuildStudyPlan lays out the days from Start up to the exam: documents are read
+// in order within a daily reading budget sized by their length, each document's
+// flashcards are reviewed 1, 3 and 7 days after it is finished, a quiz on the
+// material so far comes every third day, and the last two days hold a practice
+// exam and a review of the concepts with the lowest mastery. It also returns
+// warnings when the time available is too short.
+func BuildStudyPlan(in PlanInput) ([]PlanItem, []string) {
+	start, exam := CalendarDay(in.Start), CalendarDay(in.ExamDate)
+	days := int(exam.Sub(start).Hours() / 24)
+	if days < 1 {
+		return nil, []string{"The exam date must be after today"}
+	}
+
+	var warnings []string
+	daily := in.DailyMinutes
+	date := func(d int) time.Time { return start.AddDate(0, 0, d) }
+
+	// Keep the final two days for the practice exam and final review when there is room
+	studyDays := days
+	if days >= 4 {
+		studyDays = days - 2
+	}
+
+	// Reading: fill each study day's reading budget in document order
+	var chunks []readingChunk
+	readingCap := int(math.Max(minReadingMinutes, math.Round(float64(daily)*readingShare)))
+	day, used := 0, 0
+	for _, doc := range in.Documents {
+		left := int(math.Max(minReadingMinutes, math.Ceil(float64(doc.Words)/readingWordsPerMinute)))
+		for left > 0 {
+			free := readingCap - used
+			// Avoid fragments: start a new day rather than reading a few minutes
+			if free < minReadingMinutes && free < left && day < studyDays-1 {
+				day, used = day+1, 0
+				continue
+			}
+			take := left
+			if day < studyDays-1 && take > free {
+				take = free
+			}
+			chunks = append(chunks, readingChunk{doc: doc, day: day, minutes: take})
+			left -= take
+			used += take
+		}
+	}
+	if used > readingCap && len(chunks) > 0 {
+		warnings = append(warnings, fmt.Sprintf(
+			"Not all documents fit in %d minutes a day before the exam; the last reading day is overloaded. Consider more daily minutes.", daily))
+	}
+
+	var items []PlanItem
+	parts := make(map[uint]int)
+	for _, c := range chunks {
+		parts[c.doc.ID]++
+	}
+	seen := make(map[uint]int)
+	finished := make(map[int][]PlanDocument)
+	for i, c := range chunks {
+		id := c.doc.ID
+		seen[id]++
+		title := "Read: " + c.doc.Title
+		if parts[id] > 1 {
+			title = fmt.Sprintf("%s (part %d of %d)", title, seen[id], parts[id])
+		}
+		items = append(items, PlanItem{
+			Date:        date(c.day),
+			Kind:        PlanReading,
+			Title:       title,
+			Description: fmt.Sprintf("About %d words in total; take notes on key terms.", c.doc.Words),
+			Minutes:     c.minutes,
+			DocumentID:  &id,
+		})
+		if i == len(chunks)-1 || chunks[i+1].doc.ID != id {
+			finished[c.day] = append(finished[c.day], c.doc)
+		}
+	}
+	lastReadingDay := -1
+	if len(chunks) > 0 {
+		lastReadingDay = chunks[len(chunks)-1].day
+	}
+
+	finishDays := make([]int, 0, len(finished))
+	for d := range finished {
+		finishDays = append(finishDays, d)
+	}
+	sort.Ints(finishDays)
+
+	// Spaced reviews of each document after it is finished
+	for _, d := range finishDays {
+		for _, doc := range finished[d] {
+			for _, offset := range reviewOffsets {
+				if d+offset >= days {
+					continue
+				}
+				id := doc.ID
+				items = append(items, PlanItem{
+					Date:        date(d + offset),
+					Kind:        PlanReview,
+					Title:       "Review flashcards: " + doc.Title,
+					Description: "Work through the due cards of this document's decks.",
+					Minutes:     reviewMinutes,
+					DocumentID:  &id,
+				})
+			}
+		}
+	}
+
+	// Quizzes on material already read
+	firstFinished := days
+	if len(finishDays) > 0 {
+		firstFinished = finishDays[0]
+	}
+	for d := quizEvery - 1; d < studyDays; d += quizEvery {
+		if d <= firstFinished {
+			continue
+		}
+		items = append(items, PlanItem{
+			Date:        date(d),
+			Kind:        PlanQuiz,
+			Title:       "Quiz on the material covered so far",
+			Description: "Take an adaptive quiz in the chat to check what stuck.",
+			Minutes:     quizMinutes,
+		})
+	}
+
+	// Concepts still below mastery, weakest first
+	var weak []ConceptMastery
+	for _, c := range in.Concepts {
+		if c.Level != LevelMastered {
+			weak = append(weak, c)
+		}
+	}
+	sort.SliceStable(weak, func(i, j int) bool { return weak[i].Mastery < weak[j].Mastery })
+
+	conceptItem := func(d int, c ConceptMastery) PlanItem {
+		return PlanItem{
+			Date:        date(d),
+			Kind:        PlanReview,
+			Title:       "Review concept: " + c.Concept,
+			Description: fmt.Sprintf("Current mastery %.0f%%. Re-read the relevant passages and practise questions on it.", c.Mastery*100),
+			Minutes:     reviewMinutes,
+			Concept:     c.Concept,
+		}
+	}
+
+	// Study days after reading ends rotate through the weak concepts
+	next := 0
+	for d := lastReadingDay + 1; d < studyDays && len(weak) > 0; d++ {
+		for n := 0; n < 2 && n < len(weak); n++ {
+			items = append(items, conceptItem(d, weak[next%len(weak)]))
+			next++
+		}
+	}
+
+	if days >= 4 {
+		items = append(items, PlanItem{
+			Date:        date(days - 2),
+			Kind:        PlanPracticeExam,
+			Title:       "Timed practice exam",
+			Description: "Start a timed exam from the chat's question bank and check the topic report.",
+			Minutes:     int(math.Min(maxPracticeMinutes, float64(daily))),
+		})
+
+		// The last day goes to the weakest concepts, as many as fit
+		final := days - 1
+		budget := daily
+		for _, c := range weak {
+			if budget < reviewMinutes {
+				break
+			}
+			items = append(items, conceptItem(final, c))
+			budget -= reviewMinutes
+		}
+		if len(weak) == 0 {
+			items = append(items, PlanItem{
+				Date:        date(final),
+				Kind:        PlanReview,
+				Title:       "Final review of all documents",
+				Description: "Skim your notes and review every due flashcard.",
+				Minutes:     int(math.Min(float64(daily), 30)),
+			})
+		}
+	} else {
+		warnings = append(warnings, "The exam is less than four days away, so there is no time for a practice exam.")
+	}
+
+	items = append(items, PlanItem{
+		Date:  exam,
+		Kind:  PlanExam,
+		Title: "Exam day",
+	})
+
+	kindOrder := map[string]int{PlanReading: 0, PlanReview: 1, PlanQuiz: 2, PlanPracticeExam: 3, PlanExam: 4}
+	sort.SliceStable(items, func(i, j int) bool {
+		if !items[i].Date.Equal(items[j].Date) {
+			return items[i].Date.Before(items[j].Date)
+		}
+		return kindOrder[items[i].Kind] < kindOrder[items[j].Kind]
+	})
+
+	return items, warnings
+}
+
+// CalendarEvent is an all-day entry of an iCalendar feed
+type CalendarEvent struct {
+	UID         string
+	Date        time.Time
+	Summary     string
+	Description string
+}
+
+var icsText = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+// icsLine folds a content line at 75 octets as RFC 5545 requires, without
+// splitting UTF-8 sequences
+func icsLine(b *strings.Builder, line string) {
+	// Continuation lines start with a space, which counts towards the limit
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		b.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		limit = 74
+	}
+	b.WriteString(line + "\r\n")
+}
+
+// RenderICS writes events as an iCalendar feed named name
+func RenderICS(name string, events []CalendarEvent, now time.Time) string {
+	var b strings.Builder
+	stamp := now.UTC().Format("20060102T150405Z")
+
+	icsLine(&b, "BEGIN:VCALENDAR")
+	icsLine(&b, "VERSION:2.0")
+	icsLine(&b, "PRODID:-//Readsum//Study Plan//EN")
+	icsLine(&b, "CALSCALE:GREGORIAN")
+	icsLine(&b, "METHOD:PUBLISH")
+	icsLine(&b, "X-WR-CALNAME:"+icsText.Replace(name))
+	icsLine(&b, "REFRESH-INTERVAL;VALUE=DURATION:PT6H")
+	icsLine(&b, "X-PUBLISHED-TTL:PT6H")
+
+	for _, e := range events {
+		icsLine(&b, "BEGIN:VEVENT")
+		icsLine(&b, "UID:"+e.UID)
+		icsLine(&b, "DTSTAMP:"+stamp)
+		icsLine(&b, "DTSTART;VALUE=DATE:"+e.Date.Format("20060102"))
+		icsLine(&b, "DTEND;VALUE=DATE:"+e.Date.AddDate(0, 0, 1).Format("20060102"))
+		icsLine(&b, "SUMMARY:"+icsText.Replace(e.Summary))
+		if e.Description != "" {
+			icsLine(&b, "DESCRIPTION:"+icsText.Replace(e.Description))
+		}
+		icsLine(&b, "TRANSP:TRANSPARENT")
+		icsLine(&b, "END:VEVENT")
+	}
+
+	icsLine(&b, "END:VCALENDAR")
+	return b.String()
+}
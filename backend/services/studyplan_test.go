@@ -0,0 +1,206 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func day(d int) time.Time {
+	return time.Date(2026, 6, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestBuildStudyPlan(t *testing.T) {
+	in := PlanInput{
+		Start:        time.Date(2026, 6, 1, 18, 30, 0, 0, time.UTC),
+		ExamDate:     day(11),
+		DailyMinutes: 60,
+		Documents: []PlanDocument{
+			{ID: 1, Title: "Leaves", Words: 3000},
+			{ID: 2, Title: "Roots", Words: 6000},
+		},
+		Concepts: []ConceptMastery{
+			{Concept: "oxygen", Mastery: 0.6, Level: LevelLearning},
+			{Concept: "light", Mastery: 0.2, Level: LevelWeak},
+			{Concept: "water", Mastery: 0.9, Level: LevelMastered},
+		},
+	}
+
+	items, warnings := BuildStudyPlan(in)
+	if len(warnings) != 0 {
+		t.Errorf("warnings %q, want none", warnings)
+	}
+
+	type entry struct {
+		date    time.Time
+		kind    string
+		title   string
+		minutes int
+	}
+	var reading, quizzes, docReviews, practice []entry
+	concepts := make(map[time.Time][]string)
+	for i, item := range items {
+		if i > 0 && item.Date.Before(items[i-1].Date) {
+			t.Fatalf("item %d on %v comes after one on %v", i, item.Date, items[i-1].Date)
+		}
+		e := entry{item.Date, item.Kind, item.Title, item.Minutes}
+		switch {
+		case item.Kind == PlanReading:
+			reading = append(reading, e)
+		case item.Kind == PlanQuiz:
+			quizzes = append(quizzes, e)
+		case item.Kind == PlanPracticeExam:
+			practice = append(practice, e)
+		case item.Concept != "":
+			concepts[item.Date] = append(concepts[item.Date], item.Concept)
+		case item.Kind == PlanReview:
+			docReviews = append(docReviews, e)
+		}
+	}
+
+	// The daily reading budget is 42 minutes: Leaves takes 20 and Roots 40
+	wantReading := []entry{
+		{day(1), PlanReading, "Read: Leaves", 20},
+		{day(1), PlanReading, "Read: Roots (part 1 of 2)", 22},
+		{day(2), PlanReading, "Read: Roots (part 2 of 2)", 18},
+	}
+	if len(reading) != len(wantReading) {
+		t.Fatalf("reading = %+v, want %+v", reading, wantReading)
+	}
+	for i := range wantReading {
+		if reading[i] != wantReading[i] {
+			t.Errorf("reading %d = %+v, want %+v", i, reading[i], wantReading[i])
+		}
+	}
+
+	wantReviews := map[string][]time.Time{
+		"Review flashcards: Leaves": {day(2), day(4), day(8)},
+		"Review flashcards: Roots":  {day(3), day(5), day(9)},
+	}
+	gotReviews := make(map[string][]time.Time)
+	for _, e := range docReviews {
+		gotReviews[e.title] = append(gotReviews[e.title], e.date)
+	}
+	for title, dates := range wantReviews {
+		got := gotReviews[title]
+		if len(got) != len(dates) {
+			t.Errorf("%s on %v, want %v", title, got, dates)
+			continue
+		}
+		for i := range dates {
+			if !got[i].Equal(dates[i]) {
+				t.Errorf("%s on %v, want %v", title, got, dates)
+				break
+			}
+		}
+	}
+
+	if len(quizzes) != 2 || !quizzes[0].date.Equal(day(3)) || !quizzes[1].date.Equal(day(6)) {
+		t.Errorf("quizzes = %+v, want every third day", quizzes)
+	}
+	if len(practice) != 1 || !practice[0].date.Equal(day(9)) || practice[0].minutes != 60 {
+		t.Errorf("practice exams = %+v, want one of 60 minutes two days before the exam", practice)
+	}
+
+	// Mastered concepts are left out; the weakest comes first
+	for d := 3; d <= 10; d++ {
+		got := concepts[day(d)]
+		if d == 9 {
+			if len(got) != 0 {
+				t.Errorf("concept reviews on the practice exam day: %v", got)
+			}
+			continue
+		}
+		if len(got) != 2 || got[0] != "light" || got[1] != "oxygen" {
+			t.Errorf("concept reviews on June %d = %v, want light then oxygen", d, got)
+		}
+	}
+
+	last := items[len(items)-1]
+	if last.Kind != PlanExam || !last.Date.Equal(day(11)) {
+		t.Errorf("last item is %s on %v, want the exam on June 11", last.Kind, last.Date)
+	}
+}
+
+func TestBuildStudyPlanWarnings(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       PlanInput
+		warnings int
+		items    int
+	}{
+		{
+			name:     "exam today",
+			in:       PlanInput{Start: day(1), ExamDate: day(1), DailyMinutes: 60},
+			warnings: 1,
+		},
+		{
+			name: "too little time to read",
+			// 60 minutes of reading into 14 a day over three study days
+			in: PlanInput{Start: day(1), ExamDate: day(6), DailyMinutes: 20,
+				Documents: []PlanDocument{{ID: 1, Title: "Leaves", Words: 9000}}},
+			warnings: 1,
+			// Three reading days, one review before the exam, a practice exam, a final review and the exam
+			items: 7,
+		},
+		{
+			name: "no room for a practice exam",
+			in: PlanInput{Start: day(1), ExamDate: day(4), DailyMinutes: 60,
+				Documents: []PlanDocument{{ID: 1, Title: "Leaves", Words: 300}}},
+			warnings: 1,
+			// Reading, a review the next day, a quiz and the exam
+			items: 4,
+		},
+	}
+	for _, tt := range tests {
+		items, warnings := BuildStudyPlan(tt.in)
+		if len(warnings) != tt.warnings || len(items) != tt.items {
+			t.Errorf("%s: %d items and warnings %q, want %d items and %d warnings", tt.name, len(items), warnings, tt.items, tt.warnings)
+		}
+	}
+
+	items, _ := BuildStudyPlan(PlanInput{Start: day(1), ExamDate: day(6), DailyMinutes: 20,
+		Documents: []PlanDocument{{ID: 1, Title: "Leaves", Words: 9000}}})
+	if last := items[2]; last.Kind != PlanReading || last.Minutes != 32 || !last.Date.Equal(day(3)) {
+		t.Errorf("last reading is %+v, want the remaining 32 minutes on the last study day", last)
+	}
+}
+
+func TestRenderICS(t *testing.T) {
+	long := strings.Repeat("Photosynthesis การสังเคราะห์ด้วยแสง, ", 6)
+	ics := RenderICS("Biology; term 1", []CalendarEvent{
+		{UID: "item-1@readsum", Date: day(1), Summary: "Read: Leaves", Description: long + "\nback\\slash"},
+	}, time.Date(2026, 5, 31, 9, 0, 0, 0, time.FixedZone("", 7*3600)))
+
+	if !strings.HasSuffix(ics, "END:VCALENDAR\r\n") {
+		t.Fatal("feed does not end with END:VCALENDAR")
+	}
+	for i, line := range strings.Split(strings.TrimSuffix(ics, "\r\n"), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("line %d is %d octets long", i, len(line))
+		}
+		if !utf8.ValidString(line) {
+			t.Errorf("line %d splits a UTF-8 sequence: %q", i, line)
+		}
+		if strings.Contains(line, "\n") {
+			t.Errorf("line %d has a bare line feed", i)
+		}
+	}
+
+	unfolded := strings.ReplaceAll(ics, "\r\n ", "")
+	wantDescription := "DESCRIPTION:" + strings.ReplaceAll(long, ",", `\,`) + `\nback\\slash` + "\r\n"
+	for _, want := range []string{
+		`X-WR-CALNAME:Biology\; term 1` + "\r\n",
+		"UID:item-1@readsum\r\n",
+		"DTSTAMP:20260531T020000Z\r\n",
+		"DTSTART;VALUE=DATE:20260601\r\n",
+		"DTEND;VALUE=DATE:20260602\r\n",
+		"SUMMARY:Read: Leaves\r\n",
+		wantDescription,
+	} {
+		if !strings.Contains(unfolded, want) {
+			t.Errorf("feed is missing %q", want)
+		}
+	}
+}
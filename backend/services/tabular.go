@@ -0,0 +1,439 @@
+package services
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// Delimited text formats accepted by ParseDelimited
+const (
+	FormatAuto    = "auto"
+	FormatCSV     = "csv"
+	FormatTSV     = "tsv"
+	FormatQuizlet = "quizlet"
+)
+
+// Import targets
+const (
+	TargetDeck = "deck"
+	TargetQuiz = "quiz"
+)
+
+const (
+	MaxImportRows   = 5000
+	maxImportField  = 5000
+	maxImportFields = 50
+)
+
+// DelimitedOptions describes how to split the text. FieldSeparator and
+// RowSeparator only apply to the Quizlet format, which defaults to a tab
+// between term and definition and a newline between cards.
+type DelimitedOptions struct {
+	Format         string
+	FieldSeparator string
+	RowSeparator   string
+}
+
+// DelimitedRow is one parsed record with its 1-based line (or card) number
+type DelimitedRow struct {
+	Line   int
+	Fields []string
+}
+
+// DetectFormat guesses TSV when the first line has a tab and CSV otherwise
+func DetectFormat(text string) string {
+	first, _, _ := strings.Cut(text, "\n")
+	if strings.Contains(first, "\t") {
+		return FormatTSV
+	}
+	return FormatCSV
+}
+
+// ParseDelimited splits CSV, TSV or Quizlet-style export text into rows,
+// skipping blank lines. It returns the format actually used.
+func ParseDelimited(text string, opts DelimitedOptions) ([]DelimitedRow, string, error) {
+	if !utf8.ValidString(text) {
+		return nil, "", fmt.Errorf("file is not valid UTF-8 text")
+	}
+	text = strings.TrimPrefix(text, "\ufeff")
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+
+	format := opts.Format
+	if format == "" || format == FormatAuto {
+		format = DetectFormat(text)
+	}
+
+	var rows []DelimitedRow
+	switch format {
+	case FormatCSV, FormatTSV:
+		r := csv.NewReader(strings.NewReader(text))
+		if format == FormatTSV {
+			r.Comma = '\t'
+		}
+		r.FieldsPerRecord = -1
+		r.LazyQuotes = true
+
+		for {
+			record, err := r.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, format, fmt.Errorf("invalid %s: %w", strings.ToUpper(format), err)
+			}
+			line, _ := r.FieldPos(0)
+			if isBlankRecord(record) {
+				continue
+			}
+			rows = append(rows, DelimitedRow{Line: line, Fields: record})
+			if len(rows) > MaxImportRows {
+				return nil, format, fmt.Errorf("file has more than %d rows", MaxImportRows)
+			}
+		}
+	case FormatQuizlet:
+		fieldSep, rowSep := opts.FieldSeparator, opts.RowSeparator
+		if fieldSep == "" {
+			fieldSep = "\t"
+		}
+		if rowSep == "" {
+			rowSep = "\n"
+		}
+		if fieldSep == rowSep {
+			return nil, format, fmt.Errorf("field and row separators must differ")
+		}
+
+		for i, card := range strings.Split(text, rowSep) {
+			if strings.TrimSpace(card) == "" {
+				continue
+			}
+			// Only the first separator splits, so definitions may contain it
+			term, definition, _ := strings.Cut(card, fieldSep)
+			rows = append(rows, DelimitedRow{Line: i + 1, Fields: []string{term, definition}})
+			if len(rows) > MaxImportRows {
+				return nil, format, fmt.Errorf("file has more than %d rows", MaxImportRows)
+			}
+		}
+	default:
+		return nil, format, fmt.Errorf("format must be 'auto', 'csv', 'tsv' or 'quizlet'")
+	}
+
+	for i := range rows {
+		if len(rows[i].Fields) > maxImportFields {
+			return nil, format, fmt.Errorf("line %d has more than %d columns", rows[i].Line, maxImportFields)
+		}
+		for j, f := range rows[i].Fields {
+			rows[i].Fields[j] = strings.TrimSpace(f)
+		}
+	}
+
+	return rows, format, nil
+}
+
+func isBlankRecord(record []string) bool {
+	for _, f := range record {
+		if strings.TrimSpace(f) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// ColumnMapping maps 0-based columns to card fields (front, back) or to
+// question fields (prompt, answer, distractors, concept, explanation)
+type ColumnMapping struct {
+	Front       *int  `json:"front,omitempty"`
+	Back        *int  `json:"back,omitempty"`
+	Prompt      *int  `json:"prompt,omitempty"`
+	Answer      *int  `json:"answer,omitempty"`
+	Distractors []int `json:"distractors,omitempty"`
+	Concept     *int  `json:"concept,omitempty"`
+	Explanation *int  `json:"explanation,omitempty"`
+}
+
+var headerAliases = map[string][]string{
+	"front":       {"front", "term", "word", "question", "prompt", "คำศัพท์", "คำถาม"},
+	"back":        {"back", "definition", "answer", "meaning", "ความหมาย", "คำตอบ"},
+	"prompt":      {"prompt", "question", "term", "front", "คำถาม"},
+	"answer":      {"answer", "correct", "correct answer", "definition", "back", "คำตอบ"},
+	"distractor":  {"distractor", "wrong", "incorrect", "option", "choice"},
+	"concept":     {"concept", "topic", "tag", "tags", "หัวข้อ"},
+	"explanation": {"explanation", "note", "notes", "คำอธิบาย"},
+}
+
+// headerField returns which field a header cell names, if any
+func headerField(cell string, fields ...string) string {
+	cell = strings.ToLower(strings.TrimSpace(cell))
+	for _, field := range fields {
+		for _, alias := range headerAliases[field] {
+			// Numbered columns such as "Option 2" or "wrong_1" count too
+			if cell == alias || strings.HasPrefix(cell, alias+" ") || strings.HasPrefix(cell, alias+"_") {
+				return field
+			}
+		}
+	}
+	return ""
+}
+
+// LooksLikeHeader reports whether a row names at least one known column
+func LooksLikeHeader(row []string) bool {
+	for _, cell := range row {
+		if headerField(cell, "front", "back", "prompt", "answer", "distractor", "concept", "explanation") != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// SuggestMapping picks columns for target from the header names when there is
+// a header, falling back to position: the first two columns, and for quizzes
+// every further column as a distractor
+func SuggestMapping(header []string, columns int, target string) ColumnMapping {
+	var m ColumnMapping
+	index := func(i int) *int { return &i }
+
+	for i, cell := range header {
+		if target == TargetQuiz {
+			switch headerField(cell, "prompt", "answer", "distractor", "concept", "explanation") {
+			case "prompt":
+				if m.Prompt == nil {
+					m.Prompt = index(i)
+				}
+			case "answer":
+				if m.Answer == nil {
+					m.Answer = index(i)
+				}
+			case "distractor":
+				m.Distractors = append(m.Distractors, i)
+			case "concept":
+				m.Concept = index(i)
+			case "explanation":
+				m.Explanation = index(i)
+			}
+			continue
+		}
+
+		switch headerField(cell, "front", "back") {
+		case "front":
+			if m.Front == nil {
+				m.Front = index(i)
+			}
+		case "back":
+			if m.Back == nil {
+				m.Back = index(i)
+			}
+		}
+	}
+
+	if target == TargetQuiz {
+		if m.Prompt == nil && m.Answer == nil && columns >= 2 {
+			m.Prompt, m.Answer = index(0), index(1)
+			if header == nil {
+				for i := 2; i < columns; i++ {
+					m.Distractors = append(m.Distractors, i)
+				}
+			}
+		}
+		return m
+	}
+
+	if m.Front == nil && m.Back == nil && columns >= 2 {
+		m.Front, m.Back = index(0), index(1)
+	}
+	return m
+}
+
+// ValidateMapping checks that the required fields of target are mapped to
+// distinct columns that exist
+func ValidateMapping(m ColumnMapping, columns int, target string) error {
+	used := make(map[int]string)
+	check := func(name string, col *int, required bool) error {
+		if col == nil {
+			if required {
+				return fmt.Errorf("mapping for %q is required", name)
+			}
+			return nil
+		}
+		if *col < 0 || *col >= columns {
+			return fmt.Errorf("column %d mapped to %q does not exist", *col, name)
+		}
+		if other, ok := used[*col]; ok {
+			return fmt.Errorf("column %d is mapped to both %q and %q", *col, other, name)
+		}
+		used[*col] = name
+		return nil
+	}
+
+	var err error
+	if target == TargetQuiz {
+		for _, f := range []struct {
+			name     string
+			col      *int
+			required bool
+		}{
+			{"prompt", m.Prompt, true},
+			{"answer", m.Answer, true},
+			{"concept", m.Concept, false},
+			{"explanation", m.Explanation, false},
+		} {
+			if err = check(f.name, f.col, f.required); err != nil {
+				return err
+			}
+		}
+		for _, d := range m.Distractors {
+			d := d
+			if err = check("distractors", &d, true); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err = check("front", m.Front, true); err != nil {
+		return err
+	}
+	return check("back", m.Back, true)
+}
+
+// RowError is a validation problem with one imported row
+type RowError struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+type MappedCard struct {
+	Line  int    `json:"line"`
+	Front string `json:"front"`
+	Back  string `json:"back"`
+}
+
+type MappedQuestion struct {
+	Line        int      `json:"line"`
+	Prompt      string   `json:"prompt"`
+	Answer      string   `json:"answer"`
+	Distractors []string `json:"distractors,omitempty"`
+	Concept     string   `json:"concept,omitempty"`
+	Explanation string   `json:"explanation,omitempty"`
+}
+
+func field(row DelimitedRow, col *int) string {
+	if col == nil || *col >= len(row.Fields) {
+		return ""
+	}
+	return row.Fields[*col]
+}
+
+func checkLength(row DelimitedRow, name, value string) *RowError {
+	if utf8.RuneCountInString(value) > maxImportField {
+		return &RowError{Line: row.Line, Message: fmt.Sprintf("%s is longer than %d characters", name, maxImportField)}
+	}
+	return nil
+}
+
+// MapCards turns rows into card fronts and backs, reporting rows with a
+// missing side, an overlong field or a front already seen in the file
+func MapCards(rows []DelimitedRow, m ColumnMapping) ([]MappedCard, []RowError) {
+	var cards []MappedCard
+	var errs []RowError
+	seen := make(map[string]int)
+
+	for _, row := range rows {
+		card := MappedCard{Line: row.Line, Front: field(row, m.Front), Back: field(row, m.Back)}
+		switch {
+		case card.Front == "":
+			errs = append(errs, RowError{Line: row.Line, Message: "front is empty"})
+			continue
+		case card.Back == "":
+			errs = append(errs, RowError{Line: row.Line, Message: "back is empty"})
+			continue
+		}
+		if e := checkLength(row, "front", card.Front); e != nil {
+			errs = append(errs, *e)
+			continue
+		}
+		if e := checkLength(row, "back", card.Back); e != nil {
+			errs = append(errs, *e)
+			continue
+		}
+
+		key := strings.ToLower(card.Front)
+		if first, dup := seen[key]; dup {
+			errs = append(errs, RowError{Line: row.Line, Message: fmt.Sprintf("duplicate of the card on line %d", first)})
+			continue
+		}
+		seen[key] = row.Line
+
+		cards = append(cards, card)
+	}
+
+	return cards, errs
+}
+
+// MapQuestions turns rows into questions. Rows with distractors become multiple
+// choice; rows without become short-answer questions.
+func MapQuestions(rows []DelimitedRow, m ColumnMapping) ([]MappedQuestion, []RowError) {
+	var questions []MappedQuestion
+	var errs []RowError
+	seen := make(map[string]int)
+
+	for _, row := range rows {
+		q := MappedQuestion{
+			Line:        row.Line,
+			Prompt:      field(row, m.Prompt),
+			Answer:      field(row, m.Answer),
+			Concept:     field(row, m.Concept),
+			Explanation: field(row, m.Explanation),
+		}
+		if q.Prompt == "" {
+			errs = append(errs, RowError{Line: row.Line, Message: "prompt is empty"})
+			continue
+		}
+		if q.Answer == "" {
+			errs = append(errs, RowError{Line: row.Line, Message: "answer is empty"})
+			continue
+		}
+
+		options := map[string]bool{strings.ToLower(q.Answer): true}
+		invalid := false
+		for _, d := range m.Distractors {
+			text := field(row, &d)
+			if text == "" {
+				continue
+			}
+			if options[strings.ToLower(text)] {
+				errs = append(errs, RowError{Line: row.Line, Message: fmt.Sprintf("option %q appears twice", text)})
+				invalid = true
+				break
+			}
+			options[strings.ToLower(text)] = true
+			q.Distractors = append(q.Distractors, text)
+		}
+		if invalid {
+			continue
+		}
+
+		for _, f := range [][2]string{{"prompt", q.Prompt}, {"answer", q.Answer}, {"explanation", q.Explanation}} {
+			if e := checkLength(row, f[0], f[1]); e != nil {
+				errs = append(errs, *e)
+				invalid = true
+				break
+			}
+		}
+		if invalid {
+			continue
+		}
+
+		key := strings.ToLower(q.Prompt)
+		if first, dup := seen[key]; dup {
+			errs = append(errs, RowError{Line: row.Line, Message: fmt.Sprintf("duplicate of the question on line %d", first)})
+			continue
+		}
+		seen[key] = row.Line
+
+		questions = append(questions, q)
+	}
+
+	return questions, errs
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDelimited(t *testing.T) {
+	tests := []struct {
+		name       string
+		text       string
+		opts       DelimitedOptions
+		wantFormat string
+		want       []DelimitedRow
+		wantErr    bool
+	}{
+		{
+			name:       "csv with BOM, CRLF, quotes and blank lines",
+			text:       "\ufeffterm,definition\r\n\r\n\" leaf \",\"makes food,\nmostly\"\r\n,\r\nroot,holds water\r\n",
+			wantFormat: FormatCSV,
+			want: []DelimitedRow{
+				{Line: 1, Fields: []string{"term", "definition"}},
+				{Line: 3, Fields: []string{"leaf", "makes food,\nmostly"}},
+				{Line: 6, Fields: []string{"root", "holds water"}},
+			},
+		},
+		{
+			name:       "tab on the first line means TSV",
+			text:       "leaf\tmakes food, mostly\nroot\tholds water\textra",
+			wantFormat: FormatTSV,
+			want: []DelimitedRow{
+				{Line: 1, Fields: []string{"leaf", "makes food, mostly"}},
+				{Line: 2, Fields: []string{"root", "holds water", "extra"}},
+			},
+		},
+		{
+			name:       "quizlet with default separators",
+			text:       "leaf\tmakes food\tin light\n\nroot\t",
+			opts:       DelimitedOptions{Format: FormatQuizlet},
+			wantFormat: FormatQuizlet,
+			want: []DelimitedRow{
+				{Line: 1, Fields: []string{"leaf", "makes food\tin light"}},
+				{Line: 3, Fields: []string{"root", ""}},
+			},
+		},
+		{
+			name:       "quizlet with custom separators",
+			text:       "leaf - makes food; root - holds - water;",
+			opts:       DelimitedOptions{Format: FormatQuizlet, FieldSeparator: " - ", RowSeparator: ";"},
+			wantFormat: FormatQuizlet,
+			want: []DelimitedRow{
+				{Line: 1, Fields: []string{"leaf", "makes food"}},
+				{Line: 2, Fields: []string{"root", "holds - water"}},
+			},
+		},
+		{
+			name:       "quizlet with the same separator twice",
+			text:       "leaf,food",
+			opts:       DelimitedOptions{Format: FormatQuizlet, FieldSeparator: ",", RowSeparator: ","},
+			wantFormat: FormatQuizlet,
+			wantErr:    true,
+		},
+		{
+			name:       "unknown format",
+			text:       "leaf,food",
+			opts:       DelimitedOptions{Format: "xlsx"},
+			wantFormat: "xlsx",
+			wantErr:    true,
+		},
+		{
+			name:    "not UTF-8",
+			text:    "leaf,\xff",
+			wantErr: true,
+		},
+		{
+			name:       "too many columns",
+			text:       strings.Repeat("x,", maxImportFields) + "x",
+			wantFormat: FormatCSV,
+			wantErr:    true,
+		},
+		{
+			name:       "too many rows",
+			text:       strings.Repeat("leaf,food\n", MaxImportRows+1),
+			opts:       DelimitedOptions{Format: FormatCSV},
+			wantFormat: FormatCSV,
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		rows, format, err := ParseDelimited(tt.text, tt.opts)
+		if (err != nil) != tt.wantErr || format != tt.wantFormat {
+			t.Errorf("%s: ParseDelimited() format %q, error %v; want %q, error %v", tt.name, format, err, tt.wantFormat, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(rows, tt.want) {
+			t.Errorf("%s: ParseDelimited() = %q, want %q", tt.name, rows, tt.want)
+		}
+	}
+}
+
+func col(i int) *int { return &i }
+
+func TestMapCards(t *testing.T) {
+	long := strings.Repeat("a", maxImportField+1)
+	rows := []DelimitedRow{
+		{Line: 1, Fields: []string{"Leaf", "Makes food"}},
+		{Line: 2, Fields: []string{"", "No front"}},
+		{Line: 3, Fields: []string{"Root"}},
+		{Line: 4, Fields: []string{"leaf", "Again"}},
+		{Line: 5, Fields: []string{"Stem", long}},
+		{Line: 6, Fields: []string{"Stem", "Holds the plant up"}},
+	}
+
+	cards, errs := MapCards(rows, ColumnMapping{Front: col(0), Back: col(1)})
+	wantCards := []MappedCard{
+		{Line: 1, Front: "Leaf", Back: "Makes food"},
+		{Line: 6, Front: "Stem", Back: "Holds the plant up"},
+	}
+	if !reflect.DeepEqual(cards, wantCards) {
+		t.Errorf("cards = %+v, want %+v", cards, wantCards)
+	}
+	wantErrs := []RowError{
+		{Line: 2, Message: "front is empty"},
+		{Line: 3, Message: "back is empty"},
+		{Line: 4, Message: "duplicate of the card on line 1"},
+		{Line: 5, Message: "back is longer than 5000 characters"},
+	}
+	if !reflect.DeepEqual(errs, wantErrs) {
+		t.Errorf("errors = %+v, want %+v", errs, wantErrs)
+	}
+
+	// Swapped columns turn the cards around
+	cards, _ = MapCards(rows[:1], ColumnMapping{Front: col(1), Back: col(0)})
+	if len(cards) != 1 || cards[0].Front != "Makes food" || cards[0].Back != "Leaf" {
+		t.Errorf("swapped mapping gave %+v", cards)
+	}
+}
+
+func TestMapQuestions(t *testing.T) {
+	rows := []DelimitedRow{
+		{Line: 1, Fields: []string{"Which gas do plants release?", "Oxygen", "Nitrogen", "", "gases"}},
+		{Line: 2, Fields: []string{"Where do plants make food?", "In the leaves"}},
+		{Line: 3, Fields: []string{"", "Oxygen"}},
+		{Line: 4, Fields: []string{"What do roots hold?", ""}},
+		{Line: 5, Fields: []string{"What is green?", "Leaves", "leaves"}},
+		{Line: 6, Fields: []string{"which gas do plants release?", "Oxygen"}},
+	}
+	m := ColumnMapping{Prompt: col(0), Answer: col(1), Distractors: []int{2, 3}, Concept: col(4)}
+
+	questions, errs := MapQuestions(rows, m)
+	wantQuestions := []MappedQuestion{
+		{Line: 1, Prompt: "Which gas do plants release?", Answer: "Oxygen", Distractors: []string{"Nitrogen"}, Concept: "gases"},
+		{Line: 2, Prompt: "Where do plants make food?", Answer: "In the leaves"},
+	}
+	if !reflect.DeepEqual(questions, wantQuestions) {
+		t.Errorf("questions = %+v, want %+v", questions, wantQuestions)
+	}
+	wantErrs := []RowError{
+		{Line: 3, Message: "prompt is empty"},
+		{Line: 4, Message: "answer is empty"},
+		{Line: 5, Message: `option "leaves" appears twice`},
+		{Line: 6, Message: "duplicate of the question on line 1"},
+	}
+	if !reflect.DeepEqual(errs, wantErrs) {
+		t.Errorf("errors = %+v, want %+v", errs, wantErrs)
+	}
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/MadMax168/Readsum/llm"
+)
+
+// maxTitleRunes keeps generated titles short enough for the chat list
+const maxTitleRunes = 60
+
+var titleSchema = &llm.Schema{
+	Type: llm.TypeObject,
+	Properties: map[string]*llm.Schema{
+		"title":         {Type: llm.TypeString},
+		"topic_changed": {Type: llm.TypeBoolean},
+	},
+	Required: []string{"title", "topic_changed"},
+}
+
+// SuggestChatTitle names a conversation from its transcript. When current is
+// given, changed reports whether the conversation has moved on to a different
+// topic than the one current describes; otherwise it is always true.
+func (ai *AI) SuggestChatTitle(transcript, current string) (string, bool, error) {
+	currentSection := ""
+	if current != "" {
+		currentSection = fmt.Sprintf(`
+The chat is currently titled %q. Set topic_changed to true only if the recent
+messages are mainly about a different subject than that title describes.
+`, current)
+	}
+
+	prompt := fmt.Sprintf(`Write a concise title for this conversation between a student and a study assistant.
+- 2 to 6 words, at most %d characters, describing the subject rather than the question
+- no quotes, no trailing punctuation, no emoji
+- in the same language as the conversation
+%s
+Conversation:
+%s`, maxTitleRunes, currentSection, transcript)
+
+	var out struct {
+		Title        string `json:"title"`
+		TopicChanged bool   `json:"topic_changed"`
+	}
+	if err := ai.GenerateJSON("", prompt, titleSchema, &out); err != nil {
+		return "", false, err
+	}
+
+	title := strings.Trim(normalizeSpace(out.Title), "\"'“”.。 ")
+	if r := []rune(title); len(r) > maxTitleRunes {
+		title = strings.TrimSpace(string(r[:maxTitleRunes]))
+	}
+	if title == "" {
+		return "", false, fmt.Errorf("model did not return a title")
+	}
+
+	return title, current == "" || out.TopicChanged, nil
+}
@@ -0,0 +1,218 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/MadMax168/Readsum/llm"
+)
+
+type GeneratedStep struct {
+	Description string `json:"description"`
+	Answer      string `json:"answer"`
+}
+
+// TutorPlan breaks a problem into the sub-steps the student should work out
+type TutorPlan struct {
+	Goal  string          `json:"goal"`
+	Steps []GeneratedStep `json:"steps"`
+}
+
+var tutorPlanSchema = &llm.Schema{
+	Type: llm.TypeObject,
+	Properties: map[string]*llm.Schema{
+		"goal": {Type: llm.TypeString},
+		"steps": {
+			Type: llm.TypeArray,
+			Items: &llm.Schema{
+				Type: llm.TypeObject,
+				Properties: map[string]*llm.Schema{
+					"description": {Type: llm.TypeString},
+					"answer":      {Type: llm.TypeString},
+				},
+				Required: []string{"description", "answer"},
+			},
+		},
+	},
+	Required: []string{"goal", "steps"},
+}
+
+// materialSection adds the study material to a tutor prompt when there is any
+func materialSection(source string) string {
+	if source == "" {
+		return ""
+	}
+	return "\nStudy material:\n" + source + "\n"
+}
+
+// PlanTutorSession splits the student's question into 2 to 6 sub-steps, each with
+// the answer the student should reach, grounded in source when it is given.
+// settings are the chat's, as for every tutor call.
+func (ai *AI) PlanTutorSession(settings ModelSettings, system, problem, source string) (*TutorPlan, error) {
+	prompt := fmt.Sprintf(`You are a tutor preparing to teach a student through a problem step by step.
+Break the student's question into 2 to 6 small sub-steps that build on each other,
+so that solving them all answers the question. For each step give a short description
+of what the student has to work out, and the answer they should reach.
+State the learning goal in one sentence.
+Write in the same language as the student's question.
+%s
+Student's question:
+%s`, materialSection(source), problem)
+
+	var plan TutorPlan
+	if err := ai.GenerateChatJSON(settings, system, prompt, tutorPlanSchema, &plan); err != nil {
+		return nil, err
+	}
+
+	var steps []GeneratedStep
+	for _, s := range plan.Steps {
+		s.Description = strings.TrimSpace(s.Description)
+		s.Answer = strings.TrimSpace(s.Answer)
+		if s.Description != "" {
+			steps = append(steps, s)
+		}
+	}
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("model did not return any steps")
+	}
+	plan.Steps = steps
+
+	return &plan, nil
+}
+
+// TutorStepState is a step as the tutor sees it during the session
+type TutorStepState struct {
+	Description string
+	Answer      string
+	Attempts    int
+	Solved      bool
+}
+
+// TutorTurn is the tutor's reply with what the student's message achieved.
+// Step numbers start at 1.
+type TutorTurn struct {
+	Reply          string `json:"reply"`
+	AttemptedSteps []int  `json:"attempted_steps"`
+	SolvedSteps    []int  `json:"solved_steps"`
+}
+
+var tutorTurnSchema = &llm.Schema{
+	Type: llm.TypeObject,
+	Properties: map[string]*llm.Schema{
+		"reply":           {Type: llm.TypeString},
+		"attempted_steps": {Type: llm.TypeArray, Items: &llm.Schema{Type: llm.TypeInteger}},
+		"solved_steps":    {Type: llm.TypeArray, Items: &llm.Schema{Type: llm.TypeInteger}},
+	},
+	Required: []string{"reply", "attempted_steps", "solved_steps"},
+}
+
+// TutorReply answers the student's message Socratically: it judges which steps
+// the message attempts or solves and asks a guiding question about the next one.
+// The answer of a step the student has never attempted must not be revealed; a
+// reply that still contains it is regenerated once with a stricter reminder.
+func (ai *AI) TutorReply(settings ModelSettings, system, problem, source string, steps []TutorStepState, transcript, message string) (*TutorTurn, error) {
+	var b strings.Builder
+	for i, s := range steps {
+		status := "not attempted yet: do NOT reveal this answer"
+		switch {
+		case s.Solved:
+			status = "solved"
+		case s.Attempts > 0:
+			status = fmt.Sprintf("attempted %d time(s) without success: you may now explain it if the student is stuck", s.Attempts)
+		}
+		fmt.Fprintf(&b, "%d. %s\n   Answer: %s\n   Status: %s\n", i+1, s.Description, s.Answer, status)
+	}
+
+	prompt := fmt.Sprintf(`You are a Socratic tutor. Teach; do not simply answer.
+- Lead the student through the steps below in order, one guiding question at a time.
+- Never give the answer to a step the student has not attempted. If they ask for it,
+  encourage them to try first and give a hint or a simpler question instead.
+- When the student's message is a genuine attempt, say what is right, point out what is
+  wrong without correcting it outright on the first try, and ask the next question.
+- Keep replies short and warm. Write in the same language as the student.
+Report the numbers of the steps the student's latest message attempts (attempted_steps)
+and the steps it answers correctly (solved_steps). Only judge the latest message.
+
+Problem:
+%s
+%s
+Steps:
+%s
+Conversation so far:
+%s
+Student's latest message:
+%s`, problem, materialSection(source), b.String(), transcript, message)
+
+	var turn TutorTurn
+	if err := ai.GenerateChatJSON(settings, system, prompt, tutorTurnSchema, &turn); err != nil {
+		return nil, err
+	}
+
+	attempted := make(map[int]bool)
+	for _, n := range append(turn.AttemptedSteps, turn.SolvedSteps...) {
+		attempted[n] = true
+	}
+	for i, s := range steps {
+		if s.Solved || s.Attempts > 0 || attempted[i+1] {
+			continue
+		}
+		if LeaksAnswer(turn.Reply, s.Answer) {
+			retry := prompt + fmt.Sprintf("\n\nYour previous reply gave away the answer to step %d (%q). Rewrite it without revealing that answer.", i+1, s.Answer)
+			if err := ai.GenerateChatJSON(settings, system, retry, tutorTurnSchema, &turn); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+
+	return &turn, nil
+}
+
+// LeaksAnswer reports whether reply states answer word for word. Very short
+// answers such as a single digit are ignored, since they appear by chance.
+func LeaksAnswer(reply, answer string) bool {
+	answer = strings.ToLower(normalizeSpace(answer))
+	if len([]rune(answer)) < 3 {
+		return false
+	}
+	return strings.Contains(strings.ToLower(normalizeSpace(reply)), answer)
+}
+
+// SummarizeTutorSession writes the end-of-session recap for the student: what was
+// learned, which steps they solved themselves and what to review next
+func (ai *AI) SummarizeTutorSession(settings ModelSettings, system, problem string, steps []TutorStepState, transcript string) (string, error) {
+	var b strings.Builder
+	for i, s := range steps {
+		status := "not solved"
+		switch {
+		case s.Solved && s.Attempts <= 1:
+			status = "solved on the first try"
+		case s.Solved:
+			status = fmt.Sprintf("solved after %d attempts", s.Attempts)
+		case s.Attempts > 0:
+			status = fmt.Sprintf("attempted %d time(s), not solved", s.Attempts)
+		}
+		fmt.Fprintf(&b, "%d. %s (answer: %s) - %s\n", i+1, s.Description, s.Answer, status)
+	}
+
+	prompt := fmt.Sprintf(`You are a tutor ending a study session. Write a short recap for the student in Markdown:
+- what they learned, as 2 to 5 bullet points
+- which steps they worked out themselves, and which needed help
+- the correct answer to the original problem, now that the session is over
+- one or two things to review next
+Address the student directly and write in the same language as the conversation.
+
+Problem:
+%s
+
+Steps:
+%s
+Conversation:
+%s`, problem, b.String(), transcript)
+
+	summary, err := ai.GenerateChatContent(settings, system, prompt)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(summary), nil
+}
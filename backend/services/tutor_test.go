@@ -0,0 +1,94 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/MadMax168/Readsum/llm"
+)
+
+var photosynthesisSteps = []TutorStepState{
+	{Description: "Where do plants make their food?", Answer: "in the leaves"},
+	{Description: "What process do they use?", Answer: "photosynthesis"},
+}
+
+func TestTutorReplyRegeneratesLeakedAnswer(t *testing.T) {
+	fake := llm.NewFake(
+		`{"reply":"It happens in the leaves, by photosynthesis.","attempted_steps":[],"solved_steps":[]}`,
+		`{"reply":"Which part of a plant faces the sun the most?","attempted_steps":[],"solved_steps":[]}`,
+	)
+	ai := NewAI(fake)
+
+	turn, err := ai.TutorReply(ModelSettings{}, "", "How do plants make food?", "", photosynthesisSteps, "", "How do plants make food?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if turn.Reply != "Which part of a plant faces the sun the most?" {
+		t.Errorf("reply = %q, want the regenerated reply", turn.Reply)
+	}
+	if len(fake.Requests) != 2 {
+		t.Errorf("made %d model calls, want 2", len(fake.Requests))
+	}
+}
+
+func TestTutorReplyKeepsAnswerOfAttemptedStep(t *testing.T) {
+	fake := llm.NewFake(
+		`{"reply":"Yes, in the leaves! Now, what is the process called?","attempted_steps":[1],"solved_steps":[1]}`,
+	)
+	ai := NewAI(fake)
+
+	turn, err := ai.TutorReply(ModelSettings{}, "", "How do plants make food?", "", photosynthesisSteps, "", "In the leaves?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.Requests) != 1 {
+		t.Errorf("made %d model calls, want 1", len(fake.Requests))
+	}
+	if len(turn.SolvedSteps) != 1 || turn.SolvedSteps[0] != 1 {
+		t.Errorf("solved steps = %v, want [1]", turn.SolvedSteps)
+	}
+}
+
+func TestTutorCallsUseChatSettings(t *testing.T) {
+	fake := llm.NewFake()
+	ai := NewAI(fake)
+
+	temperature := float32(0.2)
+	tokens := 512
+	settings := ModelSettings{Model: "small", Temperature: &temperature, MaxOutputTokens: &tokens, Safety: llm.SafetyStrict}
+
+	if _, err := ai.PlanTutorSession(settings, "", "How do plants make food?", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ai.TutorReply(settings, "", "How do plants make food?", "", photosynthesisSteps, "", "No idea"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ai.SummarizeTutorSession(settings, "", "How do plants make food?", photosynthesisSteps, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// The reply limit would cut the structured answers short, so it is not applied
+	for i, req := range fake.Requests {
+		if req.Model != "small" || req.Temperature != temperature || req.MaxOutputTokens != 0 || req.Safety != llm.SafetyStrict {
+			t.Errorf("call %d: model %q, temperature %v, max tokens %d, safety %q; want the chat's settings without its reply limit",
+				i, req.Model, req.Temperature, req.MaxOutputTokens, req.Safety)
+		}
+	}
+}
+
+func TestLeaksAnswer(t *testing.T) {
+	tests := []struct {
+		reply, answer string
+		want          bool
+	}{
+		{"It is called Photosynthesis.", "photosynthesis", true},
+		{"It is called photo\nsynthesis", "photosynthesis", false},
+		{"Think about   the leaves", "the  leaves", true},
+		{"Try counting to 4", "4", false},
+		{"What do you think?", "photosynthesis", false},
+	}
+	for _, tt := range tests {
+		if got := LeaksAnswer(tt.reply, tt.answer); got != tt.want {
+			t.Errorf("LeaksAnswer(%q, %q) = %v, want %v", tt.reply, tt.answer, got, tt.want)
+		}
+	}
+}
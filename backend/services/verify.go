@@ -0,0 +1,159 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/MadMax168/Readsum/llm"
+)
+
+// VerifyItem is a generated question with the answer it claims is correct
+type VerifyItem struct {
+	Prompt  string
+	Answer  string
+	Options []string
+}
+
+// QuestionCheck is the verdict on one question. Passage is the text of the
+// material that supports the answer, copied verbatim.
+type QuestionCheck struct {
+	Supported bool   `json:"supported"`
+	Ambiguous bool   `json:"ambiguous"`
+	Passage   string `json:"passage"`
+	Issue     string `json:"issue"`
+}
+
+var verifySchema = &llm.Schema{
+	Type: llm.TypeObject,
+	Properties: map[string]*llm.Schema{
+		"checks": {
+			Type: llm.TypeArray,
+			Items: &llm.Schema{
+				Type: llm.TypeObject,
+				Properties: map[string]*llm.Schema{
+					"number":    {Type: llm.TypeInteger},
+					"supported": {Type: llm.TypeBoolean},
+					"ambiguous": {Type: llm.TypeBoolean},
+					"passage":   {Type: llm.TypeString},
+					"issue":     {Type: llm.TypeString},
+				},
+				Required: []string{"number", "supported", "ambiguous", "passage", "issue"},
+			},
+		},
+	},
+	Required: []string{"checks"},
+}
+
+// VerifyQuestions asks the model to check every answer against source. The
+// result has one check per item, in order; items the model skipped come back
+// unsupported.
+func (ai *AI) VerifyQuestions(source string, items []VerifyItem) ([]QuestionCheck, error) {
+	var b strings.Builder
+	for i, item := range items {
+		fmt.Fprintf(&b, "%d. %s\n", i+1, item.Prompt)
+		for _, o := range item.Options {
+			fmt.Fprintf(&b, "   - %s\n", o)
+		}
+		fmt.Fprintf(&b, "   Answer given as correct: %s\n\n", item.Answer)
+	}
+
+	prompt := fmt.Sprintf(`You are a careful examiner reviewing quiz questions written by someone else.
+For each numbered question decide, using only the material below:
+- supported: true only if a passage of the material shows that the given answer is correct.
+- passage: the shortest passage (one to three sentences) that supports the answer,
+  copied exactly from the material, character for character. Empty if unsupported.
+- ambiguous: true if the question is unclear, or another listed option could also be
+  defended as correct from the material.
+- issue: a short explanation when the question is unsupported or ambiguous, otherwise empty.
+Write the issue in the same language as the questions.
+
+Material:
+%s
+
+Questions:
+%s`, source, b.String())
+
+	var out struct {
+		Checks []struct {
+			Number int `json:"number"`
+			QuestionCheck
+		} `json:"checks"`
+	}
+	if err := ai.GenerateJSON("", prompt, verifySchema, &out); err != nil {
+		return nil, err
+	}
+
+	checks := make([]QuestionCheck, len(items))
+	for i := range checks {
+		checks[i].Issue = "The answer could not be checked against the material"
+	}
+	for _, c := range out.Checks {
+		if c.Number >= 1 && c.Number <= len(items) {
+			checks[c.Number-1] = c.QuestionCheck
+		}
+	}
+
+	return checks, nil
+}
+
+// FindPassage locates quote in source, ignoring differences in whitespace and
+// case, and returns the passage as it is written in source
+func FindPassage(source, quote string) (string, bool) {
+	quote = normalizeSpace(quote)
+	if quote == "" {
+		return "", false
+	}
+
+	text := normalizeSpace(source)
+	lower := strings.ToLower(text)
+	i := strings.Index(lower, strings.ToLower(quote))
+	if i < 0 {
+		return "", false
+	}
+	// Lowercasing can change the byte length of some characters
+	if len(lower) != len(text) {
+		return quote, true
+	}
+	return text[i : i+len(quote)], true
+}
+
+// duplicateSimilarity is the share of common words above which two prompts ask the same thing
+const duplicateSimilarity = 0.8
+
+func promptWords(s string) map[string]bool {
+	words := make(map[string]bool)
+	for _, w := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && !unicode.IsMark(r)
+	}) {
+		words[w] = true
+	}
+	return words
+}
+
+// IsDuplicate reports whether prompt asks the same as one of seen: identical
+// after normalising, or sharing nearly all of its words
+func IsDuplicate(prompt string, seen []string) bool {
+	words := promptWords(prompt)
+	for _, s := range seen {
+		other := promptWords(s)
+		if len(words) == 0 || len(other) == 0 {
+			if strings.EqualFold(normalizeSpace(prompt), normalizeSpace(s)) {
+				return true
+			}
+			continue
+		}
+
+		common := 0
+		for w := range words {
+			if other[w] {
+				common++
+			}
+		}
+		union := len(words) + len(other) - common
+		if float64(common)/float64(union) >= duplicateSimilarity {
+			return true
+		}
+	}
+	return false
+}